@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	alertDesktopOff    = "off"
+	alertDesktopOSC9   = "osc9"
+	alertDesktopOSC777 = "osc777"
+
+	// Alert escapes only need to make it into one rendered frame
+	alertLinger = 200 * time.Millisecond
+
+	maxAlertPreview = 80
+)
+
+// Terminals disagree on which desktop notification sequence they support,
+// so users pick the one that works for them.
+var alertDesktopModes = []string{alertDesktopOff, alertDesktopOSC9, alertDesktopOSC777}
+
+var alertDesktopLabels = map[string]string{
+	alertDesktopOff:    "Off",
+	alertDesktopOSC9:   "OSC 9 (iTerm2, kitty, WezTerm, Ghostty)",
+	alertDesktopOSC777: "OSC 777 (foot, urxvt, VTE terminals)",
+}
+
+// newMailMsg tells a recipient's sessions that a message just arrived.
+type newMailMsg struct{ msg Message }
+
+// alertDoneMsg removes a delivered alert from the rendered output.
+type alertDoneMsg struct{}
+
+// alertSequence builds the escape sequences that announce new mail with the
+// user's settings, or "" if they want no alert.
+func alertSequence(settings AlertSettings, title, body string) string {
+	title, body = sanitizeAlertText(title), sanitizeAlertText(body)
+
+	var seq strings.Builder
+	if settings.Bell {
+		seq.WriteString("\a")
+	}
+	switch settings.Desktop {
+	case alertDesktopOSC9:
+		fmt.Fprintf(&seq, "\033]9;%s: %s\a", title, body)
+	case alertDesktopOSC777:
+		fmt.Fprintf(&seq, "\033]777;notify;%s;%s\a", title, body)
+	}
+	return seq.String()
+}
+
+// sanitizeAlertText keeps message text from ending or extending the escape
+// sequence it is embedded in.
+func sanitizeAlertText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == ';' {
+			return ' '
+		}
+		return r
+	}, s)
+	s = strings.Join(strings.Fields(s), " ")
+	if len([]rune(s)) > maxAlertPreview {
+		s = string([]rune(s)[:maxAlertPreview-1]) + "…"
+	}
+	return s
+}
+
+// unreadTitle is the window title for the given number of unread messages.
+func unreadTitle(unread int) string {
+	if unread == 0 {
+		return "soshial"
+	}
+	return fmt.Sprintf("(%d) soshial", unread)
+}
+
+// updateWindowTitle shows the unread count in the terminal title for users
+// who turned that on.
+func (m model) updateWindowTitle() tea.Cmd {
+	return func() tea.Msg {
+		settings, err := m.db.GetAlertSettings(m.userKey)
+		if err != nil {
+			return errMsg{err}
+		}
+		if !settings.WindowTitle {
+			return nil
+		}
+		unread, err := m.db.CountUnreadMessages(m.userKey)
+		if err != nil {
+			return errMsg{err}
+		}
+		return tea.SetWindowTitle(unreadTitle(unread))()
+	}
+}
+
+// handleNewMail alerts the user to a message that just arrived.
+func (m model) handleNewMail(msg Message) (tea.Model, tea.Cmd) {
+	cmds := []tea.Cmd{m.loadMessageCount(), m.updateWindowTitle()}
+
+	if msg.GroupID != 0 && m.userSettings.AlertScope == alertScopeDirect {
+		return m, tea.Batch(cmds...)
+	}
+	settings, err := m.db.GetAlertSettings(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, tea.Batch(cmds...)
+	}
+
+	sender := msg.FromKey[:min(12, len(msg.FromKey))] + "..."
+	if profile, err := m.db.GetProfile(msg.FromKey); err == nil && profile.DisplayName != "" {
+		sender = profile.DisplayName
+	}
+	title := "New message from " + sender
+	if msg.GroupID != 0 {
+		if names, err := m.db.GetGroupNames(); err == nil && names[msg.GroupID] != "" {
+			title += " in #" + names[msg.GroupID]
+		}
+	}
+
+	if seq := alertSequence(settings, "soshial", title+": "+msg.Message); seq != "" {
+		m.pendingAlert = seq
+		cmds = append(cmds, tea.Tick(alertLinger, func(time.Time) tea.Msg {
+			return alertDoneMsg{}
+		}))
+	}
+	return m, tea.Batch(cmds...)
+}
+
+func (m model) openAlertSettings() (tea.Model, tea.Cmd) {
+	settings, err := m.db.GetAlertSettings(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.alertSettings = settings
+	m.currentScreen = alertSettingsScreen
+	m.selectedAlertSetting = 0
+	m.err = nil
+	m.successMsg = ""
+	return m, nil
+}
+
+func (m model) updateAlertSettings(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	// Bell, desktop notifications and window title
+	const rows = 3
+
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = settingsMenu
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keyDown):
+		m.selectedAlertSetting = (m.selectedAlertSetting + 1) % rows
+	case m.keys.matches(msg, keyUp):
+		m.selectedAlertSetting = (m.selectedAlertSetting - 1 + rows) % rows
+
+	case m.keys.matches(msg, keySelect):
+		settings := m.alertSettings
+		var cmd tea.Cmd
+		switch m.selectedAlertSetting {
+		case 0:
+			settings.Bell = !settings.Bell
+			m.successMsg = "Bell turned off"
+			if settings.Bell {
+				m.successMsg = "Bell turned on"
+			}
+		case 1:
+			next := 0
+			for i, mode := range alertDesktopModes {
+				if mode == settings.Desktop {
+					next = (i + 1) % len(alertDesktopModes)
+				}
+			}
+			settings.Desktop = alertDesktopModes[next]
+			m.successMsg = "Desktop notifications: " + alertDesktopLabels[settings.Desktop]
+		case 2:
+			settings.WindowTitle = !settings.WindowTitle
+			m.successMsg = "Unread count removed from the window title"
+			cmd = tea.SetWindowTitle("")
+			if settings.WindowTitle {
+				m.successMsg = "Unread count shown in the window title"
+				cmd = nil
+			}
+		}
+
+		if err := m.db.SaveAlertSettings(settings); err != nil {
+			m.err = err
+			m.successMsg = ""
+			return m, nil
+		}
+		m.alertSettings = settings
+		m.err = nil
+		if cmd == nil {
+			cmd = m.updateWindowTitle()
+		}
+		return m, cmd
+
+	case m.keys.matches(msg, keyTest):
+		seq := alertSequence(m.alertSettings, "soshial", "This is what new mail looks like")
+		if seq == "" {
+			m.err = fmt.Errorf("turn on the bell or desktop notifications first")
+			m.successMsg = ""
+			return m, nil
+		}
+		m.pendingAlert = seq
+		m.successMsg = "Test alert sent"
+		m.err = nil
+		return m, tea.Tick(alertLinger, func(time.Time) tea.Msg {
+			return alertDoneMsg{}
+		})
+	}
+	return m, nil
+}
+
+func (m model) viewAlertSettings() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("🔔  New Mail Alerts")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	s.WriteString(st.inputLabelStyle.Render("How this session gets your attention when a message arrives"))
+	s.WriteString("\n\n")
+
+	onOff := func(on bool) string {
+		if on {
+			return "On"
+		}
+		return "Off"
+	}
+	rows := []struct{ label, value string }{
+		{"Bell", onOff(m.alertSettings.Bell)},
+		{"Desktop", alertDesktopLabels[m.alertSettings.Desktop]},
+		{"Window title", onOff(m.alertSettings.WindowTitle)},
+	}
+
+	labelStyle := m.renderer.NewStyle().Width(16)
+	for i, row := range rows {
+		valueStyle := m.renderer.NewStyle().Foreground(st.textColor)
+		if row.value == "Off" {
+			valueStyle = valueStyle.Foreground(st.mutedColor).Italic(true)
+		}
+
+		if i == m.selectedAlertSetting {
+			indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+			s.WriteString("  " + indicator + labelStyle.Foreground(st.selectionColor).Bold(true).Render(row.label) + valueStyle.Render(row.value))
+		} else {
+			s.WriteString("    " + labelStyle.Foreground(st.accentColor).Render(row.label) + valueStyle.Render(row.value))
+		}
+		s.WriteString("\n")
+	}
+
+	s.WriteString("\n")
+	hint := "Desktop notifications need a terminal that understands the chosen sequence. The window title shows your unread count, e.g. " + unreadTitle(3) + "."
+	s.WriteString(m.renderer.NewStyle().Foreground(st.mutedColor).Width(m.contentWidth()).PaddingLeft(2).Render(hint))
+	s.WriteString("\n")
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.Render(m.keyHint(keySelect, "to change") + " • " + m.keyHint(keyTest, "to test") + " • " + m.navHint() + " • " + m.keyHint(keyBack, "to return")))
+
+	return s.String()
+}
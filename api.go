@@ -0,0 +1,605 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+const (
+	scopeRead = "read"
+	scopeSend = "send"
+
+	apiTokenPrefix     = "soshial_"
+	apiSessionPrefix   = "soshial_s_"
+	botTokenPrefix     = "soshial_bot_"
+	apiChallengeTTL    = 5 * time.Minute
+	apiPruneInterval   = time.Minute
+	apiSessionTTL      = time.Hour
+	apiMaxMessageRunes = 1000 // Same limit as the compose textarea
+	apiMaxBodyBytes    = 64 << 10
+
+	// Outstanding challenges, overall and per client address, since anyone
+	// can ask for one
+	apiMaxChallenges       = 10000
+	apiMaxClientChallenges = 10
+
+	// sshsigNamespace is the namespace challenges must be signed with:
+	//
+	//	printf %s "$CHALLENGE" | ssh-keygen -Y sign -f ~/.ssh/id_ed25519 -n soshial
+	sshsigNamespace = "soshial"
+)
+
+// APIServer exposes the mailbox over HTTP. It shares the Database,
+// RateLimiter and Webhooks with the SSH server so both interfaces behave the
+// same way. Bots authenticate with their own tokens and are limited
+// separately, each at its configured rate.
+type APIServer struct {
+	db             *Database
+	rateLimiter    *RateLimiter
+	botRateLimiter *RateLimiter
+	webhooks       *Webhooks
+	presence       *Presence
+
+	mu               sync.Mutex
+	challenges       map[string]apiChallenge
+	clientChallenges map[string]int // Client address -> outstanding challenges
+	sessions         map[string]apiSession
+}
+
+// apiChallenge is a challenge waiting to be signed.
+type apiChallenge struct {
+	client  string
+	expires time.Time
+}
+
+// apiSession is a short-lived token obtained by signing a challenge with an
+// SSH key.
+type apiSession struct {
+	fingerprint string
+	expires     time.Time
+}
+
+// apiCaller identifies who made an authenticated request.
+type apiCaller struct {
+	fingerprint string
+	scope       string
+	bot         *Bot // Set when the caller is a bot
+}
+
+func NewAPIServer(db *Database, rateLimiter *RateLimiter, webhooks *Webhooks, presence *Presence) *APIServer {
+	return &APIServer{
+		db:               db,
+		rateLimiter:      rateLimiter,
+		botRateLimiter:   NewRateLimiter(0),
+		webhooks:         webhooks,
+		presence:         presence,
+		challenges:       make(map[string]apiChallenge),
+		clientChallenges: make(map[string]int),
+		sessions:         make(map[string]apiSession),
+	}
+}
+
+// Run prunes expired challenges and sessions until ctx is cancelled.
+func (a *APIServer) Run(ctx context.Context) {
+	ticker := time.NewTicker(apiPruneInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				a.prune(now)
+			}
+		}
+	}()
+}
+
+func (a *APIServer) prune(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for c, challenge := range a.challenges {
+		if now.After(challenge.expires) {
+			a.removeChallenge(c, challenge)
+		}
+	}
+	for token, session := range a.sessions {
+		if now.After(session.expires) {
+			delete(a.sessions, token)
+		}
+	}
+}
+
+// removeChallenge forgets a challenge. a.mu must be held.
+func (a *APIServer) removeChallenge(c string, challenge apiChallenge) {
+	delete(a.challenges, c)
+	a.clientChallenges[challenge.client]--
+	if a.clientChallenges[challenge.client] <= 0 {
+		delete(a.clientChallenges, challenge.client)
+	}
+}
+
+// Handler returns the routes of the API.
+func (a *APIServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/auth/challenge", a.handleChallenge)
+	mux.HandleFunc("POST /api/v1/auth/verify", a.handleVerify)
+	mux.HandleFunc("GET /api/v1/me", a.authed(scopeRead, a.handleMe))
+	mux.HandleFunc("GET /api/v1/messages", a.authed(scopeRead, a.handleInbox))
+	mux.HandleFunc("POST /api/v1/messages", a.authed(scopeSend, a.handleSend))
+	mux.HandleFunc("POST /api/v1/messages/{id}/read", a.authed(scopeSend, a.handleMarkRead))
+	mux.HandleFunc("DELETE /api/v1/messages/{id}", a.authed(scopeSend, a.handleDelete))
+	mux.HandleFunc("GET /api/v1/users/{fingerprint...}", a.authed(scopeRead, a.handleUser))
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...any) {
+	writeJSON(w, status, map[string]string{"error": fmt.Sprintf(format, args...)})
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, apiMaxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+// authed wraps a handler so it only runs for callers whose token grants
+// scope. Read-only tokens may only use read endpoints.
+func (a *APIServer) authed(scope string, h func(http.ResponseWriter, *http.Request, apiCaller)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+
+		caller, err := a.authenticate(token)
+		if err != nil {
+			log.Printf("API authentication failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "authentication failed")
+			return
+		}
+		if caller == nil {
+			writeError(w, http.StatusUnauthorized, "invalid or expired token")
+			return
+		}
+		if scope == scopeSend && caller.scope != scopeSend {
+			writeError(w, http.StatusForbidden, "token is read-only")
+			return
+		}
+
+		h(w, r, *caller)
+	}
+}
+
+func (a *APIServer) authenticate(token string) (*apiCaller, error) {
+	if strings.HasPrefix(token, apiSessionPrefix) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		session, ok := a.sessions[token]
+		if !ok {
+			return nil, nil
+		}
+		if time.Now().After(session.expires) {
+			delete(a.sessions, token)
+			return nil, nil
+		}
+		return &apiCaller{fingerprint: session.fingerprint, scope: scopeSend}, nil
+	}
+
+	if strings.HasPrefix(token, botTokenPrefix) {
+		bot, err := a.db.AuthenticateBot(hashAPIToken(token))
+		if err != nil || bot == nil {
+			return nil, err
+		}
+		return &apiCaller{fingerprint: bot.ID, scope: scopeSend, bot: bot}, nil
+	}
+
+	apiToken, err := a.db.AuthenticateAPIToken(hashAPIToken(token))
+	if err != nil || apiToken == nil {
+		return nil, err
+	}
+	return &apiCaller{fingerprint: apiToken.SSHKeyFingerprint, scope: apiToken.Scope}, nil
+}
+
+func (a *APIServer) handleChallenge(w http.ResponseWriter, r *http.Request) {
+	challenge, err := randomHex(32)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create challenge")
+		return
+	}
+	expires := time.Now().Add(apiChallengeTTL)
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+
+	a.mu.Lock()
+	if len(a.challenges) >= apiMaxChallenges || a.clientChallenges[client] >= apiMaxClientChallenges {
+		a.mu.Unlock()
+		w.Header().Set("Retry-After", strconv.Itoa(int(apiPruneInterval.Seconds())))
+		writeError(w, http.StatusTooManyRequests, "too many outstanding challenges, sign one or try again later")
+		return
+	}
+	a.challenges[challenge] = apiChallenge{client: client, expires: expires}
+	a.clientChallenges[client]++
+	a.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"challenge":  challenge,
+		"namespace":  sshsigNamespace,
+		"expires_at": expires.UTC(),
+	})
+}
+
+func (a *APIServer) handleVerify(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Challenge string `json:"challenge"`
+		Signature string `json:"signature"`
+	}
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+
+	// Challenges are single use
+	a.mu.Lock()
+	challenge, ok := a.challenges[req.Challenge]
+	if ok {
+		a.removeChallenge(req.Challenge, challenge)
+	}
+	a.mu.Unlock()
+	if !ok || time.Now().After(challenge.expires) {
+		writeError(w, http.StatusUnauthorized, "unknown or expired challenge")
+		return
+	}
+
+	pubKey, err := verifySSHSignature(req.Signature, []byte(req.Challenge))
+	if err != nil {
+		// Allow signatures made with `echo`, which appends a newline
+		pubKey, err = verifySSHSignature(req.Signature, []byte(req.Challenge+"\n"))
+	}
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "signature verification failed: %v", err)
+		return
+	}
+
+	fingerprint := fingerprintFor(pubKey)
+	if err := a.db.UpsertUser(fingerprint); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to update user")
+		return
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create session")
+		return
+	}
+	token := apiSessionPrefix + secret
+	session := apiSession{fingerprint: fingerprint, expires: time.Now().Add(apiSessionTTL)}
+
+	a.mu.Lock()
+	a.sessions[token] = session
+	a.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"token":       token,
+		"fingerprint": fingerprint,
+		"expires_at":  session.expires.UTC(),
+	})
+}
+
+func (a *APIServer) handleMe(w http.ResponseWriter, r *http.Request, caller apiCaller) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"fingerprint": caller.fingerprint,
+		"scope":       caller.scope,
+	})
+}
+
+func (a *APIServer) handleInbox(w http.ResponseWriter, r *http.Request, caller apiCaller) {
+	messages, err := a.db.GetMessagesForUser(caller.fingerprint)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load messages")
+		return
+	}
+
+	if r.URL.Query().Get("unread") == "true" || r.URL.Query().Get("unread") == "1" {
+		unread := messages[:0]
+		for _, msg := range messages {
+			if !msg.Read {
+				unread = append(unread, msg)
+			}
+		}
+		messages = unread
+	}
+	if messages == nil {
+		messages = []Message{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"messages": messages})
+}
+
+func (a *APIServer) handleSend(w http.ResponseWriter, r *http.Request, caller apiCaller) {
+	var req struct {
+		To      string `json:"to"`
+		Message string `json:"message"`
+	}
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "%v", err)
+		return
+	}
+	if req.To == "" {
+		writeError(w, http.StatusBadRequest, "recipient cannot be empty")
+		return
+	}
+	req.Message = stripControl(req.Message)
+	exists, err := a.db.UserExists(req.To)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to look up recipient")
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		writeError(w, http.StatusBadRequest, "message cannot be empty")
+		return
+	}
+	if utf8.RuneCountInString(req.Message) > apiMaxMessageRunes {
+		writeError(w, http.StatusBadRequest, "message is longer than %d characters", apiMaxMessageRunes)
+		return
+	}
+
+	// People share the TUI's limit; bots have their own
+	limiter, interval := a.rateLimiter, a.rateLimiter.minInterval
+	if caller.bot != nil {
+		limiter, interval = a.botRateLimiter, caller.bot.RateLimit
+	}
+	if !limiter.CanSendMessageEvery(caller.fingerprint, interval) {
+		w.Header().Set("Retry-After", strconv.Itoa(max(int(interval.Seconds()), 1)))
+		writeError(w, http.StatusTooManyRequests, "rate limit: please wait %s between messages", interval)
+		return
+	}
+
+	sent, err := a.db.SendMessage(caller.fingerprint, req.To, req.Message)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to send message")
+		return
+	}
+	limiter.RecordMessage(caller.fingerprint)
+	go a.webhooks.Emit(eventMessageReceived, req.To, sent)
+	a.presence.Send(req.To, newMailMsg{sent})
+
+	writeJSON(w, http.StatusCreated, sent)
+}
+
+// ownMessage loads the message named in the URL and checks that it is in the
+// caller's inbox.
+func (a *APIServer) ownMessage(w http.ResponseWriter, r *http.Request, caller apiCaller) (*Message, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid message id")
+		return nil, false
+	}
+	msg, err := a.db.GetMessage(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to load message")
+		return nil, false
+	}
+	if msg == nil || msg.ToKey != caller.fingerprint {
+		writeError(w, http.StatusNotFound, "message not found")
+		return nil, false
+	}
+	return msg, true
+}
+
+func (a *APIServer) handleMarkRead(w http.ResponseWriter, r *http.Request, caller apiCaller) {
+	msg, ok := a.ownMessage(w, r, caller)
+	if !ok {
+		return
+	}
+
+	if !msg.Read {
+		if err := a.db.MarkMessageAsRead(msg.ID); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to mark message as read")
+			return
+		}
+		msg.Read = true
+		go a.webhooks.Emit(eventMessageRead, msg.FromKey, *msg)
+	}
+
+	writeJSON(w, http.StatusOK, msg)
+}
+
+func (a *APIServer) handleDelete(w http.ResponseWriter, r *http.Request, caller apiCaller) {
+	msg, ok := a.ownMessage(w, r, caller)
+	if !ok {
+		return
+	}
+
+	if err := a.db.DeleteMessage(msg.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete message")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *APIServer) handleUser(w http.ResponseWriter, r *http.Request, caller apiCaller) {
+	user, err := a.db.GetUser(r.PathValue("fingerprint"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to look up user")
+		return
+	}
+	if user == nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	profile, err := a.db.GetProfile(user.SSHKeyFingerprint)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to look up profile")
+		return
+	}
+
+	resp := apiUser{
+		Fingerprint: user.SSHKeyFingerprint,
+		FirstSeen:   user.FirstSeen,
+		DisplayName: profile.DisplayName,
+		Pronouns:    profile.Pronouns,
+		Status:      profile.Status,
+		Bio:         profile.Bio,
+		Link:        profile.Link,
+	}
+	if profile.ShowLastSeen || caller.fingerprint == user.SSHKeyFingerprint {
+		resp.LastSeen = &user.LastSeen
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// apiUser is a user and their public profile. LastSeen is omitted when the
+// user has hidden it.
+type apiUser struct {
+	Fingerprint string     `json:"fingerprint"`
+	FirstSeen   time.Time  `json:"first_seen"`
+	LastSeen    *time.Time `json:"last_seen,omitempty"`
+	DisplayName string     `json:"display_name,omitempty"`
+	Pronouns    string     `json:"pronouns,omitempty"`
+	Status      string     `json:"status,omitempty"`
+	Bio         string     `json:"bio,omitempty"`
+	Link        string     `json:"link,omitempty"`
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newAPIToken returns a fresh token and the hash to store for it.
+func newAPIToken() (token, tokenHash string, err error) {
+	return newPrefixedToken(apiTokenPrefix)
+}
+
+func newPrefixedToken(prefix string) (token, tokenHash string, err error) {
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", "", err
+	}
+	token = prefix + secret
+	return token, hashAPIToken(token), nil
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// verifySSHSignature checks an armored SSHSIG signature, as produced by
+// `ssh-keygen -Y sign`, over message and returns the signing key.
+func verifySSHSignature(armored string, message []byte) (gossh.PublicKey, error) {
+	const (
+		begin = "-----BEGIN SSH SIGNATURE-----"
+		end   = "-----END SSH SIGNATURE-----"
+		magic = "SSHSIG"
+	)
+
+	body := strings.TrimSpace(armored)
+	body, ok := strings.CutPrefix(body, begin)
+	if !ok {
+		return nil, errors.New("signature is not an armored SSH signature")
+	}
+	body, ok = strings.CutSuffix(body, end)
+	if !ok {
+		return nil, errors.New("signature is not an armored SSH signature")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %v", err)
+	}
+	if !bytes.HasPrefix(raw, []byte(magic)) {
+		return nil, errors.New("invalid signature preamble")
+	}
+
+	var blob struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := gossh.Unmarshal(raw[len(magic):], &blob); err != nil {
+		return nil, fmt.Errorf("invalid signature: %v", err)
+	}
+	if blob.Version != 1 {
+		return nil, fmt.Errorf("unsupported signature version %d", blob.Version)
+	}
+	if blob.Namespace != sshsigNamespace {
+		return nil, fmt.Errorf("signature namespace must be %q", sshsigNamespace)
+	}
+
+	var h hash.Hash
+	switch blob.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm %q", blob.HashAlgorithm)
+	}
+	h.Write(message)
+
+	pubKey, err := gossh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+
+	var sig gossh.Signature
+	if err := gossh.Unmarshal(blob.Signature, &sig); err != nil {
+		return nil, fmt.Errorf("invalid signature: %v", err)
+	}
+
+	signed := append([]byte(magic), gossh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{blob.Namespace, blob.Reserved, blob.HashAlgorithm, h.Sum(nil)})...)
+
+	if err := pubKey.Verify(signed, &sig); err != nil {
+		return nil, errors.New("signature does not match")
+	}
+	return pubKey, nil
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// sshsig is an SSHSIG signature before it is armored, so tests can break
+// one part at a time.
+type sshsig struct {
+	version   uint32
+	namespace string
+	hashAlgo  string
+	message   []byte
+}
+
+func newTestSigner(t *testing.T) gossh.Signer {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// sign produces what `ssh-keygen -Y sign` would for s.
+func (s sshsig) sign(t *testing.T, signer gossh.Signer) string {
+	t.Helper()
+	var h hash.Hash = sha512.New()
+	if s.hashAlgo == "sha256" {
+		h = sha256.New()
+	}
+	h.Write(s.message)
+	signed := append([]byte("SSHSIG"), gossh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{s.namespace, "", s.hashAlgo, h.Sum(nil)})...)
+	sig, err := signer.Sign(rand.Reader, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw := append([]byte("SSHSIG"), gossh.Marshal(struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}{s.version, signer.PublicKey().Marshal(), s.namespace, "", s.hashAlgo, gossh.Marshal(sig)})...)
+	return armorSSHSig(raw)
+}
+
+func armorSSHSig(raw []byte) string {
+	return "-----BEGIN SSH SIGNATURE-----\n" + base64.StdEncoding.EncodeToString(raw) + "\n-----END SSH SIGNATURE-----\n"
+}
+
+func TestVerifySSHSignature(t *testing.T) {
+	signer := newTestSigner(t)
+	challenge := []byte("4f2a9c")
+	valid := sshsig{version: 1, namespace: sshsigNamespace, hashAlgo: "sha512", message: challenge}
+
+	tampered := valid
+	tampered.message = []byte("something else")
+	wrongNamespace := valid
+	wrongNamespace.namespace = "git"
+	wrongVersion := valid
+	wrongVersion.version = 2
+	wrongHash := valid
+	wrongHash.hashAlgo = "md5"
+	sha256Sig := valid
+	sha256Sig.hashAlgo = "sha256"
+
+	tests := []struct {
+		name    string
+		armored string
+		wantErr string
+	}{
+		{"sha512", valid.sign(t, signer), ""},
+		{"sha256", sha256Sig.sign(t, signer), ""},
+		{"different message", tampered.sign(t, signer), "signature does not match"},
+		{"other namespace", wrongNamespace.sign(t, signer), "namespace must be"},
+		{"unknown version", wrongVersion.sign(t, signer), "unsupported signature version"},
+		{"unknown hash", wrongHash.sign(t, signer), "unsupported hash algorithm"},
+		{"not armored", "SSHSIG", "not an armored SSH signature"},
+		{"no end line", "-----BEGIN SSH SIGNATURE-----\nU1NIU0lH\n", "not an armored SSH signature"},
+		{"bad base64", armorSSHSig(nil)[:30] + "!!!\n-----END SSH SIGNATURE-----", "invalid signature encoding"},
+		{"wrong preamble", armorSSHSig([]byte("SSHSIX")), "invalid signature preamble"},
+		{"truncated", armorSSHSig([]byte("SSHSIG\x00\x00")), "invalid signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pubKey, err := verifySSHSignature(tt.armored, challenge)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verifySSHSignature = %v, want no error", err)
+				}
+				if !bytes.Equal(pubKey.Marshal(), signer.PublicKey().Marshal()) {
+					t.Error("verifySSHSignature returned a different key")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("verifySSHSignature = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func newTestAPIServer(t *testing.T) (*APIServer, http.Handler) {
+	t.Helper()
+	db := newTestDatabase(t)
+	a := NewAPIServer(db, NewRateLimiter(0), NewWebhooks(db), NewPresence())
+	return a, a.Handler()
+}
+
+func requestChallenge(h http.Handler, client string) (*httptest.ResponseRecorder, string) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/challenge", nil)
+	req.RemoteAddr = client + ":40000"
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var resp struct {
+		Challenge string `json:"challenge"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return rec, resp.Challenge
+}
+
+func TestAPIChallengeCaps(t *testing.T) {
+	a, h := newTestAPIServer(t)
+
+	tests := []struct {
+		client string
+		want   int
+	}{
+		{"198.51.100.1", http.StatusOK},
+		{"198.51.100.1", http.StatusTooManyRequests},
+		{"198.51.100.2", http.StatusOK},
+	}
+	for i := 0; i < apiMaxClientChallenges-1; i++ {
+		if rec, _ := requestChallenge(h, "198.51.100.1"); rec.Code != http.StatusOK {
+			t.Fatalf("challenge %d = %d, want %d", i+1, rec.Code, http.StatusOK)
+		}
+	}
+	for _, tt := range tests {
+		if rec, _ := requestChallenge(h, tt.client); rec.Code != tt.want {
+			t.Errorf("challenge for %s = %d, want %d", tt.client, rec.Code, tt.want)
+		}
+	}
+
+	// Expired challenges free their slots
+	a.prune(time.Now().Add(apiChallengeTTL + time.Second))
+	if len(a.challenges) != 0 || len(a.clientChallenges) != 0 {
+		t.Fatalf("prune left %d challenges for %d clients", len(a.challenges), len(a.clientChallenges))
+	}
+	if rec, _ := requestChallenge(h, "198.51.100.1"); rec.Code != http.StatusOK {
+		t.Errorf("challenge after pruning = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestAPIChallengeOverallCap(t *testing.T) {
+	a, h := newTestAPIServer(t)
+	a.mu.Lock()
+	for i := 0; i < apiMaxChallenges; i++ {
+		a.challenges[fmt.Sprint(i)] = apiChallenge{client: fmt.Sprint("client", i), expires: time.Now().Add(apiChallengeTTL)}
+	}
+	a.mu.Unlock()
+
+	if rec, _ := requestChallenge(h, "198.51.100.9"); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("challenge over the overall cap = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestAPIVerify(t *testing.T) {
+	a, h := newTestAPIServer(t)
+	signer := newTestSigner(t)
+	_, challenge := requestChallenge(h, "198.51.100.1")
+
+	verify := func(signature string) int {
+		body, _ := json.Marshal(map[string]string{"challenge": challenge, "signature": signature})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/verify", bytes.NewReader(body))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	signature := sshsig{version: 1, namespace: sshsigNamespace, hashAlgo: "sha512", message: []byte(challenge)}.sign(t, signer)
+	if code := verify(signature); code != http.StatusOK {
+		t.Fatalf("verify = %d, want %d", code, http.StatusOK)
+	}
+	if len(a.clientChallenges) != 0 {
+		t.Errorf("a verified challenge still counts against its client")
+	}
+	// Challenges are single use
+	if code := verify(signature); code != http.StatusUnauthorized {
+		t.Errorf("verify with a used challenge = %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+func TestAPISendStripsControl(t *testing.T) {
+	a, h := newTestAPIServer(t)
+	for _, key := range []string{"alice", "bob"} {
+		if err := a.db.UpsertUser(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token, hashed, err := newAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.db.CreateAPIToken("alice", "ci", hashed, scopeSend); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		message string
+		want    int
+		stored  string
+	}{
+		{"hi \x1b]52;c;QUJD\x07there", http.StatusCreated, "hi ]52;c;QUJDthere"},
+		{"line one\r\nline two\twith a tab", http.StatusCreated, "line one\nline two\twith a tab"},
+		{"line\u0085three\u009b31m", http.StatusCreated, "linethree31m"},
+		{"\x1b\x07\r\n\x00", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		body, _ := json.Marshal(map[string]string{"to": "bob", "message": tt.message})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/messages", bytes.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("send %q = %d %s, want %d", tt.message, rec.Code, rec.Body, tt.want)
+			continue
+		}
+		if tt.want != http.StatusCreated {
+			continue
+		}
+		var sent Message
+		json.Unmarshal(rec.Body.Bytes(), &sent)
+		if sent.Message != tt.stored {
+			t.Errorf("send %q stored %q, want %q", tt.message, sent.Message, tt.stored)
+		}
+	}
+}
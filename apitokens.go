@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+var scopeLabels = map[string]string{
+	scopeRead: "read-only",
+	scopeSend: "send",
+}
+
+func (m model) openAPITokens() (tea.Model, tea.Cmd) {
+	m.currentScreen = apiTokenSettings
+	m.selectedAPIToken = 0
+	m.namingAPIToken = false
+	m.newAPIToken = ""
+	m.err = nil
+	m.successMsg = ""
+	return m.reloadAPITokens()
+}
+
+func (m model) reloadAPITokens() (tea.Model, tea.Cmd) {
+	tokens, err := m.db.GetAPITokens(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.apiTokens = tokens
+	if m.selectedAPIToken >= len(tokens) {
+		m.selectedAPIToken = max(len(tokens)-1, 0)
+	}
+	return m, nil
+}
+
+func (m model) updateAPITokenSettings(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	if m.namingAPIToken {
+		switch msg.String() {
+		case "esc":
+			m.namingAPIToken = false
+			m.apiTokenNameInput.Blur()
+			m.err = nil
+			return m, nil
+
+		case "tab":
+			if m.newAPITokenScope == scopeSend {
+				m.newAPITokenScope = scopeRead
+			} else {
+				m.newAPITokenScope = scopeSend
+			}
+			return m, nil
+
+		case "enter":
+			name := strings.TrimSpace(m.apiTokenNameInput.Value())
+			if name == "" {
+				m.err = fmt.Errorf("token name cannot be empty")
+				return m, nil
+			}
+			token, tokenHash, err := newAPIToken()
+			if err != nil {
+				m.err = err
+				return m, nil
+			}
+			if _, err := m.db.CreateAPIToken(m.userKey, name, tokenHash, m.newAPITokenScope); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.namingAPIToken = false
+			m.apiTokenNameInput.Blur()
+			m.newAPIToken = token
+			m.clipboardText = token
+			m.successMsg = "API token created and copied to clipboard!"
+			m.selectedAPIToken = len(m.apiTokens)
+			return m.reloadAPITokens()
+		}
+
+		m.apiTokenNameInput, cmd = m.apiTokenNameInput.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = settingsMenu
+		m.newAPIToken = ""
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keyDown):
+		if len(m.apiTokens) > 0 {
+			m.selectedAPIToken = (m.selectedAPIToken + 1) % len(m.apiTokens)
+		}
+	case m.keys.matches(msg, keyUp):
+		if len(m.apiTokens) > 0 {
+			m.selectedAPIToken = (m.selectedAPIToken - 1 + len(m.apiTokens)) % len(m.apiTokens)
+		}
+
+	case m.keys.matches(msg, keyNew):
+		m.namingAPIToken = true
+		m.newAPITokenScope = scopeRead
+		m.newAPIToken = ""
+		m.apiTokenNameInput.SetValue("")
+		m.err = nil
+		m.successMsg = ""
+		return m, m.apiTokenNameInput.Focus()
+
+	case m.keys.matches(msg, keyDelete):
+		if len(m.apiTokens) == 0 {
+			return m, nil
+		}
+		token := m.apiTokens[m.selectedAPIToken]
+		if err := m.db.RevokeAPIToken(token.ID, m.userKey); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.newAPIToken = ""
+		m.successMsg = fmt.Sprintf("Token %q revoked", token.Name)
+		m.err = nil
+		return m.reloadAPITokens()
+	}
+	return m, nil
+}
+
+func (m model) viewAPITokenSettings() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("🔑  API Tokens")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	if m.namingAPIToken {
+		s.WriteString(st.inputLabelStyle.Render("Name your new token"))
+		s.WriteString("\n\n")
+
+		// Error message (fixed height to keep bottom elements stable)
+		if m.err != nil {
+			s.WriteString(st.errorStyle.Render(" ✗ " + m.err.Error() + " "))
+		}
+		s.WriteString("\n\n")
+
+		input := st.inputBoxStyle.Width(m.contentWidth()).Render(m.apiTokenNameInput.View())
+		s.WriteString(input)
+		s.WriteString("\n")
+
+		scope := m.renderer.NewStyle().Foreground(st.highlight).Bold(true).Render(scopeLabels[m.newAPITokenScope])
+		s.WriteString(m.renderer.NewStyle().Foreground(st.textColor).Render("Scope: ") + scope)
+		s.WriteString("\n")
+		s.WriteString(st.helpStyle.Render("Press [enter] to create • [tab] to toggle scope • [esc] to cancel"))
+		return s.String()
+	}
+
+	if m.newAPIToken != "" {
+		s.WriteString(st.inputLabelStyle.Render("Your new token (shown only once):"))
+		s.WriteString("\n")
+		s.WriteString(st.inputBoxStyle.Width(m.contentWidth()).Render(m.newAPIToken))
+		s.WriteString("\n")
+	}
+
+	if len(m.apiTokens) == 0 {
+		s.WriteString(st.emptyStateStyle.Width(m.contentWidth()).Render("No API tokens yet.\n\nTokens let scripts use the HTTP API and\nSMTP gateway without your SSH private key."))
+		s.WriteString("\n")
+	} else {
+		for i, token := range m.apiTokens {
+			lastUsed := "never used"
+			if !token.LastUsedAt.IsZero() {
+				lastUsed = "last used " + m.formatTime(token.LastUsedAt, timeShort)
+			}
+			name := token.Name
+			if len([]rune(name)) > 24 {
+				name = string([]rune(name)[:21]) + "..."
+			}
+			line := fmt.Sprintf("%-24s %-9s  %s", name, scopeLabels[token.Scope], lastUsed)
+			if i == m.selectedAPIToken {
+				indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+				s.WriteString("  " + indicator + m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Render(line))
+			} else {
+				s.WriteString("    " + m.renderer.NewStyle().Foreground(st.textColor).Render(line))
+			}
+			s.WriteString("\n")
+		}
+	}
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.Render(m.keyHint(keyNew, "to create a token") + " • " + m.keyHint(keyDelete, "to revoke") + " • " + m.navHint() + " • " + m.keyHint(keyBack, "to return")))
+
+	return s.String()
+}
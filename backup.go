@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const backupPrefix = "soshial-"
+
+// runBackupCommand implements "soshial backup <path>". It can run while the
+// server is up since SQLite serializes the snapshot against live writers.
+func runBackupCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: soshial backup <path>")
+	}
+	target := args[0]
+
+	if _, err := os.Stat(target); err == nil {
+		return fmt.Errorf("%s already exists", target)
+	}
+
+	db, err := OpenReadOnlyDatabase(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := db.Backup(target); err != nil {
+		return fmt.Errorf("backup failed: %w", err)
+	}
+
+	log.Printf("Backed up %s to %s", dbPath, target)
+	return nil
+}
+
+// runRestoreCommand implements "soshial restore <path>". The backup is checked
+// with PRAGMA integrity_check before it replaces the live database, and the
+// current database is snapshotted next to it first. The server must be
+// stopped, as running sessions keep the old file open, so restoring is
+// refused while the database is in use.
+func runRestoreCommand(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: soshial restore <path>")
+	}
+	source := args[0]
+
+	lock, err := lockDatabase(dbPath)
+	if err != nil {
+		return fmt.Errorf("stop the server before restoring: %w", err)
+	}
+	defer lock.Close()
+	if _, err := os.Stat(dbPath); err == nil {
+		if err := checkDatabaseIdle(dbPath); err != nil {
+			return err
+		}
+	}
+
+	backup, err := OpenReadOnlyDatabase(source)
+	if err != nil {
+		return err
+	}
+	if err := backup.IntegrityCheck(); err != nil {
+		backup.Close()
+		return fmt.Errorf("%s: %w", source, err)
+	}
+
+	// Copy the verified backup next to the live database so the final swap
+	// is a single atomic rename.
+	staged := dbPath + ".restore"
+	os.Remove(staged)
+	if err := backup.Backup(staged); err != nil {
+		backup.Close()
+		return fmt.Errorf("failed to stage backup: %w", err)
+	}
+	backup.Close()
+
+	if _, err := os.Stat(dbPath); err == nil {
+		current, err := OpenReadOnlyDatabase(dbPath)
+		if err != nil {
+			return err
+		}
+		previous := fmt.Sprintf("%s.pre-restore-%s", dbPath, time.Now().Format("20060102-150405"))
+		err = current.Backup(previous)
+		current.Close()
+		if err != nil {
+			return fmt.Errorf("failed to save current database: %w", err)
+		}
+		log.Printf("Saved current database to %s", previous)
+	}
+
+	if err := os.Rename(staged, dbPath); err != nil {
+		return err
+	}
+
+	log.Printf("Restored %s from %s", dbPath, source)
+	return nil
+}
+
+// checkDatabaseIdle fails if another process is using the database at path,
+// such as a backup being written from it.
+func checkDatabaseIdle(path string) error {
+	uri, err := sqliteURI(path, "mode=rw&_busy_timeout=0")
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open("sqlite3", uri)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	// Connecting already fails while another process holds a lock
+	conn, err := db.Conn(ctx)
+	if err == nil {
+		defer conn.Close()
+		_, err = conn.ExecContext(ctx, `BEGIN EXCLUSIVE`)
+	}
+	if err != nil {
+		return fmt.Errorf("%s is in use by another process: %w", path, err)
+	}
+	_, err = conn.ExecContext(ctx, `ROLLBACK`)
+	return err
+}
+
+// runBackupScheduler writes a snapshot into dir every interval and keeps only
+// the newest keep snapshots. It returns when ctx is cancelled.
+func runBackupScheduler(ctx context.Context, db *Database, dir string, interval time.Duration, keep int) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		log.Printf("Backups disabled: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			name := backupPrefix + time.Now().Format("20060102-150405") + ".db"
+			path := filepath.Join(dir, name)
+			if err := db.Backup(path); err != nil {
+				log.Printf("Scheduled backup failed: %v", err)
+				continue
+			}
+			log.Printf("Wrote backup %s", path)
+
+			if err := rotateBackups(dir, keep); err != nil {
+				log.Printf("Failed to rotate backups: %v", err)
+			}
+		}
+	}
+}
+
+// rotateBackups deletes all but the newest keep snapshots in dir. Snapshot
+// names embed their timestamp, so lexical order is chronological order.
+func rotateBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var snapshots []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, ".db") {
+			snapshots = append(snapshots, name)
+		}
+	}
+	sort.Strings(snapshots)
+
+	for len(snapshots) > keep {
+		if err := os.Remove(filepath.Join(dir, snapshots[0])); err != nil {
+			return err
+		}
+		snapshots = snapshots[1:]
+	}
+	return nil
+}
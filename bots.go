@@ -0,0 +1,253 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const defaultBotRateLimit = 2 * time.Second
+
+// botRateLimits are the choices offered when cycling a bot's rate limit.
+var botRateLimits = []time.Duration{
+	time.Second,
+	2 * time.Second,
+	5 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+// newBotID returns a random ID shaped like an SSH key fingerprint, so bots
+// can be messaged and looked up exactly like people.
+func newBotID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(b), nil
+}
+
+func (m model) openBots() (tea.Model, tea.Cmd) {
+	m.currentScreen = botSettings
+	m.selectedBot = 0
+	m.namingBot = false
+	m.newBotToken = ""
+	m.err = nil
+	m.successMsg = ""
+	return m.reloadBots()
+}
+
+func (m model) reloadBots() (tea.Model, tea.Cmd) {
+	bots, err := m.db.GetBots(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.bots = bots
+	if m.selectedBot >= len(bots) {
+		m.selectedBot = max(len(bots)-1, 0)
+	}
+	return m, nil
+}
+
+func (m model) updateBotSettings(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	if m.namingBot {
+		switch msg.String() {
+		case "esc":
+			m.namingBot = false
+			m.botNameInput.Blur()
+			m.err = nil
+			return m, nil
+
+		case "enter":
+			name := strings.TrimSpace(m.botNameInput.Value())
+			if name == "" {
+				m.err = fmt.Errorf("bot name cannot be empty")
+				return m, nil
+			}
+			id, err := newBotID()
+			if err != nil {
+				m.err = err
+				return m, nil
+			}
+			token, tokenHash, err := newPrefixedToken(botTokenPrefix)
+			if err != nil {
+				m.err = err
+				return m, nil
+			}
+			if err := m.db.CreateBot(id, m.userKey, name, tokenHash, defaultBotRateLimit); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.namingBot = false
+			m.botNameInput.Blur()
+			m.newBotToken = token
+			m.clipboardText = token
+			m.successMsg = fmt.Sprintf("Bot %q created • token copied to clipboard", name)
+			m.selectedBot = len(m.bots)
+			return m.reloadBots()
+		}
+
+		m.botNameInput, cmd = m.botNameInput.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = settingsMenu
+		m.newBotToken = ""
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keyDown):
+		if len(m.bots) > 0 {
+			m.selectedBot = (m.selectedBot + 1) % len(m.bots)
+		}
+	case m.keys.matches(msg, keyUp):
+		if len(m.bots) > 0 {
+			m.selectedBot = (m.selectedBot - 1 + len(m.bots)) % len(m.bots)
+		}
+
+	case m.keys.matches(msg, keyNew):
+		m.namingBot = true
+		m.newBotToken = ""
+		m.botNameInput.SetValue("")
+		m.err = nil
+		m.successMsg = ""
+		return m, m.botNameInput.Focus()
+
+	case m.keys.matches(msg, keyCopy):
+		if len(m.bots) > 0 {
+			m.clipboardText = m.bots[m.selectedBot].ID
+			m.successMsg = "Bot ID copied to clipboard!"
+		}
+
+	case m.keys.matches(msg, keyRateLimit):
+		if len(m.bots) == 0 {
+			return m, nil
+		}
+		bot := m.bots[m.selectedBot]
+		next := botRateLimits[0]
+		for i, limit := range botRateLimits {
+			if limit == bot.RateLimit {
+				next = botRateLimits[(i+1)%len(botRateLimits)]
+				break
+			}
+		}
+		if err := m.db.SetBotRateLimit(bot.ID, m.userKey, next); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.successMsg = fmt.Sprintf("%s may send one message every %s", bot.Name, next)
+		m.err = nil
+		return m.reloadBots()
+
+	case m.keys.matches(msg, keyNewToken):
+		if len(m.bots) == 0 {
+			return m, nil
+		}
+		bot := m.bots[m.selectedBot]
+		token, tokenHash, err := newPrefixedToken(botTokenPrefix)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		if err := m.db.SetBotToken(bot.ID, m.userKey, tokenHash); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.newBotToken = token
+		m.clipboardText = token
+		m.successMsg = fmt.Sprintf("New token for %s copied to clipboard • the old one no longer works", bot.Name)
+		m.err = nil
+
+	case m.keys.matches(msg, keyDelete):
+		if len(m.bots) == 0 {
+			return m, nil
+		}
+		bot := m.bots[m.selectedBot]
+		if err := m.db.DeleteBot(bot.ID, m.userKey); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.newBotToken = ""
+		m.successMsg = fmt.Sprintf("Bot %q deleted", bot.Name)
+		m.err = nil
+		return m.reloadBots()
+	}
+	return m, nil
+}
+
+func (m model) viewBotSettings() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("🤖  Bots")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	if m.namingBot {
+		s.WriteString(st.inputLabelStyle.Render("Name your bot"))
+		s.WriteString("\n\n")
+
+		// Error message (fixed height to keep bottom elements stable)
+		if m.err != nil {
+			s.WriteString(st.errorStyle.Render(" ✗ " + m.err.Error() + " "))
+		}
+		s.WriteString("\n\n")
+
+		input := st.inputBoxStyle.Width(m.contentWidth()).Render(m.botNameInput.View())
+		s.WriteString(input)
+		s.WriteString("\n")
+		s.WriteString(st.helpStyle.Render("Press [enter] to create • [esc] to cancel"))
+		return s.String()
+	}
+
+	if m.newBotToken != "" {
+		s.WriteString(st.inputLabelStyle.Render("Bot token (shown only once):"))
+		s.WriteString("\n")
+		s.WriteString(st.inputBoxStyle.Width(m.contentWidth()).Render(m.newBotToken))
+		s.WriteString("\n")
+	}
+
+	if len(m.bots) == 0 {
+		s.WriteString(st.emptyStateStyle.Width(m.contentWidth()).Render("No bots yet.\n\nBots send messages through the HTTP API\nwith their own token and rate limit."))
+		s.WriteString("\n")
+	} else {
+		for i, bot := range m.bots {
+			name := bot.Name
+			if len([]rune(name)) > 20 {
+				name = string([]rune(name)[:17]) + "..."
+			}
+			line := fmt.Sprintf("%-20s %s...  1 msg / %s", name, bot.ID[:12], bot.RateLimit)
+			badge := " " + st.botBadgeStyle.Render(" BOT ")
+			if i == m.selectedBot {
+				indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+				s.WriteString("  " + indicator + m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Render(line) + badge)
+			} else {
+				s.WriteString("    " + m.renderer.NewStyle().Foreground(st.textColor).Render(line) + badge)
+			}
+			s.WriteString("\n")
+		}
+	}
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.Width(m.contentWidth()).Render(m.keyHint(keyNew, "to create") + " • " + m.keyHint(keyRateLimit, "to change rate limit") + " • " + m.keyHint(keyNewToken, "for a new token") + " • " + m.keyHint(keyCopy, "to copy ID") + " • " + m.keyHint(keyDelete, "to delete") + " • " + m.keyHint(keyBack, "to return")))
+
+	return s.String()
+}
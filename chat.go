@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	chatHistoryLimit = 200
+	chatRateLimit    = time.Second
+
+	// Typing notices are sent at most this often, and shown for twice as
+	// long so the indicator doesn't flicker while someone types.
+	chatTypingInterval = 2 * time.Second
+	chatTypingTimeout  = 2 * chatTypingInterval
+)
+
+// chatMessageMsg delivers a chat message into the recipient's sessions.
+type chatMessageMsg struct{ msg Message }
+
+// chatTypingMsg tells the recipient that from is typing to them.
+type chatTypingMsg struct{ from string }
+
+// chatTypingExpiredMsg re-renders the chat once a typing notice is stale.
+type chatTypingExpiredMsg struct{}
+
+// openChat starts a live chat with peer, who must be connected.
+func (m model) openChat(peer string) (tea.Model, tea.Cmd) {
+	if peer == m.userKey {
+		return m, nil
+	}
+	if m.presence.Status(peer) == "" {
+		m.err = fmt.Errorf("they are not online • send them a message instead")
+		return m, nil
+	}
+
+	profile, err := m.db.GetProfile(peer)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	history, err := m.db.GetConversation(m.userKey, peer, chatHistoryLimit)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	for i, msg := range history {
+		if msg.ToKey == m.userKey && !msg.Read {
+			if err := m.db.MarkMessageAsRead(msg.ID); err != nil {
+				m.err = err
+				return m, nil
+			}
+			history[i].Read = true
+			go m.webhookSender.Emit(eventMessageRead, msg.FromKey, history[i])
+		}
+	}
+
+	m.chatPeer = peer
+	m.chatPeerName = profile.DisplayName
+	if m.chatPeerName == "" {
+		m.chatPeerName = peer[:min(12, len(peer))] + "..."
+	}
+	m.chatPeerOnline = true
+	m.chatHistory = history
+	m.chatPeerTypingAt = time.Time{}
+	m.chatTypingSentAt = time.Time{}
+	if m.pendingChatFrom == peer {
+		m.pendingChatFrom = ""
+	}
+	if m.currentScreen != chatScreen {
+		m.chatReturnScreen = m.currentScreen
+	}
+	m.currentScreen = chatScreen
+	m.chatInput.SetValue("")
+	m.err = nil
+	m.successMsg = ""
+	m.resizeChat()
+	return m, tea.Batch(m.chatInput.Focus(), m.updateWindowTitle())
+}
+
+// resizeChat fits the history pane between the header and the input,
+// using the terminal height when it is known.
+func (m *model) resizeChat() {
+	height := 12
+	if m.height > 0 {
+		// Title, status line, input box and help take about 14 lines
+		height = max(m.height-14, 5)
+	}
+	m.chatViewport.Width = m.bodyWidth()
+	m.chatViewport.Height = height
+	m.chatViewport.SetContent(m.renderChatHistory())
+	m.chatViewport.GotoBottom()
+}
+
+func (m model) renderChatHistory() string {
+	st := m.getStyles()
+	if len(m.chatHistory) == 0 {
+		return m.renderer.NewStyle().Foreground(st.mutedColor).Italic(true).Render("Say hello! Messages are also saved to their inbox.")
+	}
+
+	timeStyle := m.renderer.NewStyle().Foreground(st.mutedColor)
+	ownStyle := m.renderer.NewStyle().Foreground(st.accentColor).Bold(true)
+	peerStyle := m.renderer.NewStyle().Foreground(st.secondaryColor).Bold(true)
+	textStyle := m.renderer.NewStyle().Foreground(st.textColor)
+
+	var s strings.Builder
+	for i, msg := range m.chatHistory {
+		name := peerStyle.Render(m.chatPeerName)
+		if msg.FromKey == m.userKey {
+			name = ownStyle.Render("you")
+		}
+		prefix := timeStyle.Render(m.formatTime(msg.Timestamp, timeClock)) + " " + name + " "
+		text := textStyle.Render(msg.Message)
+		if !msg.EditedAt.IsZero() {
+			text += " " + timeStyle.Italic(true).Render("(edited)")
+		}
+		body := m.renderer.NewStyle().Width(m.chatViewport.Width - lipgloss.Width(prefix)).Render(text)
+		s.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, prefix, body))
+		if i < len(m.chatHistory)-1 {
+			s.WriteString("\n")
+		}
+	}
+	return s.String()
+}
+
+func (m model) updateChat(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg.String() {
+	case "esc":
+		m.currentScreen = m.chatReturnScreen
+		m.chatPeer = ""
+		m.chatHistory = nil
+		m.chatInput.Blur()
+		m.err = nil
+		if m.currentScreen == whosOnline {
+			return m.reloadWhosOnline()
+		}
+		return m, nil
+
+	case "pgup":
+		m.chatViewport.PageUp()
+		return m, nil
+	case "pgdown":
+		m.chatViewport.PageDown()
+		return m, nil
+
+	case "enter":
+		text := strings.TrimSpace(m.chatInput.Value())
+		if text == "" {
+			return m, nil
+		}
+		key := "chat:" + m.userKey
+		if !m.rateLimiter.CanSendMessageEvery(key, chatRateLimit) {
+			m.err = fmt.Errorf("slow down a little")
+			return m, nil
+		}
+
+		sent, err := m.db.SendMessage(m.userKey, m.chatPeer, text)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.rateLimiter.RecordMessage(key)
+		go m.webhookSender.Emit(eventMessageReceived, m.chatPeer, sent)
+
+		// Deliver live if they are still here; otherwise it simply waits
+		// in their inbox like any other message
+		m.chatPeerOnline = m.presence.Send(m.chatPeer, chatMessageMsg{sent})
+
+		m.chatHistory = append(m.chatHistory, sent)
+		m.chatViewport.SetContent(m.renderChatHistory())
+		m.chatViewport.GotoBottom()
+		m.chatInput.SetValue("")
+		m.chatTypingSentAt = time.Time{}
+		m.err = nil
+		return m, nil
+	}
+
+	before := m.chatInput.Value()
+	m.chatInput, cmd = m.chatInput.Update(msg)
+	if m.chatInput.Value() != before && time.Since(m.chatTypingSentAt) > chatTypingInterval {
+		m.chatTypingSentAt = time.Now()
+		m.presence.Send(m.chatPeer, chatTypingMsg{from: m.userKey})
+	}
+	return m, cmd
+}
+
+// handleChatMessage shows an incoming chat message, either in the open chat
+// with its sender or as a prompt to join.
+func (m model) handleChatMessage(msg Message) (tea.Model, tea.Cmd) {
+	if m.currentScreen == chatScreen && m.chatPeer == msg.FromKey {
+		if err := m.db.MarkMessageAsRead(msg.ID); err != nil {
+			m.err = err
+			return m, nil
+		}
+		msg.Read = true
+		go m.webhookSender.Emit(eventMessageRead, msg.FromKey, msg)
+
+		m.chatHistory = append(m.chatHistory, msg)
+		m.chatPeerTypingAt = time.Time{}
+		m.chatPeerOnline = true
+		atBottom := m.chatViewport.AtBottom()
+		m.chatViewport.SetContent(m.renderChatHistory())
+		if atBottom {
+			m.chatViewport.GotoBottom()
+		}
+		return m, m.updateWindowTitle()
+	}
+
+	// It is already in their inbox, so this is only a nudge to join
+	m.pendingChatFrom = msg.FromKey
+	if m.currentScreen == mainMenu {
+		name := msg.FromKey[:min(12, len(msg.FromKey))] + "..."
+		if profile, err := m.db.GetProfile(msg.FromKey); err == nil && profile.DisplayName != "" {
+			name = profile.DisplayName
+		}
+		m.successMsg = name + " is chatting with you • press " + m.keys.hint(keyJoinChat) + " to join"
+		m.err = nil
+	}
+	return m.handleNewMail(msg)
+}
+
+func (m model) handleChatTyping(from string) (tea.Model, tea.Cmd) {
+	if m.currentScreen != chatScreen || m.chatPeer != from {
+		return m, nil
+	}
+	m.chatPeerTypingAt = time.Now()
+	return m, tea.Tick(chatTypingTimeout, func(time.Time) tea.Msg {
+		return chatTypingExpiredMsg{}
+	})
+}
+
+func (m model) viewChat() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("💬  Chat with " + m.chatPeerName)
+	s.WriteString(title)
+	s.WriteString("\n")
+
+	// Peer status
+	var status string
+	switch {
+	case !m.chatPeerOnline:
+		status = m.renderer.NewStyle().Foreground(st.highlight).Render("○ offline • new messages go to their inbox")
+	case time.Since(m.chatPeerTypingAt) < chatTypingTimeout:
+		status = m.renderer.NewStyle().Foreground(st.accentColor).Italic(true).Render("● typing…")
+	default:
+		status = m.renderer.NewStyle().Foreground(st.successColor).Render("● online")
+	}
+	s.WriteString("  " + status)
+	s.WriteString("\n")
+
+	// History pane
+	history := m.renderer.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(st.mutedColor).
+		Padding(0, 1).
+		Width(m.contentWidth()).
+		Render(m.chatViewport.View())
+	s.WriteString(history)
+	s.WriteString("\n")
+
+	// Error message
+	if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	// Input
+	input := m.renderer.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(st.primaryColor).
+		Padding(0, 1).
+		Width(m.contentWidth()).
+		Render(m.chatInput.View())
+	s.WriteString(input)
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.MarginTop(0).Render("enter to send • pgup/pgdown to scroll • esc to leave"))
+
+	return s.String()
+}
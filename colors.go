@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/muesli/termenv"
+)
+
+const (
+	colorProfileAuto      = "auto"
+	colorProfileTrueColor = "truecolor"
+	colorProfileANSI256   = "256"
+	colorProfileANSI      = "16"
+	colorProfileNone      = "none"
+)
+
+var colorProfileChoices = []preferenceChoice{
+	{colorProfileAuto, "Automatic"},
+	{colorProfileTrueColor, "TrueColor"},
+	{colorProfileANSI256, "256 colors"},
+	{colorProfileANSI, "16 colors"},
+	{colorProfileNone, "No color"},
+}
+
+// colorProfiles are the profiles users can choose instead of the detected
+// one.
+var colorProfiles = map[string]termenv.Profile{
+	colorProfileTrueColor: termenv.TrueColor,
+	colorProfileANSI256:   termenv.ANSI256,
+	colorProfileANSI:      termenv.ANSI,
+	colorProfileNone:      termenv.Ascii,
+}
+
+// Terminals that support 24-bit color without saying so in COLORTERM
+var trueColorTerms = []string{"xterm-kitty", "xterm-ghostty", "wezterm", "alacritty", "foot", "contour", "iterm2"}
+
+// detectColorProfile works out how many colors the client's terminal can
+// show from the TERM it requested the pty with and the environment it sent.
+// Clients only send COLORTERM and NO_COLOR if configured to, for example
+// with SendEnv in OpenSSH.
+func detectColorProfile(term string, environ []string) termenv.Profile {
+	env := make(map[string]string)
+	for _, kv := range environ {
+		if key, value, ok := strings.Cut(kv, "="); ok {
+			env[key] = value
+		}
+	}
+
+	// https://no-color.org asks for no color whenever NO_COLOR is set and
+	// not empty
+	if env["NO_COLOR"] != "" {
+		return termenv.Ascii
+	}
+
+	switch strings.ToLower(env["COLORTERM"]) {
+	case "truecolor", "24bit":
+		return termenv.TrueColor
+	}
+
+	term = strings.ToLower(term)
+	switch {
+	case term == "" || term == "dumb":
+		return termenv.Ascii
+	case strings.HasSuffix(term, "-direct") || strings.Contains(term, "truecolor") || strings.Contains(term, "24bit"):
+		return termenv.TrueColor
+	case strings.Contains(term, "256color"):
+		return termenv.ANSI256
+	}
+	for _, prefix := range trueColorTerms {
+		if strings.HasPrefix(term, prefix) {
+			return termenv.TrueColor
+		}
+	}
+	return termenv.ANSI
+}
+
+// colorProfileLabel names p the way the preferences screen does.
+func colorProfileLabel(p termenv.Profile) string {
+	for value, profile := range colorProfiles {
+		if profile == p {
+			return choiceLabel(colorProfileChoices, value)
+		}
+	}
+	return p.Name()
+}
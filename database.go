@@ -2,24 +2,193 @@ package main
 
 import (
 	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
+	"unicode"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type User struct {
+	SSHKeyFingerprint string    `json:"fingerprint"`
+	FirstSeen         time.Time `json:"first_seen"`
+	LastSeen          time.Time `json:"last_seen"`
+}
+
+// Profile is what a user chooses to tell others about themselves. Users
+// without a saved profile get the zero value with ShowLastSeen set.
+type Profile struct {
 	SSHKeyFingerprint string
-	FirstSeen         time.Time
-	LastSeen          time.Time
+	DisplayName       string
+	Pronouns          string
+	Status            string
+	Bio               string
+	Link              string
+	ShowLastSeen      bool
 }
 
 type Message struct {
+	ID        int64     `json:"id"`
+	FromKey   string    `json:"from"`
+	ToKey     string    `json:"to"`
+	Message   string    `json:"message"`
+	Timestamp time.Time `json:"timestamp"`
+	Read      bool      `json:"read"`
+	GroupID   int64     `json:"group_id,omitempty"` // Set when sent to a group
+	EditedAt  time.Time `json:"edited_at,omitzero"` // Set once the sender changes it
+}
+
+// stripControl removes control characters other than newlines and tabs
+// from text that arrives from outside the TUI, so it can't carry terminal
+// escape sequences into the sessions that show it.
+func stripControl(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Map(func(r rune) rune {
+		if r != '\n' && r != '\t' && unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Group is a named distribution list. Role and Pending describe the
+// membership of the user the group was loaded for.
+type Group struct {
+	ID          int64
+	Name        string
+	CreatedAt   time.Time
+	MemberCount int
+	Role        string
+	Pending     bool
+}
+
+// GroupMember is one member of a group. Pending members have been invited
+// but have not accepted yet, and do not receive group messages.
+type GroupMember struct {
+	GroupID   int64
+	MemberKey string
+	Role      string
+	Pending   bool
+	JoinedAt  time.Time
+}
+
+// EmailSettings holds a user's registered email address and how often they
+// want to hear about unread messages.
+type EmailSettings struct {
+	SSHKeyFingerprint string
+	Email             string
+	Verified          bool
+	Frequency         string
+	LastNotified      time.Time
+}
+
+// AlertSettings controls how a connected session announces new mail: a
+// terminal bell, a desktop notification escape sequence and an unread count
+// in the window title.
+type AlertSettings struct {
+	SSHKeyFingerprint string
+	Bell              bool
+	Desktop           string // alertDesktopOff, alertDesktopOSC9 or alertDesktopOSC777
+	WindowTitle       bool
+}
+
+// UserSettings holds a user's preferences, which apply to all their
+// sessions.
+type UserSettings struct {
+	SSHKeyFingerprint string
+	Theme             string
+	AlertScope        string // alertScopeAll or alertScopeDirect
+	TimestampFormat   string // timestampFormat24h, timestampFormat12h or timestampFormatISO
+	Timezone          string // IANA name, or "" for the session's or server's time zone
+	RelativeTimes     bool   // Recent times as "5m ago"
+	ComposeMode       string // composeModeMultiline or composeModeQuick
+	KeyPreset         string // keyPresetDefault, keyPresetVim or keyPresetEmacs
+	ColorProfile      string // colorProfileAuto, or a profile that overrides detection
+}
+
+// Webhook is a URL that receives signed event notifications. Webhooks
+// without an owner are global and receive every event.
+type Webhook struct {
+	ID        int64
+	OwnerKey  string
+	URL       string
+	Secret    string
+	Events    string // Comma separated event names, or "*" for all
+	CreatedAt time.Time
+}
+
+// WebhookDelivery records one attempt to deliver an event to a webhook.
+type WebhookDelivery struct {
+	ID          int64
+	WebhookID   int64
+	Event       string
+	Attempt     int
+	StatusCode  int
+	Error       string
+	DeliveredAt time.Time
+}
+
+// APIToken is a credential for the HTTP API. Only a hash of the token is
+// stored; the token itself is shown once when it is created.
+type APIToken struct {
+	ID                int64
+	SSHKeyFingerprint string
+	Name              string
+	Scope             string
+	CreatedAt         time.Time
+	LastUsedAt        time.Time
+}
+
+// Bot is a non-human user owned by a person. It sends through the HTTP API
+// with its own token and has an ID shaped like a key fingerprint.
+type Bot struct {
+	ID        string
+	OwnerKey  string
+	Name      string
+	RateLimit time.Duration
+	CreatedAt time.Time
+}
+
+// Post is a public timeline post. Likes and LikedByMe are relative to the
+// user the timeline was loaded for.
+type Post struct {
+	ID        int64
+	AuthorKey string
+	Body      string
+	CreatedAt time.Time
+	Likes     int
+	LikedByMe bool
+}
+
+// Draft is a message the user started writing but has not sent. Recipient
+// is a fingerprint, or a group name prefixed with "#". Interrupted drafts
+// were being written when the user's connection dropped.
+type Draft struct {
+	ID                int64
+	SSHKeyFingerprint string
+	Recipient         string
+	Body              string
+	Interrupted       bool
+	UpdatedAt         time.Time
+}
+
+// ScheduledMessage is a message waiting to be sent at SendAt. Recipient is a
+// fingerprint, or a group name prefixed with "#" when GroupID is set. Error
+// explains why sending it failed, if it did.
+type ScheduledMessage struct {
 	ID        int64
 	FromKey   string
-	ToKey     string
-	Message   string
-	Timestamp time.Time
-	Read      bool
+	Recipient string
+	GroupID   int64
+	Body      string
+	SendAt    time.Time
+	CreatedAt time.Time
+	Error     string
 }
 
 type Database struct {
@@ -44,8 +213,48 @@ func NewDatabase(dbPath string) (*Database, error) {
 	return database, nil
 }
 
+// OpenReadOnlyDatabase opens an existing database without creating or
+// migrating anything, for maintenance commands that only read from it.
+func OpenReadOnlyDatabase(path string) (*Database, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	uri, err := sqliteURI(path, "mode=ro")
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", uri)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Database{db: db}, nil
+}
+
+// sqliteURI turns a file path into an SQLite URI with query, escaping
+// characters such as "?" and "#" that would otherwise end the path.
+func sqliteURI(path, query string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	p := filepath.ToSlash(abs)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p // Windows drive letters
+	}
+	return (&url.URL{Scheme: "file", Path: p, RawQuery: query}).String(), nil
+}
+
 func (d *Database) initSchema() error {
 	schema := `
+	CREATE TABLE IF NOT EXISTS schema_version (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		version INTEGER NOT NULL
+	);
+
 	CREATE TABLE IF NOT EXISTS users (
 		ssh_key_fingerprint TEXT PRIMARY KEY,
 		first_seen DATETIME NOT NULL,
@@ -65,14 +274,363 @@ func (d *Database) initSchema() error {
 
 	CREATE INDEX IF NOT EXISTS idx_messages_to_key ON messages(to_key);
 	CREATE INDEX IF NOT EXISTS idx_messages_from_key ON messages(from_key);
+
+	CREATE TABLE IF NOT EXISTS profiles (
+		ssh_key_fingerprint TEXT PRIMARY KEY,
+		display_name TEXT NOT NULL DEFAULT '',
+		pronouns TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL DEFAULT '',
+		bio TEXT NOT NULL DEFAULT '',
+		link TEXT NOT NULL DEFAULT '',
+		show_last_seen BOOLEAN DEFAULT 1,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (ssh_key_fingerprint) REFERENCES users(ssh_key_fingerprint)
+	);
+
+	CREATE TABLE IF NOT EXISTS email_notifications (
+		ssh_key_fingerprint TEXT PRIMARY KEY,
+		email TEXT NOT NULL,
+		verified BOOLEAN DEFAULT 0,
+		verification_code TEXT,
+		code_expires DATETIME,
+		frequency TEXT NOT NULL DEFAULT 'daily',
+		last_notified DATETIME,
+		FOREIGN KEY (ssh_key_fingerprint) REFERENCES users(ssh_key_fingerprint)
+	);
+
+	CREATE TABLE IF NOT EXISTS alert_settings (
+		ssh_key_fingerprint TEXT PRIMARY KEY,
+		bell BOOLEAN DEFAULT 0,
+		desktop TEXT NOT NULL DEFAULT 'off',
+		window_title BOOLEAN DEFAULT 0,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (ssh_key_fingerprint) REFERENCES users(ssh_key_fingerprint)
+	);
+
+	CREATE TABLE IF NOT EXISTS user_settings (
+		ssh_key_fingerprint TEXT PRIMARY KEY,
+		theme TEXT NOT NULL DEFAULT 'gruvbox',
+		alert_scope TEXT NOT NULL DEFAULT 'all',
+		timestamp_format TEXT NOT NULL DEFAULT '24h',
+		timezone TEXT NOT NULL DEFAULT '',
+		compose_mode TEXT NOT NULL DEFAULT 'multiline',
+		key_preset TEXT NOT NULL DEFAULT 'default',
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (ssh_key_fingerprint) REFERENCES users(ssh_key_fingerprint)
+	);
+
+	CREATE TABLE IF NOT EXISTS key_bindings (
+		ssh_key_fingerprint TEXT NOT NULL,
+		action TEXT NOT NULL,
+		key TEXT NOT NULL,
+		PRIMARY KEY (ssh_key_fingerprint, action, key),
+		FOREIGN KEY (ssh_key_fingerprint) REFERENCES users(ssh_key_fingerprint)
+	);
+
+	CREATE TABLE IF NOT EXISTS webhooks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		owner_key TEXT,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '*',
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY (owner_key) REFERENCES users(ssh_key_fingerprint)
+	);
+
+	CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		attempt INTEGER NOT NULL,
+		status_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		delivered_at DATETIME NOT NULL,
+		FOREIGN KEY (webhook_id) REFERENCES webhooks(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ssh_key_fingerprint TEXT NOT NULL,
+		name TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		scope TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		last_used_at DATETIME,
+		FOREIGN KEY (ssh_key_fingerprint) REFERENCES users(ssh_key_fingerprint)
+	);
+
+	CREATE TABLE IF NOT EXISTS bots (
+		id TEXT PRIMARY KEY,
+		owner_key TEXT NOT NULL,
+		name TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		rate_limit_seconds INTEGER NOT NULL,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY (id) REFERENCES users(ssh_key_fingerprint),
+		FOREIGN KEY (owner_key) REFERENCES users(ssh_key_fingerprint)
+	);
+
+	CREATE TABLE IF NOT EXISTS message_groups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		created_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS group_members (
+		group_id INTEGER NOT NULL,
+		member_key TEXT NOT NULL,
+		role TEXT NOT NULL,
+		pending BOOLEAN DEFAULT 0,
+		joined_at DATETIME NOT NULL,
+		PRIMARY KEY (group_id, member_key),
+		FOREIGN KEY (group_id) REFERENCES message_groups(id),
+		FOREIGN KEY (member_key) REFERENCES users(ssh_key_fingerprint)
+	);
+
+	CREATE TABLE IF NOT EXISTS posts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		author_key TEXT NOT NULL,
+		body TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY (author_key) REFERENCES users(ssh_key_fingerprint)
+	);
+
+	CREATE TABLE IF NOT EXISTS post_likes (
+		post_id INTEGER NOT NULL,
+		liker_key TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (post_id, liker_key),
+		FOREIGN KEY (post_id) REFERENCES posts(id),
+		FOREIGN KEY (liker_key) REFERENCES users(ssh_key_fingerprint)
+	);
+
+	CREATE TABLE IF NOT EXISTS follows (
+		follower_key TEXT NOT NULL,
+		followee_key TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (follower_key, followee_key),
+		FOREIGN KEY (follower_key) REFERENCES users(ssh_key_fingerprint),
+		FOREIGN KEY (followee_key) REFERENCES users(ssh_key_fingerprint)
+	);
+
+	CREATE TABLE IF NOT EXISTS drafts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ssh_key_fingerprint TEXT NOT NULL,
+		recipient TEXT NOT NULL,
+		body TEXT NOT NULL,
+		interrupted BOOLEAN NOT NULL DEFAULT 0,
+		updated_at DATETIME NOT NULL,
+		FOREIGN KEY (ssh_key_fingerprint) REFERENCES users(ssh_key_fingerprint)
+	);
+
+	CREATE TABLE IF NOT EXISTS scheduled_messages (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		from_key TEXT NOT NULL,
+		recipient TEXT NOT NULL,
+		group_id INTEGER,
+		body TEXT NOT NULL,
+		send_at DATETIME NOT NULL,
+		created_at DATETIME NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (from_key) REFERENCES users(ssh_key_fingerprint),
+		FOREIGN KEY (group_id) REFERENCES message_groups(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS message_edits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id INTEGER NOT NULL,
+		previous_message TEXT NOT NULL,
+		edited_at DATETIME NOT NULL,
+		FOREIGN KEY (message_id) REFERENCES messages(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhooks_owner_key ON webhooks(owner_key);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook_id ON webhook_deliveries(webhook_id);
+	CREATE INDEX IF NOT EXISTS idx_api_tokens_fingerprint ON api_tokens(ssh_key_fingerprint);
+	CREATE INDEX IF NOT EXISTS idx_bots_owner_key ON bots(owner_key);
+	CREATE INDEX IF NOT EXISTS idx_group_members_member_key ON group_members(member_key);
+	CREATE INDEX IF NOT EXISTS idx_posts_author_key ON posts(author_key);
+	CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts(created_at);
+	CREATE INDEX IF NOT EXISTS idx_drafts_fingerprint ON drafts(ssh_key_fingerprint);
+	CREATE INDEX IF NOT EXISTS idx_scheduled_messages_from_key ON scheduled_messages(from_key);
+	CREATE INDEX IF NOT EXISTS idx_scheduled_messages_send_at ON scheduled_messages(send_at);
+	CREATE INDEX IF NOT EXISTS idx_message_edits_message_id ON message_edits(message_id);
 	`
 
-	_, err := d.db.Exec(schema)
+	if _, err := d.db.Exec(schema); err != nil {
+		return err
+	}
+
+	// Columns added after the original tables were created
+	if err := d.addColumn("messages", "group_id", "INTEGER REFERENCES message_groups(id)"); err != nil {
+		return err
+	}
+	if err := d.addColumn("user_settings", "color_profile", "TEXT NOT NULL DEFAULT 'auto'"); err != nil {
+		return err
+	}
+	if err := d.addColumn("user_settings", "relative_times", "BOOLEAN NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := d.addColumn("messages", "edited_at", "DATETIME"); err != nil {
+		return err
+	}
+	if err := d.addColumn("email_notifications", "code_attempts", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	return d.migrate()
+}
+
+// migrations rewrite existing rows, once each and in order. A database's
+// schema version is how many of them it has had.
+var migrations = []func(*Database) error{
+	(*Database).normalizeTimestamps,
+}
+
+// migrate runs the migrations a database hasn't had yet.
+func (d *Database) migrate() error {
+	var version int
+	err := d.db.QueryRow(`SELECT version FROM schema_version WHERE id = 1`).Scan(&version)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		if err := migrations[version](d); err != nil {
+			return err
+		}
+		_, err := d.db.Exec(`
+			INSERT INTO schema_version (id, version) VALUES (1, ?)
+			ON CONFLICT(id) DO UPDATE SET version = excluded.version
+		`, version+1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timestampColumns lists every column that holds a time, by table.
+var timestampColumns = map[string][]string{
+	"users":               {"first_seen", "last_seen"},
+	"messages":            {"timestamp", "edited_at"},
+	"profiles":            {"updated_at"},
+	"email_notifications": {"code_expires", "last_notified"},
+	"alert_settings":      {"updated_at"},
+	"user_settings":       {"updated_at"},
+	"webhooks":            {"created_at"},
+	"webhook_deliveries":  {"delivered_at"},
+	"api_tokens":          {"created_at", "last_used_at"},
+	"bots":                {"created_at"},
+	"message_groups":      {"created_at"},
+	"group_members":       {"joined_at"},
+	"posts":               {"created_at"},
+	"post_likes":          {"created_at"},
+	"follows":             {"created_at"},
+	"drafts":              {"updated_at"},
+	"scheduled_messages":  {"send_at", "created_at"},
+	"message_edits":       {"edited_at"},
+}
+
+// utcNow is the time every new timestamp gets. Times are stored in UTC so
+// that they compare and sort correctly as text whatever the server's zone.
+func utcNow() time.Time {
+	return time.Now().UTC()
+}
+
+// normalizeTimestamps converts times that older versions stored in the
+// server's zone to UTC.
+func (d *Database) normalizeTimestamps() error {
+	for table, columns := range timestampColumns {
+		for _, column := range columns {
+			if err := d.normalizeColumn(table, column); err != nil {
+				return fmt.Errorf("converting %s.%s to UTC: %w", table, column, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *Database) normalizeColumn(table, column string) error {
+	rows, err := d.db.Query(fmt.Sprintf(`
+		SELECT rowid, %[2]s FROM %[1]s
+		WHERE %[2]s IS NOT NULL AND %[2]s NOT LIKE '%%Z' AND %[2]s NOT LIKE '%%+00:00'
+	`, table, column))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	converted := make(map[int64]time.Time)
+	for rows.Next() {
+		var rowID int64
+		var t time.Time
+		if err := rows.Scan(&rowID, &t); err != nil {
+			return err
+		}
+		converted[rowID] = t.UTC()
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for rowID, t := range converted {
+		if _, err := d.db.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE rowid = ?`, table, column), t, rowID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addColumn adds a column to an existing table unless it is already there,
+// so databases created by older versions pick up new columns.
+func (d *Database) addColumn(table, column, definition string) error {
+	rows, err := d.db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = d.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, column, definition))
 	return err
 }
 
+// messageColumns lists the message columns in the order scanMessage reads
+// them.
+const messageColumns = "id, from_key, to_key, message, timestamp, read, group_id, edited_at"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMessage(row rowScanner) (Message, error) {
+	var msg Message
+	var groupID sql.NullInt64
+	var editedAt sql.NullTime
+	err := row.Scan(&msg.ID, &msg.FromKey, &msg.ToKey, &msg.Message, &msg.Timestamp, &msg.Read, &groupID, &editedAt)
+	msg.GroupID = groupID.Int64
+	msg.EditedAt = editedAt.Time
+	return msg, err
+}
+
 func (d *Database) UpsertUser(fingerprint string) error {
-	now := time.Now()
+	now := utcNow()
 
 	_, err := d.db.Exec(`
 		INSERT INTO users (ssh_key_fingerprint, first_seen, last_seen)
@@ -83,9 +641,84 @@ func (d *Database) UpsertUser(fingerprint string) error {
 	return err
 }
 
+// UserExists reports whether a user with the fingerprint has ever connected.
+func (d *Database) UserExists(fingerprint string) (bool, error) {
+	var exists bool
+	err := d.db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM users WHERE ssh_key_fingerprint = ?)
+	`, fingerprint).Scan(&exists)
+	return exists, err
+}
+
+// GetUser returns the user with the fingerprint, or nil if they have never
+// connected.
+func (d *Database) GetUser(fingerprint string) (*User, error) {
+	var user User
+	err := d.db.QueryRow(`
+		SELECT ssh_key_fingerprint, first_seen, last_seen
+		FROM users
+		WHERE ssh_key_fingerprint = ?
+	`, fingerprint).Scan(&user.SSHKeyFingerprint, &user.FirstSeen, &user.LastSeen)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetProfile returns the user's profile, or the default profile if they
+// have never edited it.
+func (d *Database) GetProfile(fingerprint string) (Profile, error) {
+	profile := Profile{SSHKeyFingerprint: fingerprint, ShowLastSeen: true}
+	err := d.db.QueryRow(`
+		SELECT display_name, pronouns, status, bio, link, show_last_seen
+		FROM profiles
+		WHERE ssh_key_fingerprint = ?
+	`, fingerprint).Scan(&profile.DisplayName, &profile.Pronouns, &profile.Status, &profile.Bio, &profile.Link, &profile.ShowLastSeen)
+	if err == sql.ErrNoRows {
+		return profile, nil
+	}
+	return profile, err
+}
+
+func (d *Database) SaveProfile(profile Profile) error {
+	_, err := d.db.Exec(`
+		INSERT INTO profiles (ssh_key_fingerprint, display_name, pronouns, status, bio, link, show_last_seen, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(ssh_key_fingerprint) DO UPDATE SET
+			display_name = excluded.display_name,
+			pronouns = excluded.pronouns,
+			status = excluded.status,
+			bio = excluded.bio,
+			link = excluded.link,
+			show_last_seen = excluded.show_last_seen,
+			updated_at = excluded.updated_at
+	`, profile.SSHKeyFingerprint, profile.DisplayName, profile.Pronouns, profile.Status, profile.Bio, profile.Link, profile.ShowLastSeen, utcNow())
+
+	return err
+}
+
+// GetMessage returns a single message, or nil if it doesn't exist.
+func (d *Database) GetMessage(messageID int64) (*Message, error) {
+	msg, err := scanMessage(d.db.QueryRow(`
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE id = ?
+	`, messageID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
 func (d *Database) GetMessagesForUser(fingerprint string) ([]Message, error) {
 	rows, err := d.db.Query(`
-		SELECT id, from_key, to_key, message, timestamp, read
+		SELECT `+messageColumns+`
 		FROM messages
 		WHERE to_key = ?
 		ORDER BY timestamp DESC
@@ -97,8 +730,8 @@ func (d *Database) GetMessagesForUser(fingerprint string) ([]Message, error) {
 
 	var messages []Message
 	for rows.Next() {
-		var msg Message
-		if err := rows.Scan(&msg.ID, &msg.FromKey, &msg.ToKey, &msg.Message, &msg.Timestamp, &msg.Read); err != nil {
+		msg, err := scanMessage(rows)
+		if err != nil {
 			return nil, err
 		}
 		messages = append(messages, msg)
@@ -107,29 +740,1623 @@ func (d *Database) GetMessagesForUser(fingerprint string) ([]Message, error) {
 	return messages, rows.Err()
 }
 
-func (d *Database) SendMessage(fromKey, toKey, message string) error {
-	_, err := d.db.Exec(`
-		INSERT INTO messages (from_key, to_key, message, timestamp, read)
-		VALUES (?, ?, ?, ?, 0)
-	`, fromKey, toKey, message, time.Now())
+// GetAllMessagesForUser returns every message the user has sent or received,
+// oldest first.
+func (d *Database) GetAllMessagesForUser(fingerprint string) ([]Message, error) {
+	rows, err := d.db.Query(`
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE to_key = ? OR from_key = ?
+		ORDER BY timestamp ASC
+	`, fingerprint, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	return err
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
 }
 
-func (d *Database) MarkMessageAsRead(messageID int64) error {
-	_, err := d.db.Exec(`
-		UPDATE messages SET read = 1 WHERE id = ?
-	`, messageID)
+// GetConversation returns the most recent direct messages exchanged between
+// two users in either direction, oldest first.
+func (d *Database) GetConversation(userKey, peerKey string, limit int) ([]Message, error) {
+	rows, err := d.db.Query(`
+		SELECT * FROM (
+			SELECT `+messageColumns+`
+			FROM messages
+			WHERE ((from_key = ? AND to_key = ?) OR (from_key = ? AND to_key = ?))
+				AND group_id IS NULL
+			ORDER BY timestamp DESC, id DESC
+			LIMIT ?
+		) ORDER BY timestamp ASC, id ASC
+	`, userKey, peerKey, peerKey, userKey, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	return err
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
 }
 
-func (d *Database) DeleteMessage(messageID int64) error {
-	_, err := d.db.Exec(`
-		DELETE FROM messages WHERE id = ?
-	`, messageID)
+// ImportMessages inserts previously exported messages received by toKey,
+// keeping their original timestamps, read state and edit time. Group IDs are
+// dropped, since they name rows of the database the messages came from.
+// Messages sent to anyone else are skipped, so an import can't put messages
+// in other users' inboxes, as are messages that already exist. It returns the
+// number of messages actually inserted.
+func (d *Database) ImportMessages(toKey string, messages []Message) (int, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
-	return err
+	imported := 0
+	for _, msg := range messages {
+		if msg.ToKey != toKey {
+			continue
+		}
+		msg.Timestamp = msg.Timestamp.UTC()
+		msg.Message = stripControl(msg.Message)
+
+		var exists bool
+		if err := tx.QueryRow(`
+			SELECT EXISTS(
+				SELECT 1 FROM messages
+				WHERE from_key = ? AND to_key = ? AND message = ? AND timestamp = ?
+			)
+		`, msg.FromKey, msg.ToKey, msg.Message, msg.Timestamp).Scan(&exists); err != nil {
+			return 0, err
+		}
+		if exists {
+			continue
+		}
+
+		var editedAt sql.NullTime
+		if !msg.EditedAt.IsZero() {
+			editedAt = sql.NullTime{Time: msg.EditedAt.UTC(), Valid: true}
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO messages (from_key, to_key, message, timestamp, read, edited_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, msg.FromKey, msg.ToKey, msg.Message, msg.Timestamp, msg.Read, editedAt); err != nil {
+			return 0, err
+		}
+		imported++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return imported, nil
+}
+
+// SendMessage stores a new unread message and returns it.
+func (d *Database) SendMessage(fromKey, toKey, message string) (Message, error) {
+	msg := Message{FromKey: fromKey, ToKey: toKey, Message: message, Timestamp: utcNow()}
+	result, err := d.db.Exec(`
+		INSERT INTO messages (from_key, to_key, message, timestamp, read)
+		VALUES (?, ?, ?, ?, 0)
+	`, msg.FromKey, msg.ToKey, msg.Message, msg.Timestamp)
+	if err != nil {
+		return Message{}, err
+	}
+
+	msg.ID, err = result.LastInsertId()
+	return msg, err
+}
+
+// SendGroupMessage delivers a copy of the message to every active member of
+// the group except the sender, recording the group on each copy. The sender
+// must be an active member.
+func (d *Database) SendGroupMessage(fromKey string, groupID int64, message string) ([]Message, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var isMember bool
+	if err := tx.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM group_members
+			WHERE group_id = ? AND member_key = ? AND pending = 0
+		)
+	`, groupID, fromKey).Scan(&isMember); err != nil {
+		return nil, err
+	}
+	if !isMember {
+		return nil, fmt.Errorf("you are not a member of this group")
+	}
+
+	rows, err := tx.Query(`
+		SELECT member_key FROM group_members
+		WHERE group_id = ? AND member_key != ? AND pending = 0
+	`, groupID, fromKey)
+	if err != nil {
+		return nil, err
+	}
+	var recipients []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		recipients = append(recipients, key)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("the group has no other members yet")
+	}
+
+	now := utcNow()
+	var sent []Message
+	for _, toKey := range recipients {
+		msg := Message{FromKey: fromKey, ToKey: toKey, Message: message, Timestamp: now, GroupID: groupID}
+		result, err := tx.Exec(`
+			INSERT INTO messages (from_key, to_key, message, timestamp, read, group_id)
+			VALUES (?, ?, ?, ?, 0, ?)
+		`, msg.FromKey, msg.ToKey, msg.Message, msg.Timestamp, msg.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		if msg.ID, err = result.LastInsertId(); err != nil {
+			return nil, err
+		}
+		sent = append(sent, msg)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return sent, nil
+}
+
+func (d *Database) MarkMessageAsRead(messageID int64) error {
+	_, err := d.db.Exec(`
+		UPDATE messages SET read = 1 WHERE id = ?
+	`, messageID)
+
+	return err
+}
+
+func (d *Database) DeleteMessage(messageID int64) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		DELETE FROM message_edits WHERE message_id = ?
+	`, messageID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		DELETE FROM messages WHERE id = ?
+	`, messageID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetSentMessages returns the latest messages the user sent, newest first.
+// A message sent to a group is returned once, and counts as read once any
+// member has read it.
+func (d *Database) GetSentMessages(fromKey string, limit int) ([]Message, error) {
+	rows, err := d.db.Query(`
+		SELECT MIN(id), from_key, to_key, message, timestamp, MAX(read), group_id, edited_at
+		FROM messages
+		WHERE from_key = ?
+		GROUP BY COALESCE(group_id, -id), timestamp
+		ORDER BY timestamp DESC
+		LIMIT ?
+	`, fromKey, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// EditMessage replaces the text of a message the user sent, keeping the old
+// text in its edit history, and returns every changed copy. Messages sent to
+// a group are changed for all members.
+func (d *Database) EditMessage(messageID int64, fromKey, message string, window time.Duration) ([]Message, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	copies, err := changeableCopies(tx, messageID, fromKey, window)
+	if err != nil {
+		return nil, err
+	}
+	now := utcNow()
+	for i := range copies {
+		if _, err := tx.Exec(`
+			INSERT INTO message_edits (message_id, previous_message, edited_at)
+			VALUES (?, ?, ?)
+		`, copies[i].ID, copies[i].Message, now); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`
+			UPDATE messages SET message = ?, edited_at = ? WHERE id = ?
+		`, message, now, copies[i].ID); err != nil {
+			return nil, err
+		}
+		copies[i].Message = message
+		copies[i].EditedAt = now
+	}
+
+	return copies, tx.Commit()
+}
+
+// UnsendMessage deletes a message the user sent, with its edit history, from
+// every inbox it reached and returns the deleted copies.
+func (d *Database) UnsendMessage(messageID int64, fromKey string, window time.Duration) ([]Message, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	copies, err := changeableCopies(tx, messageID, fromKey, window)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range copies {
+		if _, err := tx.Exec(`
+			DELETE FROM message_edits WHERE message_id = ?
+		`, msg.ID); err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(`
+			DELETE FROM messages WHERE id = ?
+		`, msg.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return copies, tx.Commit()
+}
+
+// changeableCopies returns the message and, for group messages, its copies
+// in other members' inboxes. Senders may only change messages nobody has
+// read yet, and with a window, only that long after sending.
+func changeableCopies(tx *sql.Tx, messageID int64, fromKey string, window time.Duration) ([]Message, error) {
+	msg, err := scanMessage(tx.QueryRow(`
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE id = ? AND from_key = ?
+	`, messageID, fromKey))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("the message no longer exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if window > 0 && utcNow().Sub(msg.Timestamp) > window {
+		return nil, fmt.Errorf("messages can only be changed for %s after sending", formatDuration(window))
+	}
+
+	copies := []Message{msg}
+	if msg.GroupID != 0 {
+		rows, err := tx.Query(`
+			SELECT `+messageColumns+`
+			FROM messages
+			WHERE from_key = ? AND group_id = ? AND timestamp = ?
+		`, fromKey, msg.GroupID, msg.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		copies = nil
+		for rows.Next() {
+			msg, err := scanMessage(rows)
+			if err != nil {
+				return nil, err
+			}
+			copies = append(copies, msg)
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, msg := range copies {
+		if msg.Read {
+			return nil, fmt.Errorf("the message has already been read")
+		}
+	}
+	return copies, nil
+}
+
+// GetUnreadMessagesSince returns unread messages received after since,
+// oldest first.
+func (d *Database) GetUnreadMessagesSince(fingerprint string, since time.Time) ([]Message, error) {
+	rows, err := d.db.Query(`
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE to_key = ? AND read = 0 AND timestamp > ?
+		ORDER BY timestamp ASC
+	`, fingerprint, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		msg, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// CountUnreadMessages returns how many messages in the user's inbox are
+// still unread.
+func (d *Database) CountUnreadMessages(fingerprint string) (int, error) {
+	var count int
+	err := d.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM messages
+		WHERE to_key = ? AND read = 0
+	`, fingerprint).Scan(&count)
+	return count, err
+}
+
+// GetAlertSettings returns the user's new mail alert settings. Users who
+// never changed them get everything turned off.
+func (d *Database) GetAlertSettings(fingerprint string) (AlertSettings, error) {
+	settings := AlertSettings{SSHKeyFingerprint: fingerprint, Desktop: alertDesktopOff}
+	err := d.db.QueryRow(`
+		SELECT bell, desktop, window_title
+		FROM alert_settings
+		WHERE ssh_key_fingerprint = ?
+	`, fingerprint).Scan(&settings.Bell, &settings.Desktop, &settings.WindowTitle)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	return settings, err
+}
+
+func (d *Database) SaveAlertSettings(settings AlertSettings) error {
+	_, err := d.db.Exec(`
+		INSERT INTO alert_settings (ssh_key_fingerprint, bell, desktop, window_title, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(ssh_key_fingerprint) DO UPDATE SET
+			bell = excluded.bell,
+			desktop = excluded.desktop,
+			window_title = excluded.window_title,
+			updated_at = excluded.updated_at
+	`, settings.SSHKeyFingerprint, settings.Bell, settings.Desktop, settings.WindowTitle, utcNow())
+
+	return err
+}
+
+// GetUserSettings returns the user's preferences, with defaults for users
+// who never changed them.
+func (d *Database) GetUserSettings(fingerprint string) (UserSettings, error) {
+	settings := UserSettings{
+		SSHKeyFingerprint: fingerprint,
+		Theme:             string(themeGruvbox),
+		AlertScope:        alertScopeAll,
+		TimestampFormat:   timestampFormat24h,
+		ComposeMode:       composeModeMultiline,
+		KeyPreset:         keyPresetDefault,
+		ColorProfile:      colorProfileAuto,
+	}
+	err := d.db.QueryRow(`
+		SELECT theme, alert_scope, timestamp_format, timezone, relative_times, compose_mode, key_preset, color_profile
+		FROM user_settings
+		WHERE ssh_key_fingerprint = ?
+	`, fingerprint).Scan(&settings.Theme, &settings.AlertScope, &settings.TimestampFormat, &settings.Timezone, &settings.RelativeTimes, &settings.ComposeMode, &settings.KeyPreset, &settings.ColorProfile)
+	if err == sql.ErrNoRows {
+		return settings, nil
+	}
+	return settings, err
+}
+
+func (d *Database) SaveUserSettings(settings UserSettings) error {
+	_, err := d.db.Exec(`
+		INSERT INTO user_settings (ssh_key_fingerprint, theme, alert_scope, timestamp_format, timezone, relative_times, compose_mode, key_preset, color_profile, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(ssh_key_fingerprint) DO UPDATE SET
+			theme = excluded.theme,
+			alert_scope = excluded.alert_scope,
+			timestamp_format = excluded.timestamp_format,
+			timezone = excluded.timezone,
+			relative_times = excluded.relative_times,
+			compose_mode = excluded.compose_mode,
+			key_preset = excluded.key_preset,
+			color_profile = excluded.color_profile,
+			updated_at = excluded.updated_at
+	`, settings.SSHKeyFingerprint, settings.Theme, settings.AlertScope, settings.TimestampFormat, settings.Timezone, settings.RelativeTimes, settings.ComposeMode, settings.KeyPreset, settings.ColorProfile, utcNow())
+
+	return err
+}
+
+// GetKeyBindings returns the keys the user chose for actions instead of
+// those of their preset, by action.
+func (d *Database) GetKeyBindings(fingerprint string) (map[string][]string, error) {
+	rows, err := d.db.Query(`
+		SELECT action, key
+		FROM key_bindings
+		WHERE ssh_key_fingerprint = ?
+		ORDER BY rowid
+	`, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bindings := make(map[string][]string)
+	for rows.Next() {
+		var action, key string
+		if err := rows.Scan(&action, &key); err != nil {
+			return nil, err
+		}
+		bindings[action] = append(bindings[action], key)
+	}
+	return bindings, rows.Err()
+}
+
+// SetKeyBinding replaces the keys the user chose for an action. No keys
+// puts back those of their preset.
+func (d *Database) SetKeyBinding(fingerprint, action string, keys []string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM key_bindings WHERE ssh_key_fingerprint = ? AND action = ?`, fingerprint, action); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if _, err := tx.Exec(`INSERT INTO key_bindings (ssh_key_fingerprint, action, key) VALUES (?, ?, ?)`, fingerprint, action, key); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetEmailSettings returns the user's email settings, or nil if they have
+// not registered an address.
+func (d *Database) GetEmailSettings(fingerprint string) (*EmailSettings, error) {
+	var settings EmailSettings
+	var lastNotified sql.NullTime
+	err := d.db.QueryRow(`
+		SELECT ssh_key_fingerprint, email, verified, frequency, last_notified
+		FROM email_notifications
+		WHERE ssh_key_fingerprint = ?
+	`, fingerprint).Scan(&settings.SSHKeyFingerprint, &settings.Email, &settings.Verified, &settings.Frequency, &lastNotified)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	settings.LastNotified = lastNotified.Time
+	return &settings, nil
+}
+
+// SetPendingEmail registers a new, unverified address for the user together
+// with the code that will verify it.
+func (d *Database) SetPendingEmail(fingerprint, email, code string, expires time.Time) error {
+	_, err := d.db.Exec(`
+		INSERT INTO email_notifications (ssh_key_fingerprint, email, verified, verification_code, code_expires, code_attempts)
+		VALUES (?, ?, 0, ?, ?, 0)
+		ON CONFLICT(ssh_key_fingerprint) DO UPDATE SET
+			email = excluded.email,
+			verified = 0,
+			verification_code = excluded.verification_code,
+			code_expires = excluded.code_expires,
+			code_attempts = 0
+	`, fingerprint, email, code, expires.UTC())
+
+	return err
+}
+
+// VerifyEmail marks the user's address as verified if code matches and has
+// not expired. It reports whether verification succeeded. Each wrong code
+// counts as an attempt, and after maxAttempts the code is thrown away so it
+// can't be guessed.
+func (d *Database) VerifyEmail(fingerprint, code string, maxAttempts int) (bool, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	now := utcNow()
+	result, err := tx.Exec(`
+		UPDATE email_notifications
+		SET verified = 1, verification_code = NULL, code_expires = NULL, code_attempts = 0, last_notified = ?
+		WHERE ssh_key_fingerprint = ? AND verification_code = ? AND code_expires > ? AND code_attempts < ?
+	`, now, fingerprint, code, now, maxAttempts)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n > 0 {
+		return true, tx.Commit()
+	}
+
+	result, err = tx.Exec(`
+		UPDATE email_notifications
+		SET code_attempts = code_attempts + 1
+		WHERE ssh_key_fingerprint = ? AND verification_code IS NOT NULL
+	`, fingerprint)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	var attempts int
+	if err := tx.QueryRow(`
+		SELECT code_attempts FROM email_notifications WHERE ssh_key_fingerprint = ?
+	`, fingerprint).Scan(&attempts); err != nil {
+		return false, err
+	}
+	if attempts >= maxAttempts {
+		if _, err := tx.Exec(`
+			UPDATE email_notifications
+			SET verification_code = NULL, code_expires = NULL
+			WHERE ssh_key_fingerprint = ?
+		`, fingerprint); err != nil {
+			return false, err
+		}
+		if err := tx.Commit(); err != nil {
+			return false, err
+		}
+		return false, fmt.Errorf("too many wrong codes, request a new one")
+	}
+	return false, tx.Commit()
+}
+
+func (d *Database) SetNotificationFrequency(fingerprint, frequency string) error {
+	_, err := d.db.Exec(`
+		UPDATE email_notifications SET frequency = ? WHERE ssh_key_fingerprint = ?
+	`, frequency, fingerprint)
+
+	return err
+}
+
+func (d *Database) DeleteEmailSettings(fingerprint string) error {
+	_, err := d.db.Exec(`
+		DELETE FROM email_notifications WHERE ssh_key_fingerprint = ?
+	`, fingerprint)
+
+	return err
+}
+
+// GetEmailSubscribers returns every verified address that wants
+// notifications.
+func (d *Database) GetEmailSubscribers() ([]EmailSettings, error) {
+	rows, err := d.db.Query(`
+		SELECT ssh_key_fingerprint, email, verified, frequency, last_notified
+		FROM email_notifications
+		WHERE verified = 1 AND frequency != 'off'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subscribers []EmailSettings
+	for rows.Next() {
+		var settings EmailSettings
+		var lastNotified sql.NullTime
+		if err := rows.Scan(&settings.SSHKeyFingerprint, &settings.Email, &settings.Verified, &settings.Frequency, &lastNotified); err != nil {
+			return nil, err
+		}
+		settings.LastNotified = lastNotified.Time
+		subscribers = append(subscribers, settings)
+	}
+
+	return subscribers, rows.Err()
+}
+
+func (d *Database) MarkNotified(fingerprint string, at time.Time) error {
+	_, err := d.db.Exec(`
+		UPDATE email_notifications SET last_notified = ? WHERE ssh_key_fingerprint = ?
+	`, at.UTC(), fingerprint)
+
+	return err
+}
+
+// CreateWebhook registers a webhook. An empty ownerKey creates a global
+// webhook.
+func (d *Database) CreateWebhook(ownerKey, url, secret, events string) (int64, error) {
+	var owner any
+	if ownerKey != "" {
+		owner = ownerKey
+	}
+
+	result, err := d.db.Exec(`
+		INSERT INTO webhooks (owner_key, url, secret, events, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, owner, url, secret, events, utcNow())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetWebhooks returns the user's webhooks, plus the global ones when
+// includeGlobal is set.
+func (d *Database) GetWebhooks(ownerKey string, includeGlobal bool) ([]Webhook, error) {
+	return d.queryWebhooks(`
+		SELECT id, owner_key, url, secret, events, created_at
+		FROM webhooks
+		WHERE owner_key = ? OR (? AND owner_key IS NULL)
+		ORDER BY created_at ASC
+	`, ownerKey, includeGlobal)
+}
+
+// GetWebhooksForEvent returns the webhooks that should receive an event
+// concerning ownerKey: the user's own webhooks and all global ones.
+func (d *Database) GetWebhooksForEvent(event, ownerKey string) ([]Webhook, error) {
+	hooks, err := d.queryWebhooks(`
+		SELECT id, owner_key, url, secret, events, created_at
+		FROM webhooks
+		WHERE owner_key = ? OR owner_key IS NULL
+	`, ownerKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []Webhook
+	for _, hook := range hooks {
+		if hook.Events == "*" || slices.Contains(strings.Split(hook.Events, ","), event) {
+			matching = append(matching, hook)
+		}
+	}
+	return matching, nil
+}
+
+func (d *Database) queryWebhooks(query string, args ...any) ([]Webhook, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []Webhook
+	for rows.Next() {
+		var hook Webhook
+		var owner sql.NullString
+		if err := rows.Scan(&hook.ID, &owner, &hook.URL, &hook.Secret, &hook.Events, &hook.CreatedAt); err != nil {
+			return nil, err
+		}
+		hook.OwnerKey = owner.String
+		hooks = append(hooks, hook)
+	}
+
+	return hooks, rows.Err()
+}
+
+// SetWebhookEvents changes the events a webhook receives. ownerKey is empty
+// for global webhooks.
+func (d *Database) SetWebhookEvents(webhookID int64, ownerKey, events string) error {
+	_, err := d.db.Exec(`
+		UPDATE webhooks SET events = ? WHERE id = ? AND COALESCE(owner_key, '') = ?
+	`, events, webhookID, ownerKey)
+
+	return err
+}
+
+// DeleteWebhook removes a webhook together with its delivery log. ownerKey
+// is empty for global webhooks.
+func (d *Database) DeleteWebhook(webhookID int64, ownerKey string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		DELETE FROM webhooks WHERE id = ? AND COALESCE(owner_key, '') = ?
+	`, webhookID, ownerKey)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM webhook_deliveries WHERE webhook_id = ?`, webhookID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *Database) LogWebhookDelivery(webhookID int64, event, payload string, attempt, statusCode int, deliveryErr string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO webhook_deliveries (webhook_id, event, payload, attempt, status_code, error, delivered_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, webhookID, event, payload, attempt, statusCode, deliveryErr, utcNow())
+
+	return err
+}
+
+// GetWebhookDeliveries returns the most recent delivery attempts for a
+// webhook, newest first.
+func (d *Database) GetWebhookDeliveries(webhookID int64, limit int) ([]WebhookDelivery, error) {
+	rows, err := d.db.Query(`
+		SELECT id, webhook_id, event, attempt, status_code, error, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY delivered_at DESC
+		LIMIT ?
+	`, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var delivery WebhookDelivery
+		if err := rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Attempt, &delivery.StatusCode, &delivery.Error, &delivery.DeliveredAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// CreateAPIToken stores the hash of a new API token for the user.
+func (d *Database) CreateAPIToken(fingerprint, name, tokenHash, scope string) (int64, error) {
+	result, err := d.db.Exec(`
+		INSERT INTO api_tokens (ssh_key_fingerprint, name, token_hash, scope, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, fingerprint, name, tokenHash, scope, utcNow())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetAPITokens returns the user's API tokens, oldest first.
+func (d *Database) GetAPITokens(fingerprint string) ([]APIToken, error) {
+	rows, err := d.db.Query(`
+		SELECT id, ssh_key_fingerprint, name, scope, created_at, last_used_at
+		FROM api_tokens
+		WHERE ssh_key_fingerprint = ?
+		ORDER BY created_at ASC
+	`, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var token APIToken
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&token.ID, &token.SSHKeyFingerprint, &token.Name, &token.Scope, &token.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		token.LastUsedAt = lastUsed.Time
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken deletes one of the user's tokens. Tokens belonging to other
+// users are left alone.
+func (d *Database) RevokeAPIToken(tokenID int64, fingerprint string) error {
+	_, err := d.db.Exec(`
+		DELETE FROM api_tokens WHERE id = ? AND ssh_key_fingerprint = ?
+	`, tokenID, fingerprint)
+
+	return err
+}
+
+// AuthenticateAPIToken looks up a token by its hash and records that it was
+// used. It returns nil if no such token exists.
+func (d *Database) AuthenticateAPIToken(tokenHash string) (*APIToken, error) {
+	var token APIToken
+	var lastUsed sql.NullTime
+	err := d.db.QueryRow(`
+		SELECT id, ssh_key_fingerprint, name, scope, created_at, last_used_at
+		FROM api_tokens
+		WHERE token_hash = ?
+	`, tokenHash).Scan(&token.ID, &token.SSHKeyFingerprint, &token.Name, &token.Scope, &token.CreatedAt, &lastUsed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	token.LastUsedAt = utcNow()
+	if _, err := d.db.Exec(`
+		UPDATE api_tokens SET last_used_at = ? WHERE id = ?
+	`, token.LastUsedAt, token.ID); err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// CreateBot registers a bot and the user row it sends messages as.
+func (d *Database) CreateBot(id, ownerKey, name, tokenHash string, rateLimit time.Duration) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := utcNow()
+	if _, err := tx.Exec(`
+		INSERT INTO users (ssh_key_fingerprint, first_seen, last_seen)
+		VALUES (?, ?, ?)
+	`, id, now, now); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO bots (id, owner_key, name, token_hash, rate_limit_seconds, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, id, ownerKey, name, tokenHash, int(rateLimit.Seconds()), now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetBots returns the bots owned by a user, oldest first.
+func (d *Database) GetBots(ownerKey string) ([]Bot, error) {
+	rows, err := d.db.Query(`
+		SELECT id, owner_key, name, rate_limit_seconds, created_at
+		FROM bots
+		WHERE owner_key = ?
+		ORDER BY created_at ASC
+	`, ownerKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bots []Bot
+	for rows.Next() {
+		var bot Bot
+		var rateLimit int
+		if err := rows.Scan(&bot.ID, &bot.OwnerKey, &bot.Name, &rateLimit, &bot.CreatedAt); err != nil {
+			return nil, err
+		}
+		bot.RateLimit = time.Duration(rateLimit) * time.Second
+		bots = append(bots, bot)
+	}
+
+	return bots, rows.Err()
+}
+
+// AuthenticateBot looks up a bot by the hash of its token and marks it as
+// seen. It returns nil if no bot has that token.
+func (d *Database) AuthenticateBot(tokenHash string) (*Bot, error) {
+	var bot Bot
+	var rateLimit int
+	err := d.db.QueryRow(`
+		SELECT id, owner_key, name, rate_limit_seconds, created_at
+		FROM bots
+		WHERE token_hash = ?
+	`, tokenHash).Scan(&bot.ID, &bot.OwnerKey, &bot.Name, &rateLimit, &bot.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	bot.RateLimit = time.Duration(rateLimit) * time.Second
+
+	if err := d.UpsertUser(bot.ID); err != nil {
+		return nil, err
+	}
+	return &bot, nil
+}
+
+// GetBotIDs returns the IDs of all bots, for marking their messages.
+func (d *Database) GetBotIDs() (map[string]bool, error) {
+	rows, err := d.db.Query(`SELECT id FROM bots`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+
+	return ids, rows.Err()
+}
+
+func (d *Database) SetBotRateLimit(botID, ownerKey string, rateLimit time.Duration) error {
+	_, err := d.db.Exec(`
+		UPDATE bots SET rate_limit_seconds = ? WHERE id = ? AND owner_key = ?
+	`, int(rateLimit.Seconds()), botID, ownerKey)
+
+	return err
+}
+
+func (d *Database) SetBotToken(botID, ownerKey, tokenHash string) error {
+	_, err := d.db.Exec(`
+		UPDATE bots SET token_hash = ? WHERE id = ? AND owner_key = ?
+	`, tokenHash, botID, ownerKey)
+
+	return err
+}
+
+// DeleteBot removes a bot so its token stops working. Messages it sent are
+// kept.
+func (d *Database) DeleteBot(botID, ownerKey string) error {
+	_, err := d.db.Exec(`
+		DELETE FROM bots WHERE id = ? AND owner_key = ?
+	`, botID, ownerKey)
+
+	return err
+}
+
+// CreateGroup creates a group with the creator as its first owner.
+func (d *Database) CreateGroup(name, ownerKey string) (int64, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var taken bool
+	if err := tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM message_groups WHERE name = ?)
+	`, name).Scan(&taken); err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, fmt.Errorf("a group named %q already exists", name)
+	}
+
+	now := utcNow()
+	result, err := tx.Exec(`
+		INSERT INTO message_groups (name, created_at) VALUES (?, ?)
+	`, name, now)
+	if err != nil {
+		return 0, err
+	}
+	groupID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO group_members (group_id, member_key, role, pending, joined_at)
+		VALUES (?, ?, ?, 0, ?)
+	`, groupID, ownerKey, roleOwner, now); err != nil {
+		return 0, err
+	}
+
+	return groupID, tx.Commit()
+}
+
+// GetGroupsForUser returns the groups a user belongs to or is invited to,
+// ordered by name.
+func (d *Database) GetGroupsForUser(fingerprint string) ([]Group, error) {
+	rows, err := d.db.Query(`
+		SELECT g.id, g.name, g.created_at, me.role, me.pending,
+			(SELECT COUNT(*) FROM group_members WHERE group_id = g.id AND pending = 0)
+		FROM message_groups g
+		JOIN group_members me ON me.group_id = g.id AND me.member_key = ?
+		ORDER BY g.name COLLATE NOCASE ASC
+	`, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []Group
+	for rows.Next() {
+		var group Group
+		if err := rows.Scan(&group.ID, &group.Name, &group.CreatedAt, &group.Role, &group.Pending, &group.MemberCount); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+// GetGroupForUser looks up a group by name, case-insensitively, together
+// with the user's membership. It returns nil if the group doesn't exist or
+// the user is neither a member nor invited.
+func (d *Database) GetGroupForUser(name, fingerprint string) (*Group, error) {
+	var group Group
+	err := d.db.QueryRow(`
+		SELECT g.id, g.name, g.created_at, me.role, me.pending,
+			(SELECT COUNT(*) FROM group_members WHERE group_id = g.id AND pending = 0)
+		FROM message_groups g
+		JOIN group_members me ON me.group_id = g.id AND me.member_key = ?
+		WHERE g.name = ?
+	`, fingerprint, name).Scan(&group.ID, &group.Name, &group.CreatedAt, &group.Role, &group.Pending, &group.MemberCount)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GetGroupNames returns the name of every group by ID, for labelling group
+// messages.
+func (d *Database) GetGroupNames() (map[int64]string, error) {
+	rows, err := d.db.Query(`SELECT id, name FROM message_groups`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+
+	return names, rows.Err()
+}
+
+// GetGroupMembers returns a group's members and pending invitations, owners
+// first.
+func (d *Database) GetGroupMembers(groupID int64) ([]GroupMember, error) {
+	rows, err := d.db.Query(`
+		SELECT group_id, member_key, role, pending, joined_at
+		FROM group_members
+		WHERE group_id = ?
+		ORDER BY pending ASC, role = ? DESC, joined_at ASC
+	`, groupID, roleOwner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []GroupMember
+	for rows.Next() {
+		var member GroupMember
+		if err := rows.Scan(&member.GroupID, &member.MemberKey, &member.Role, &member.Pending, &member.JoinedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+// InviteToGroup adds a pending member. Inviting someone who is already a
+// member or already invited is a no-op.
+func (d *Database) InviteToGroup(groupID int64, memberKey string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO group_members (group_id, member_key, role, pending, joined_at)
+		VALUES (?, ?, ?, 1, ?)
+		ON CONFLICT(group_id, member_key) DO NOTHING
+	`, groupID, memberKey, roleMember, utcNow())
+
+	return err
+}
+
+func (d *Database) AcceptGroupInvite(groupID int64, memberKey string) error {
+	_, err := d.db.Exec(`
+		UPDATE group_members SET pending = 0, joined_at = ?
+		WHERE group_id = ? AND member_key = ? AND pending = 1
+	`, utcNow(), groupID, memberKey)
+
+	return err
+}
+
+func (d *Database) SetGroupRole(groupID int64, memberKey, role string) error {
+	_, err := d.db.Exec(`
+		UPDATE group_members SET role = ?
+		WHERE group_id = ? AND member_key = ? AND pending = 0
+	`, role, groupID, memberKey)
+
+	return err
+}
+
+// RemoveGroupMember removes a member or declines an invitation. The last
+// owner cannot leave while other members remain, and a group whose last
+// member leaves is deleted. Messages already sent to the group are kept.
+func (d *Database) RemoveGroupMember(groupID int64, memberKey string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owners, members int
+	if err := tx.QueryRow(`
+		SELECT
+			COUNT(*) FILTER (WHERE role = ? AND member_key != ?),
+			COUNT(*) FILTER (WHERE pending = 0 AND member_key != ?)
+		FROM group_members
+		WHERE group_id = ?
+	`, roleOwner, memberKey, memberKey, groupID).Scan(&owners, &members); err != nil {
+		return err
+	}
+	if owners == 0 && members > 0 {
+		return fmt.Errorf("make someone else an owner before leaving")
+	}
+
+	if _, err := tx.Exec(`
+		DELETE FROM group_members WHERE group_id = ? AND member_key = ?
+	`, groupID, memberKey); err != nil {
+		return err
+	}
+
+	if members == 0 {
+		if _, err := tx.Exec(`
+			DELETE FROM group_members WHERE group_id = ?
+		`, groupID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			DELETE FROM message_groups WHERE id = ?
+		`, groupID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// CreatePost publishes a post on the public timeline.
+func (d *Database) CreatePost(authorKey, body string) (Post, error) {
+	post := Post{AuthorKey: authorKey, Body: body, CreatedAt: utcNow()}
+	result, err := d.db.Exec(`
+		INSERT INTO posts (author_key, body, created_at) VALUES (?, ?, ?)
+	`, post.AuthorKey, post.Body, post.CreatedAt)
+	if err != nil {
+		return Post{}, err
+	}
+
+	post.ID, err = result.LastInsertId()
+	return post, err
+}
+
+// GetTimeline returns the newest posts, newest first. With followingOnly set
+// it only includes posts by people the viewer follows and the viewer's own.
+func (d *Database) GetTimeline(viewerKey string, followingOnly bool, limit int) ([]Post, error) {
+	query := `
+		SELECT p.id, p.author_key, p.body, p.created_at,
+			(SELECT COUNT(*) FROM post_likes WHERE post_id = p.id),
+			EXISTS(SELECT 1 FROM post_likes WHERE post_id = p.id AND liker_key = ?)
+		FROM posts p
+	`
+	args := []any{viewerKey}
+	if followingOnly {
+		query += `
+		WHERE p.author_key = ?
+			OR p.author_key IN (SELECT followee_key FROM follows WHERE follower_key = ?)
+		`
+		args = append(args, viewerKey, viewerKey)
+	}
+	query += `ORDER BY p.created_at DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []Post
+	for rows.Next() {
+		var post Post
+		if err := rows.Scan(&post.ID, &post.AuthorKey, &post.Body, &post.CreatedAt, &post.Likes, &post.LikedByMe); err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+
+	return posts, rows.Err()
+}
+
+// DeletePost removes one of the author's posts and its likes.
+func (d *Database) DeletePost(postID int64, authorKey string) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		DELETE FROM posts WHERE id = ? AND author_key = ?
+	`, postID, authorKey)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return err
+	}
+	if _, err := tx.Exec(`
+		DELETE FROM post_likes WHERE post_id = ?
+	`, postID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ToggleLike likes the post, or removes the like if the user already liked
+// it. It reports whether the post is now liked.
+func (d *Database) ToggleLike(postID int64, likerKey string) (bool, error) {
+	result, err := d.db.Exec(`
+		DELETE FROM post_likes WHERE post_id = ? AND liker_key = ?
+	`, postID, likerKey)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n > 0 {
+		return false, err
+	}
+
+	_, err = d.db.Exec(`
+		INSERT INTO post_likes (post_id, liker_key, created_at) VALUES (?, ?, ?)
+	`, postID, likerKey, utcNow())
+	return err == nil, err
+}
+
+func (d *Database) Follow(followerKey, followeeKey string) error {
+	_, err := d.db.Exec(`
+		INSERT INTO follows (follower_key, followee_key, created_at)
+		VALUES (?, ?, ?)
+		ON CONFLICT(follower_key, followee_key) DO NOTHING
+	`, followerKey, followeeKey, utcNow())
+
+	return err
+}
+
+func (d *Database) Unfollow(followerKey, followeeKey string) error {
+	_, err := d.db.Exec(`
+		DELETE FROM follows WHERE follower_key = ? AND followee_key = ?
+	`, followerKey, followeeKey)
+
+	return err
+}
+
+// GetFollowing returns the set of users the follower follows.
+func (d *Database) GetFollowing(followerKey string) (map[string]bool, error) {
+	rows, err := d.db.Query(`
+		SELECT followee_key FROM follows WHERE follower_key = ?
+	`, followerKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	following := make(map[string]bool)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		following[key] = true
+	}
+
+	return following, rows.Err()
+}
+
+// SaveDraft stores the draft and returns its ID. Drafts without an ID, or
+// whose row was discarded from another session, are inserted as new ones.
+func (d *Database) SaveDraft(draft Draft) (int64, error) {
+	if draft.ID != 0 {
+		result, err := d.db.Exec(`
+			UPDATE drafts SET recipient = ?, body = ?, interrupted = ?, updated_at = ?
+			WHERE id = ? AND ssh_key_fingerprint = ?
+		`, draft.Recipient, draft.Body, draft.Interrupted, utcNow(), draft.ID, draft.SSHKeyFingerprint)
+		if err != nil {
+			return 0, err
+		}
+		if n, err := result.RowsAffected(); err != nil || n > 0 {
+			return draft.ID, err
+		}
+	}
+
+	result, err := d.db.Exec(`
+		INSERT INTO drafts (ssh_key_fingerprint, recipient, body, interrupted, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, draft.SSHKeyFingerprint, draft.Recipient, draft.Body, draft.Interrupted, utcNow())
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetDrafts returns the user's drafts, most recently saved first.
+func (d *Database) GetDrafts(fingerprint string) ([]Draft, error) {
+	rows, err := d.db.Query(`
+		SELECT id, ssh_key_fingerprint, recipient, body, interrupted, updated_at
+		FROM drafts
+		WHERE ssh_key_fingerprint = ?
+		ORDER BY updated_at DESC, id DESC
+	`, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var drafts []Draft
+	for rows.Next() {
+		var draft Draft
+		if err := rows.Scan(&draft.ID, &draft.SSHKeyFingerprint, &draft.Recipient, &draft.Body, &draft.Interrupted, &draft.UpdatedAt); err != nil {
+			return nil, err
+		}
+		drafts = append(drafts, draft)
+	}
+
+	return drafts, rows.Err()
+}
+
+// TakeInterruptedDraft returns the newest draft the user was writing when a
+// connection dropped, or nil if there is none. Every draft stops counting as
+// interrupted, so each is only offered once.
+func (d *Database) TakeInterruptedDraft(fingerprint string) (*Draft, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var draft Draft
+	err = tx.QueryRow(`
+		SELECT id, ssh_key_fingerprint, recipient, body, updated_at
+		FROM drafts
+		WHERE ssh_key_fingerprint = ? AND interrupted = 1
+		ORDER BY updated_at DESC, id DESC
+		LIMIT 1
+	`, fingerprint).Scan(&draft.ID, &draft.SSHKeyFingerprint, &draft.Recipient, &draft.Body, &draft.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`
+		UPDATE drafts SET interrupted = 0 WHERE ssh_key_fingerprint = ? AND interrupted = 1
+	`, fingerprint); err != nil {
+		return nil, err
+	}
+
+	return &draft, tx.Commit()
+}
+
+// DeleteDraft removes one of the user's drafts. Drafts belonging to other
+// users are left alone.
+func (d *Database) DeleteDraft(draftID int64, fingerprint string) error {
+	_, err := d.db.Exec(`
+		DELETE FROM drafts WHERE id = ? AND ssh_key_fingerprint = ?
+	`, draftID, fingerprint)
+
+	return err
+}
+
+// ScheduleMessage queues a message to be sent at its SendAt time and returns
+// its ID.
+func (d *Database) ScheduleMessage(msg ScheduledMessage) (int64, error) {
+	var groupID sql.NullInt64
+	if msg.GroupID != 0 {
+		groupID = sql.NullInt64{Int64: msg.GroupID, Valid: true}
+	}
+	result, err := d.db.Exec(`
+		INSERT INTO scheduled_messages (from_key, recipient, group_id, body, send_at, created_at, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, msg.FromKey, msg.Recipient, groupID, msg.Body, msg.SendAt.UTC(), utcNow(), msg.Error)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// CountScheduledMessages returns how many messages the user has waiting to
+// be sent.
+func (d *Database) CountScheduledMessages(fromKey string) (int, error) {
+	var count int
+	err := d.db.QueryRow(`
+		SELECT COUNT(*)
+		FROM scheduled_messages
+		WHERE from_key = ?
+	`, fromKey).Scan(&count)
+	return count, err
+}
+
+// GetScheduledMessages returns the messages the user has waiting to be sent,
+// soonest first.
+func (d *Database) GetScheduledMessages(fromKey string) ([]ScheduledMessage, error) {
+	return d.queryScheduledMessages(`
+		SELECT id, from_key, recipient, group_id, body, send_at, created_at, error
+		FROM scheduled_messages
+		WHERE from_key = ?
+		ORDER BY send_at ASC, id ASC
+	`, fromKey)
+}
+
+// GetDueScheduledMessages returns every message that should have been sent
+// by now. Messages that failed to send wait for their sender to fix them.
+func (d *Database) GetDueScheduledMessages(now time.Time) ([]ScheduledMessage, error) {
+	return d.queryScheduledMessages(`
+		SELECT id, from_key, recipient, group_id, body, send_at, created_at, error
+		FROM scheduled_messages
+		WHERE send_at <= ? AND error = ''
+		ORDER BY send_at ASC, id ASC
+	`, now.UTC())
+}
+
+func (d *Database) queryScheduledMessages(query string, args ...any) ([]ScheduledMessage, error) {
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []ScheduledMessage
+	for rows.Next() {
+		var msg ScheduledMessage
+		var groupID sql.NullInt64
+		if err := rows.Scan(&msg.ID, &msg.FromKey, &msg.Recipient, &groupID, &msg.Body, &msg.SendAt, &msg.CreatedAt, &msg.Error); err != nil {
+			return nil, err
+		}
+		msg.GroupID = groupID.Int64
+		messages = append(messages, msg)
+	}
+
+	return messages, rows.Err()
+}
+
+// UpdateScheduledMessage changes the text and time of one of the user's
+// scheduled messages and gives it another try if it failed to send.
+func (d *Database) UpdateScheduledMessage(msg ScheduledMessage) error {
+	result, err := d.db.Exec(`
+		UPDATE scheduled_messages SET body = ?, send_at = ?, error = ''
+		WHERE id = ? AND from_key = ?
+	`, msg.Body, msg.SendAt.UTC(), msg.ID, msg.FromKey)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("the message has already been sent or cancelled")
+	}
+	return nil
+}
+
+// ClaimScheduledMessage removes a scheduled message from the queue so that it
+// can be sent, and returns it as it is now. It returns nil if the message
+// was cancelled or claimed by someone else in the meantime.
+func (d *Database) ClaimScheduledMessage(messageID int64) (*ScheduledMessage, error) {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var msg ScheduledMessage
+	var groupID sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT id, from_key, recipient, group_id, body, send_at, created_at, error
+		FROM scheduled_messages
+		WHERE id = ?
+	`, messageID).Scan(&msg.ID, &msg.FromKey, &msg.Recipient, &groupID, &msg.Body, &msg.SendAt, &msg.CreatedAt, &msg.Error)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	msg.GroupID = groupID.Int64
+	if _, err := tx.Exec(`DELETE FROM scheduled_messages WHERE id = ?`, messageID); err != nil {
+		return nil, err
+	}
+
+	return &msg, tx.Commit()
+}
+
+// CancelScheduledMessage removes one of the user's scheduled messages before
+// it is sent. Messages scheduled by other users are left alone.
+func (d *Database) CancelScheduledMessage(messageID int64, fromKey string) error {
+	_, err := d.db.Exec(`
+		DELETE FROM scheduled_messages WHERE id = ? AND from_key = ?
+	`, messageID, fromKey)
+
+	return err
+}
+
+// Backup writes a consistent snapshot of the database to path using
+// VACUUM INTO, which is safe to run while the server is serving sessions.
+// The target file must not already exist.
+func (d *Database) Backup(path string) error {
+	_, err := d.db.Exec(`VACUUM INTO ?`, path)
+	return err
+}
+
+// IntegrityCheck runs PRAGMA integrity_check and returns an error describing
+// the first problems found, if any.
+func (d *Database) IntegrityCheck() error {
+	rows, err := d.db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var result string
+		if err := rows.Scan(&result); err != nil {
+			return err
+		}
+		if result != "ok" {
+			problems = append(problems, result)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
 }
 
 func (d *Database) Close() error {
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestDatabase(t *testing.T) *Database {
+	t.Helper()
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "soshial.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestImportMessages(t *testing.T) {
+	db := newTestDatabase(t)
+	for _, key := range []string{"alice", "bob"} {
+		if err := db.UpsertUser(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A local group whose ID happens to match the one in the export
+	groupID, err := db.CreateGroup("unrelated", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	edited := sent.Add(5 * time.Minute)
+	exported := []Message{
+		{FromKey: "carol", ToKey: "bob", Message: "from a group elsewhere", Timestamp: sent, GroupID: groupID},
+		{FromKey: "carol", ToKey: "bob", Message: "changed", Timestamp: sent.Add(time.Hour), Read: true, EditedAt: edited},
+		{FromKey: "carol", ToKey: "bob", Message: "hi \x1b]52;c;QUJD\x07there", Timestamp: sent.Add(2 * time.Hour)},
+		{FromKey: "bob", ToKey: "alice", Message: "not bob's to import", Timestamp: sent},
+	}
+
+	imported, err := db.ImportMessages("bob", exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if imported != 3 {
+		t.Fatalf("imported %d messages, want 3", imported)
+	}
+	// Importing the same file again adds nothing
+	if imported, err := db.ImportMessages("bob", exported); err != nil || imported != 0 {
+		t.Fatalf("second import = %d, %v, want 0, nil", imported, err)
+	}
+
+	inbox, err := db.GetMessagesForUser("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byText := make(map[string]Message)
+	for _, msg := range inbox {
+		byText[msg.Message] = msg
+	}
+	if msg := byText["from a group elsewhere"]; msg.GroupID != 0 {
+		t.Errorf("imported message kept group %d, want none", msg.GroupID)
+	}
+	if msg := byText["changed"]; !msg.Read || !msg.EditedAt.Equal(edited) {
+		t.Errorf("imported message has read %v, edited at %v, want true, %v", msg.Read, msg.EditedAt, edited)
+	}
+	if _, ok := byText["hi ]52;c;QUJDthere"]; !ok {
+		t.Errorf("control characters weren't stripped from the imported message, inbox: %+v", inbox)
+	}
+
+	other, err := db.GetMessagesForUser("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other) != 0 {
+		t.Errorf("alice got %d imported messages, want 0", len(other))
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// How often the message being written is saved as a draft
+const draftSaveInterval = 5 * time.Second
+
+// Lines of the drafts screen that aren't drafts
+const draftsChrome = 12
+
+// Tabs of the drafts screen
+const (
+	draftsTabDrafts = iota
+	draftsTabScheduled
+	draftsTabSent
+	draftsTabCount
+)
+
+var draftsTabNames = []string{"Drafts", "Scheduled", "Sent"}
+
+type draftTickMsg struct{ gen int }
+
+func autosaveDraft(gen int) tea.Cmd {
+	return tea.Tick(draftSaveInterval, func(time.Time) tea.Msg {
+		return draftTickMsg{gen}
+	})
+}
+
+// composeDraft is the message being written in a session. The model and the
+// session's disconnect handler share it, so whatever was typed can be saved
+// when the connection drops without the model ever seeing it happen.
+type composeDraft struct {
+	mu     sync.Mutex
+	db     *Database
+	active bool
+	draft  Draft
+	saved  string // Body as last saved
+}
+
+// start follows a new message, or a draft being resumed.
+func (c *composeDraft) start(draft Draft) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active = true
+	c.draft = draft
+	c.saved = draft.Body
+}
+
+// update records what has been typed so far.
+func (c *composeDraft) update(body string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.draft.Body = body
+}
+
+// stop stops following the message, leaving any saved draft in place.
+func (c *composeDraft) stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active = false
+}
+
+// save stores the message if it changed since it was last saved and reports
+// whether a draft is kept. Messages that are only whitespace aren't worth
+// keeping, so their draft is removed instead.
+func (c *composeDraft) save(interrupted bool) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.active {
+		return false, nil
+	}
+
+	if strings.TrimSpace(c.draft.Body) == "" {
+		if c.draft.ID != 0 {
+			if err := c.db.DeleteDraft(c.draft.ID, c.draft.SSHKeyFingerprint); err != nil {
+				return false, err
+			}
+			c.draft.ID = 0
+		}
+		c.saved = c.draft.Body
+		return false, nil
+	}
+	if c.draft.ID != 0 && c.draft.Body == c.saved && !interrupted {
+		return true, nil
+	}
+
+	c.draft.Interrupted = interrupted
+	id, err := c.db.SaveDraft(c.draft)
+	if err != nil {
+		return false, err
+	}
+	c.draft.ID = id
+	c.saved = c.draft.Body
+	return true, nil
+}
+
+// discard stops following the message and removes its draft, once the
+// message has been sent.
+func (c *composeDraft) discard() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.active = false
+	if c.draft.ID == 0 {
+		return nil
+	}
+	return c.db.DeleteDraft(c.draft.ID, c.draft.SSHKeyFingerprint)
+}
+
+// openCompose starts writing a message to recipient, or to group if it is
+// not nil.
+func (m model) openCompose(recipient string, group *Group) (tea.Model, tea.Cmd) {
+	return m.startCompose(Draft{SSHKeyFingerprint: m.userKey, Recipient: recipient}, group)
+}
+
+// resumeDraft goes back to writing a draft. Drafts to a group can only be
+// resumed while the user can still send to it.
+func (m model) resumeDraft(draft Draft) (tea.Model, tea.Cmd) {
+	group, err := m.resolveGroupRecipient(draft.Recipient)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	return m.startCompose(draft, group)
+}
+
+func (m model) startCompose(draft Draft, group *Group) (tea.Model, tea.Cmd) {
+	if group != nil {
+		draft.Recipient = "#" + group.Name
+	}
+	m.currentScreen = sendMessageContent
+	m.recipient = draft.Recipient
+	m.recipientGroup = group
+	m.composePreview = false
+	m.messageInput.SetValue(draft.Body)
+	m.err = nil
+	m.successMsg = ""
+
+	// Older autosave loops stop at their next tick
+	m.draft.start(draft)
+	m.draftGen++
+	return m, tea.Batch(m.messageInput.Focus(), autosaveDraft(m.draftGen))
+}
+
+// leaveCompose saves what was written as a draft and returns to the main
+// menu.
+func (m model) leaveCompose() (tea.Model, tea.Cmd) {
+	kept, err := m.draft.save(false)
+	if err != nil {
+		m.err = fmt.Errorf("saving draft: %w", err)
+		return m, nil
+	}
+	m.draft.stop()
+
+	m.currentScreen = mainMenu
+	m.recipient = ""
+	m.recipientGroup = nil
+	m.composePreview = false
+	m.err = nil
+	m.successMsg = ""
+	if kept {
+		m.successMsg = "Draft saved"
+	}
+	m.refreshDraftCounts()
+	return m, nil
+}
+
+// refreshDraftCounts updates the numbers of drafts and scheduled messages
+// the main menu shows.
+func (m *model) refreshDraftCounts() {
+	drafts, err := m.db.GetDrafts(m.userKey)
+	if err != nil {
+		m.err = err
+		return
+	}
+	scheduled, err := m.db.GetScheduledMessages(m.userKey)
+	if err != nil {
+		m.err = err
+		return
+	}
+	m.draftCount = len(drafts)
+	m.scheduledCount = len(scheduled)
+}
+
+func (m model) openDrafts() (tea.Model, tea.Cmd) {
+	m.currentScreen = draftsScreen
+	m.draftsTab = draftsTabDrafts
+	m.selectedDraft = 0
+	m.selectedScheduled = 0
+	m.selectedSent = 0
+	m.err = nil
+	m.successMsg = ""
+	return m.reloadDrafts()
+}
+
+// reloadDrafts loads every tab of the drafts screen.
+func (m model) reloadDrafts() (tea.Model, tea.Cmd) {
+	drafts, err := m.db.GetDrafts(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	scheduled, err := m.db.GetScheduledMessages(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	sent, err := m.db.GetSentMessages(m.userKey, sentMessagesLimit)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	groupNames, err := m.db.GetGroupNames()
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.groupNames = groupNames
+	m.drafts = drafts
+	m.draftCount = len(drafts)
+	if m.selectedDraft >= len(drafts) {
+		m.selectedDraft = max(len(drafts)-1, 0)
+	}
+	m.scheduled = scheduled
+	m.scheduledCount = len(scheduled)
+	if m.selectedScheduled >= len(scheduled) {
+		m.selectedScheduled = max(len(scheduled)-1, 0)
+	}
+	m.sentMessages = sent
+	if m.selectedSent >= len(sent) {
+		m.selectedSent = max(len(sent)-1, 0)
+	}
+	return m, nil
+}
+
+// closeEdit goes back from changing a scheduled or sent message to the tab
+// it was chosen from.
+func (m *model) closeEdit() {
+	m.currentScreen = draftsScreen
+	m.editingScheduled = nil
+	m.editingSent = nil
+	m.recipient = ""
+	m.recipientGroup = nil
+	m.composePreview = false
+	m.err = nil
+	m.successMsg = ""
+}
+
+func (m model) updateDrafts(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = mainMenu
+		m.err = nil
+		m.successMsg = ""
+		return m, nil
+
+	case m.keys.matches(msg, keySwitchTab):
+		m.draftsTab = (m.draftsTab + 1) % draftsTabCount
+		m.err = nil
+		m.successMsg = ""
+		return m.reloadDrafts()
+	}
+
+	switch m.draftsTab {
+	case draftsTabScheduled:
+		return m.updateScheduled(msg)
+	case draftsTabSent:
+		return m.updateSent(msg)
+	}
+
+	switch {
+	case m.keys.matches(msg, keyDown):
+		if len(m.drafts) > 0 {
+			m.selectedDraft = (m.selectedDraft + 1) % len(m.drafts)
+		}
+	case m.keys.matches(msg, keyUp):
+		if len(m.drafts) > 0 {
+			m.selectedDraft = (m.selectedDraft - 1 + len(m.drafts)) % len(m.drafts)
+		}
+
+	case m.keys.matches(msg, keySelect, keyEdit):
+		if len(m.drafts) == 0 {
+			return m, nil
+		}
+		return m.resumeDraft(m.drafts[m.selectedDraft])
+
+	case m.keys.matches(msg, keyDelete):
+		if len(m.drafts) == 0 {
+			return m, nil
+		}
+		draft := m.drafts[m.selectedDraft]
+		if err := m.db.DeleteDraft(draft.ID, m.userKey); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.successMsg = "Draft discarded"
+		m.err = nil
+		return m.reloadDrafts()
+	}
+	return m, nil
+}
+
+func (m model) viewDrafts() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("🗒  Drafts")
+	s.WriteString(title)
+	s.WriteString("\n")
+
+	// Drafts / scheduled / sent tabs
+	activeTab := m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Underline(true)
+	inactiveTab := m.renderer.NewStyle().Foreground(st.mutedColor)
+	tabs := make([]string, len(draftsTabNames))
+	for i, name := range draftsTabNames {
+		tabs[i] = inactiveTab.Render(name)
+		if i == m.draftsTab {
+			tabs[i] = activeTab.Render(name)
+		}
+	}
+	s.WriteString("  " + strings.Join(tabs, "   "))
+	s.WriteString("\n\n")
+
+	switch m.draftsTab {
+	case draftsTabScheduled:
+		m.viewScheduled(&s)
+		return s.String()
+	case draftsTabSent:
+		m.viewSent(&s)
+		return s.String()
+	}
+
+	if len(m.drafts) == 0 {
+		s.WriteString(st.emptyStateStyle.Width(m.contentWidth()).Render("No drafts.\n\nMessages you leave with " + m.keys.hint(keyLeaveCompose) + "\nbefore sending are kept here."))
+		s.WriteString("\n")
+	}
+
+	visible := 10
+	if m.height > 0 {
+		visible = max(m.height-draftsChrome, 1)
+	}
+	startIdx, endIdx := carouselWindow(m.selectedDraft, len(m.drafts), visible)
+	lineWidth := m.contentWidth() - 4
+	for i := startIdx; i < endIdx; i++ {
+		draft := m.drafts[i]
+		when := m.formatTime(draft.UpdatedAt, timeShort)
+		to := ansi.Truncate(draft.Recipient, 16, "…")
+		snippet := strings.Join(strings.Fields(draft.Body), " ")
+		snippet = ansi.Truncate(snippet, max(lineWidth-18-len(when)-2, 0), "…")
+		gap := strings.Repeat(" ", max(lineWidth-18-ansi.StringWidth(snippet)-len(when), 1))
+		line := fmt.Sprintf("%-16s  %s%s%s", to, snippet, gap, when)
+		if i == m.selectedDraft {
+			indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+			s.WriteString("  " + indicator + m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Render(line))
+		} else {
+			s.WriteString("    " + m.renderer.NewStyle().Foreground(st.textColor).Render(line))
+		}
+		s.WriteString("\n")
+	}
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.Width(m.contentWidth()).Render(m.keyHint(keySelect, "to resume") + " • " + m.keyHint(keyDelete, "to discard") + " • " + m.keyHint(keySwitchTab, "for scheduled") + " • " + m.navHint() + " • " + m.keyHint(keyBack, "to return")))
+
+	return s.String()
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// How long after sending messages can be changed, unless
+// SOSHIAL_EDIT_WINDOW says otherwise
+const defaultEditWindow = 15 * time.Minute
+
+// How many sent messages the sent tab lists
+const sentMessagesLimit = 50
+
+// messageChangedMsg tells a recipient's sessions that the sender edited or
+// unsent a message.
+type messageChangedMsg struct {
+	msg    Message
+	unsent bool
+}
+
+// changeableUntil reports whether the user may still edit or unsend a
+// message they sent, and until when. The time is zero when only reading
+// the message ends the chance.
+func (m model) changeableUntil(msg Message) (time.Time, bool) {
+	if msg.Read {
+		return time.Time{}, false
+	}
+	if m.editWindow == 0 {
+		return time.Time{}, true
+	}
+	until := msg.Timestamp.Add(m.editWindow)
+	return until, time.Now().Before(until)
+}
+
+// sentRecipient names who a sent message went to.
+func (m model) sentRecipient(msg Message) string {
+	if name, ok := m.groupNames[msg.GroupID]; ok {
+		return "#" + name
+	}
+	return msg.ToKey
+}
+
+// notifyMessageChanged tells the recipients of an edited or unsent message,
+// and their webhooks, about the change.
+func (m model) notifyMessageChanged(copies []Message, unsent bool) {
+	event := eventMessageEdited
+	if unsent {
+		event = eventMessageUnsent
+	}
+	for _, msg := range copies {
+		go m.webhookSender.Emit(event, msg.ToKey, msg)
+		m.presence.Send(msg.ToKey, messageChangedMsg{msg: msg, unsent: unsent})
+	}
+}
+
+// openSentEdit changes the text of a message that nobody has read yet.
+func (m model) openSentEdit(msg Message) (tea.Model, tea.Cmd) {
+	if msg.Read {
+		m.err = fmt.Errorf("the message has already been read")
+		return m, nil
+	}
+	if _, ok := m.changeableUntil(msg); !ok {
+		m.err = fmt.Errorf("messages can only be changed for %s after sending", formatDuration(m.editWindow))
+		return m, nil
+	}
+
+	m.currentScreen = sendMessageContent
+	m.recipient = m.sentRecipient(msg)
+	m.recipientGroup = nil
+	m.composePreview = false
+	m.editingSent = &msg
+	m.messageInput.SetValue(msg.Message)
+	m.draftGen++ // Stops autosaving whatever was written before
+	m.err = nil
+	m.successMsg = ""
+	return m, m.messageInput.Focus()
+}
+
+// saveSentEdit stores the new text of the message being changed and goes
+// back to the sent messages.
+func (m model) saveSentEdit() (tea.Model, tea.Cmd) {
+	message := m.messageInput.Value()
+	if strings.TrimSpace(message) == "" {
+		m.err = fmt.Errorf("message cannot be empty, unsend it instead")
+		return m, m.messageInput.Focus()
+	}
+	if message == m.editingSent.Message {
+		m.closeEdit()
+		return m.reloadDrafts()
+	}
+
+	copies, err := m.db.EditMessage(m.editingSent.ID, m.userKey, message, m.editWindow)
+	if err != nil {
+		m.err = err
+		return m, m.messageInput.Focus()
+	}
+	m.notifyMessageChanged(copies, false)
+
+	m.closeEdit()
+	m.successMsg = "Message edited"
+	return m.reloadDrafts()
+}
+
+func (m model) updateSent(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case m.keys.matches(msg, keyDown):
+		if len(m.sentMessages) > 0 {
+			m.selectedSent = (m.selectedSent + 1) % len(m.sentMessages)
+		}
+		m.err = nil
+		m.successMsg = ""
+	case m.keys.matches(msg, keyUp):
+		if len(m.sentMessages) > 0 {
+			m.selectedSent = (m.selectedSent - 1 + len(m.sentMessages)) % len(m.sentMessages)
+		}
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keySelect, keyEdit):
+		if len(m.sentMessages) == 0 {
+			return m, nil
+		}
+		return m.openSentEdit(m.sentMessages[m.selectedSent])
+
+	case m.keys.matches(msg, keyDelete):
+		if len(m.sentMessages) == 0 {
+			return m, nil
+		}
+		sent := m.sentMessages[m.selectedSent]
+		copies, err := m.db.UnsendMessage(sent.ID, m.userKey, m.editWindow)
+		if err != nil {
+			m.err = err
+			m.successMsg = ""
+			return m, nil
+		}
+		m.notifyMessageChanged(copies, true)
+		m.successMsg = "Message unsent"
+		m.err = nil
+		return m.reloadDrafts()
+	}
+	return m, nil
+}
+
+func (m model) viewSent(s *strings.Builder) {
+	st := m.getStyles()
+
+	if len(m.sentMessages) == 0 {
+		s.WriteString(st.emptyStateStyle.Width(m.contentWidth()).Render("Nothing sent yet.\n\nMessages you send show up here, and\ncan be changed until they are read."))
+		s.WriteString("\n")
+	}
+
+	visible := 10
+	if m.height > 0 {
+		visible = max(m.height-draftsChrome, 1)
+	}
+	startIdx, endIdx := carouselWindow(m.selectedSent, len(m.sentMessages), visible)
+	lineWidth := m.contentWidth() - 4
+	for i := startIdx; i < endIdx; i++ {
+		sent := m.sentMessages[i]
+		when := m.formatTime(sent.Timestamp, timeShort)
+		to := ansi.Truncate(m.sentRecipient(sent), 16, "…")
+		snippet := strings.Join(strings.Fields(sent.Message), " ")
+		snippet = ansi.Truncate(snippet, max(lineWidth-18-len(when)-2, 0), "…")
+		gap := strings.Repeat(" ", max(lineWidth-18-ansi.StringWidth(snippet)-len(when), 1))
+		line := fmt.Sprintf("%-16s  %s%s", to, snippet, gap)
+		whenStyle := m.renderer.NewStyle().Foreground(st.mutedColor)
+		if _, ok := m.changeableUntil(sent); ok {
+			whenStyle = whenStyle.Foreground(st.accentColor)
+		}
+		if i == m.selectedSent {
+			indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+			s.WriteString("  " + indicator + m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Render(line) + whenStyle.Render(when))
+		} else {
+			s.WriteString("    " + m.renderer.NewStyle().Foreground(st.textColor).Render(line) + whenStyle.Render(when))
+		}
+		s.WriteString("\n")
+	}
+
+	// Success or error messages, or whether the selected message can still
+	// be changed
+	s.WriteString("\n")
+	switch {
+	case m.successMsg != "":
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	case m.err != nil:
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	case len(m.sentMessages) > 0:
+		sent := m.sentMessages[m.selectedSent]
+		status := "Can be changed until it is read"
+		if until, ok := m.changeableUntil(sent); !ok && sent.Read {
+			status = "Read, so it can no longer be changed"
+		} else if !ok {
+			status = "Can no longer be changed"
+		} else if !until.IsZero() {
+			status = "Can be changed until it is read, or " + m.formatTime(until, timeClock)
+		}
+		if !sent.EditedAt.IsZero() {
+			status += " • edited " + m.formatTime(sent.EditedAt, timeClock)
+		}
+		s.WriteString(m.renderer.NewStyle().Foreground(st.mutedColor).Width(m.contentWidth()).Render("  " + status))
+	}
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.Width(m.contentWidth()).Render(m.keyHint(keyEdit, "to edit") + " • " + m.keyHint(keyDelete, "to unsend") + " • " + m.keyHint(keySwitchTab, "for drafts") + " • " + m.navHint() + " • " + m.keyHint(keyBack, "to return")))
+}
+
+// handleMessageChanged updates a message its sender edited or unsent
+// wherever this session shows it.
+func (m model) handleMessageChanged(change messageChangedMsg) (tea.Model, tea.Cmd) {
+	for i := range m.messages {
+		if m.messages[i].ID != change.msg.ID {
+			continue
+		}
+		if !change.unsent {
+			m.messages[i] = change.msg
+			break
+		}
+		reading := m.currentScreen == readMessage && m.selectedMessage() == &m.messages[i]
+		m.removeMessage(i)
+		if reading {
+			m.currentScreen = viewMessages
+			m.successMsg = ""
+			m.err = fmt.Errorf("the sender unsent the message you were reading")
+		}
+		break
+	}
+	switch m.currentScreen {
+	case viewMessages, readMessage:
+		m.refreshMessageList()
+		m.refreshReader()
+	}
+
+	for i := range m.chatHistory {
+		if m.chatHistory[i].ID != change.msg.ID {
+			continue
+		}
+		if change.unsent {
+			m.chatHistory = append(m.chatHistory[:i], m.chatHistory[i+1:]...)
+		} else {
+			m.chatHistory[i] = change.msg
+		}
+		atBottom := m.chatViewport.AtBottom()
+		m.chatViewport.SetContent(m.renderChatHistory())
+		if atBottom {
+			m.chatViewport.GotoBottom()
+		}
+		break
+	}
+
+	return m, tea.Batch(m.loadMessageCount(), m.updateWindowTitle())
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/scp"
+)
+
+const exportVersion = 1
+
+type exportFormat string
+
+const (
+	exportJSON     exportFormat = "json"
+	exportMbox     exportFormat = "mbox"
+	exportMarkdown exportFormat = "markdown"
+)
+
+// exportFiles maps the file names offered over SCP to their format.
+var exportFiles = map[string]exportFormat{
+	"messages.json": exportJSON,
+	"messages.mbox": exportMbox,
+	"messages.md":   exportMarkdown,
+}
+
+// mailboxExport is the JSON document produced by an export and accepted by
+// an import.
+type mailboxExport struct {
+	Version     int       `json:"version"`
+	Fingerprint string    `json:"fingerprint"`
+	ExportedAt  time.Time `json:"exported_at"`
+	Messages    []Message `json:"messages"`
+}
+
+func parseExportFormat(s string) (exportFormat, error) {
+	switch strings.ToLower(s) {
+	case "", "json":
+		return exportJSON, nil
+	case "mbox":
+		return exportMbox, nil
+	case "md", "markdown":
+		return exportMarkdown, nil
+	}
+	return "", fmt.Errorf("unknown export format %q (use json, mbox or markdown)", s)
+}
+
+// writeExport renders every message the user sent or received in the given
+// format.
+func writeExport(w io.Writer, db *Database, fingerprint string, format exportFormat) error {
+	messages, err := db.GetAllMessagesForUser(fingerprint)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case exportJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(mailboxExport{
+			Version:     exportVersion,
+			Fingerprint: fingerprint,
+			ExportedAt:  time.Now().UTC(),
+			Messages:    messages,
+		})
+	case exportMbox:
+		return writeMbox(w, messages)
+	case exportMarkdown:
+		return writeMarkdown(w, fingerprint, messages)
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+func writeMbox(w io.Writer, messages []Message) error {
+	for _, msg := range messages {
+		var b strings.Builder
+		fmt.Fprintf(&b, "From %s@soshial %s\n", msg.FromKey, msg.Timestamp.UTC().Format(time.ANSIC))
+		fmt.Fprintf(&b, "From: %s@soshial\n", msg.FromKey)
+		fmt.Fprintf(&b, "To: %s@soshial\n", msg.ToKey)
+		fmt.Fprintf(&b, "Date: %s\n", msg.Timestamp.Format(time.RFC1123Z))
+		fmt.Fprintf(&b, "Subject: %s\n", messageSubject(msg.Message))
+		fmt.Fprintf(&b, "Message-ID: <%d@soshial>\n", msg.ID)
+		if msg.Read {
+			b.WriteString("Status: RO\n")
+		} else {
+			b.WriteString("Status: O\n")
+		}
+		b.WriteString("Content-Type: text/plain; charset=utf-8\n\n")
+
+		for _, line := range strings.Split(msg.Message, "\n") {
+			// mboxrd quoting: escape body lines that look like a From_ line
+			if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+				line = ">" + line
+			}
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeMarkdown(w io.Writer, fingerprint string, messages []Message) error {
+	var b strings.Builder
+	b.WriteString("# SoSHial mailbox\n\n")
+	fmt.Fprintf(&b, "- Fingerprint: `%s`\n", fingerprint)
+	fmt.Fprintf(&b, "- Exported: %s\n", time.Now().UTC().Format("Mon, Jan 2 2006 at 15:04 MST"))
+	fmt.Fprintf(&b, "- Messages: %d\n", len(messages))
+
+	for _, msg := range messages {
+		direction := "Received"
+		if msg.FromKey == fingerprint {
+			direction = "Sent"
+		}
+		fmt.Fprintf(&b, "\n## %s — %s\n\n", direction, msg.Timestamp.UTC().Format("Mon, Jan 2 2006 at 15:04 MST"))
+		fmt.Fprintf(&b, "**From:** `%s`  \n", msg.FromKey)
+		fmt.Fprintf(&b, "**To:** `%s`\n\n", msg.ToKey)
+		for _, line := range strings.Split(msg.Message, "\n") {
+			b.WriteString("> ")
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// messageSubject uses the first line of a message as its subject.
+func messageSubject(message string) string {
+	subject, _, _ := strings.Cut(message, "\n")
+	subject = strings.TrimSpace(subject)
+	if len([]rune(subject)) > 60 {
+		subject = string([]rune(subject)[:57]) + "..."
+	}
+	return subject
+}
+
+// readImport decodes a JSON export and checks that it belongs to the
+// importing user.
+func readImport(r io.Reader, fingerprint string) ([]Message, error) {
+	var export mailboxExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, fmt.Errorf("invalid export: %w", err)
+	}
+	if export.Version != exportVersion {
+		return nil, fmt.Errorf("unsupported export version %d", export.Version)
+	}
+	if export.Fingerprint != fingerprint {
+		return nil, fmt.Errorf("export belongs to %s, not to your key", export.Fingerprint)
+	}
+
+	for _, msg := range export.Messages {
+		if msg.FromKey != fingerprint && msg.ToKey != fingerprint {
+			return nil, fmt.Errorf("message %d does not involve your key", msg.ID)
+		}
+	}
+	return export.Messages, nil
+}
+
+// sentCount counts the messages the user sent to someone else.
+func sentCount(messages []Message, fingerprint string) int {
+	sent := 0
+	for _, msg := range messages {
+		if msg.ToKey != fingerprint {
+			sent++
+		}
+	}
+	return sent
+}
+
+// exportMiddleware serves the non-interactive "export" and "import" commands:
+//
+//	ssh -p 2222 host export [json|mbox|markdown] > messages.json
+//	ssh -p 2222 host import < messages.json
+func exportMiddleware(db *Database) wish.Middleware {
+	return func(next ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if len(cmd) == 0 || (cmd[0] != "export" && cmd[0] != "import") {
+				next(s)
+				return
+			}
+
+			pubKey := s.PublicKey()
+			if pubKey == nil {
+				wish.Fatalln(s, "no public key found")
+				return
+			}
+			fingerprint := fingerprintFor(pubKey)
+
+			switch cmd[0] {
+			case "export":
+				var arg string
+				if len(cmd) > 1 {
+					arg = cmd[1]
+				}
+				format, err := parseExportFormat(arg)
+				if err != nil {
+					wish.Fatalln(s, err)
+					return
+				}
+				if err := writeExport(s, db, fingerprint, format); err != nil {
+					wish.Fatalln(s, fmt.Sprintf("export failed: %v", err))
+					return
+				}
+
+			case "import":
+				messages, err := readImport(s, fingerprint)
+				if err != nil {
+					wish.Fatalln(s, err)
+					return
+				}
+				if err := db.UpsertUser(fingerprint); err != nil {
+					wish.Fatalln(s, fmt.Sprintf("failed to update user: %v", err))
+					return
+				}
+				imported, err := db.ImportMessages(fingerprint, messages)
+				if err != nil {
+					wish.Fatalln(s, fmt.Sprintf("import failed: %v", err))
+					return
+				}
+				wish.Printf(s, "Imported %d of %d messages\n", imported, len(messages))
+				if sent := sentCount(messages, fingerprint); sent > 0 {
+					wish.Printf(s, "Skipped %d messages you sent, which only their recipients can import\n", sent)
+				}
+			}
+		}
+	}
+}
+
+// exportSCPHandler offers a user's mailbox as read-only files over SCP:
+//
+//	scp -P 2222 host:messages.json .
+type exportSCPHandler struct {
+	db *Database
+}
+
+var _ scp.CopyToClientHandler = &exportSCPHandler{}
+
+func (h *exportSCPHandler) Glob(_ ssh.Session, s string) ([]string, error) {
+	return []string{s}, nil
+}
+
+func (h *exportSCPHandler) WalkDir(_ ssh.Session, _ string, _ fs.WalkDirFunc) error {
+	return fmt.Errorf("recursive copy is not supported; use one of messages.json, messages.mbox or messages.md")
+}
+
+func (h *exportSCPHandler) NewDirEntry(_ ssh.Session, name string) (*scp.DirEntry, error) {
+	return nil, fmt.Errorf("%s: not a directory", name)
+}
+
+func (h *exportSCPHandler) NewFileEntry(s ssh.Session, name string) (*scp.FileEntry, func() error, error) {
+	name = path.Base(name)
+	format, ok := exportFiles[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("%s: no such file; use one of messages.json, messages.mbox or messages.md", name)
+	}
+	if s.PublicKey() == nil {
+		return nil, nil, fmt.Errorf("no public key found")
+	}
+
+	var buf bytes.Buffer
+	if err := writeExport(&buf, h.db, fingerprintFor(s.PublicKey()), format); err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now().Unix()
+	return &scp.FileEntry{
+		Name:     name,
+		Filepath: name,
+		Mode:     0o600,
+		Size:     int64(buf.Len()),
+		Reader:   &buf,
+		Mtime:    now,
+		Atime:    now,
+	}, nil, nil
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	roleOwner  = "owner"
+	roleMember = "member"
+)
+
+// Group names are short enough that they can never be mistaken for a key
+// fingerprint in the recipient step.
+var groupNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{1,31}$`)
+
+func validateGroupName(name string) error {
+	if !groupNameRe.MatchString(name) {
+		return fmt.Errorf("group names are 2-32 letters, digits, '.', '_' or '-'")
+	}
+	return nil
+}
+
+// resolveGroupRecipient looks up the group a recipient refers to. Group
+// names may be written with or without a leading '#'. It returns nil if the
+// recipient is not a group the user belongs to.
+func (m model) resolveGroupRecipient(recipient string) (*Group, error) {
+	name := strings.TrimPrefix(recipient, "#")
+	if validateGroupName(name) != nil {
+		if strings.HasPrefix(recipient, "#") {
+			return nil, fmt.Errorf("%q is not a valid group name", recipient)
+		}
+		return nil, nil
+	}
+
+	group, err := m.db.GetGroupForUser(name, m.userKey)
+	if err != nil {
+		return nil, err
+	}
+	if group == nil {
+		if strings.HasPrefix(recipient, "#") {
+			return nil, fmt.Errorf("you are not a member of a group named %q", name)
+		}
+		return nil, nil
+	}
+	if group.Pending {
+		return nil, fmt.Errorf("accept the invitation to #%s before sending to it", group.Name)
+	}
+	return group, nil
+}
+
+func (m model) openGroups() (tea.Model, tea.Cmd) {
+	m.currentScreen = groupList
+	m.selectedGroup = 0
+	m.namingGroup = false
+	m.err = nil
+	m.successMsg = ""
+	return m.reloadGroups()
+}
+
+func (m model) reloadGroups() (tea.Model, tea.Cmd) {
+	groups, err := m.db.GetGroupsForUser(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.groups = groups
+	if m.selectedGroup >= len(groups) {
+		m.selectedGroup = max(len(groups)-1, 0)
+	}
+	return m, nil
+}
+
+func (m model) updateGroupList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	if m.namingGroup {
+		switch msg.String() {
+		case "esc":
+			m.namingGroup = false
+			m.groupNameInput.Blur()
+			m.err = nil
+			return m, nil
+
+		case "enter":
+			name := strings.TrimPrefix(strings.TrimSpace(m.groupNameInput.Value()), "#")
+			if err := validateGroupName(name); err != nil {
+				m.err = err
+				return m, nil
+			}
+			if _, err := m.db.CreateGroup(name, m.userKey); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.namingGroup = false
+			m.groupNameInput.Blur()
+			m.successMsg = fmt.Sprintf("Group #%s created • open it to invite members", name)
+			m.err = nil
+			return m.reloadGroups()
+		}
+
+		m.groupNameInput, cmd = m.groupNameInput.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = mainMenu
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keyDown):
+		if len(m.groups) > 0 {
+			m.selectedGroup = (m.selectedGroup + 1) % len(m.groups)
+		}
+	case m.keys.matches(msg, keyUp):
+		if len(m.groups) > 0 {
+			m.selectedGroup = (m.selectedGroup - 1 + len(m.groups)) % len(m.groups)
+		}
+
+	case m.keys.matches(msg, keyNew):
+		m.namingGroup = true
+		m.groupNameInput.SetValue("")
+		m.err = nil
+		m.successMsg = ""
+		return m, m.groupNameInput.Focus()
+
+	case m.keys.matches(msg, keyAccept):
+		if len(m.groups) == 0 || !m.groups[m.selectedGroup].Pending {
+			return m, nil
+		}
+		group := m.groups[m.selectedGroup]
+		if err := m.db.AcceptGroupInvite(group.ID, m.userKey); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.successMsg = fmt.Sprintf("You joined #%s", group.Name)
+		m.err = nil
+		return m.reloadGroups()
+
+	case m.keys.matches(msg, keySelect):
+		if len(m.groups) == 0 {
+			return m, nil
+		}
+		group := m.groups[m.selectedGroup]
+		return m.openGroupDetail(&group)
+	}
+	return m, nil
+}
+
+func (m model) openGroupDetail(group *Group) (tea.Model, tea.Cmd) {
+	m.currentScreen = groupDetail
+	m.currentGroup = group
+	m.selectedGroupMember = 0
+	m.invitingMember = false
+	m.err = nil
+	m.successMsg = ""
+	return m.reloadGroupMembers()
+}
+
+func (m model) reloadGroupMembers() (tea.Model, tea.Cmd) {
+	group, err := m.db.GetGroupForUser(m.currentGroup.Name, m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	if group == nil {
+		// We left, or were removed from, the group
+		m.currentGroup = nil
+		m.currentScreen = groupList
+		return m.reloadGroups()
+	}
+	m.currentGroup = group
+
+	members, err := m.db.GetGroupMembers(group.ID)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.groupMembers = members
+	if m.selectedGroupMember >= len(members) {
+		m.selectedGroupMember = max(len(members)-1, 0)
+	}
+	return m, nil
+}
+
+func (m model) updateGroupDetail(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	group := m.currentGroup
+	isOwner := group.Role == roleOwner && !group.Pending
+
+	if m.invitingMember {
+		switch msg.String() {
+		case "esc":
+			m.invitingMember = false
+			m.groupInviteInput.Blur()
+			m.err = nil
+			return m, nil
+
+		case "enter":
+			key := strings.TrimSpace(m.groupInviteInput.Value())
+			if key == "" {
+				m.err = fmt.Errorf("fingerprint cannot be empty")
+				return m, nil
+			}
+			exists, err := m.db.UserExists(key)
+			if err != nil {
+				m.err = err
+				return m, nil
+			}
+			if !exists {
+				m.err = fmt.Errorf("no user with that fingerprint has connected yet")
+				return m, nil
+			}
+			if err := m.db.InviteToGroup(group.ID, key); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.invitingMember = false
+			m.groupInviteInput.Blur()
+			m.successMsg = "Invitation sent"
+			m.err = nil
+			return m.reloadGroupMembers()
+		}
+
+		m.groupInviteInput, cmd = m.groupInviteInput.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentGroup = nil
+		m.groupMembers = nil
+		m.currentScreen = groupList
+		m.err = nil
+		m.successMsg = ""
+		return m.reloadGroups()
+
+	case m.keys.matches(msg, keyDown):
+		if len(m.groupMembers) > 0 {
+			m.selectedGroupMember = (m.selectedGroupMember + 1) % len(m.groupMembers)
+		}
+	case m.keys.matches(msg, keyUp):
+		if len(m.groupMembers) > 0 {
+			m.selectedGroupMember = (m.selectedGroupMember - 1 + len(m.groupMembers)) % len(m.groupMembers)
+		}
+
+	case m.keys.matches(msg, keyAccept):
+		if !group.Pending {
+			return m, nil
+		}
+		if err := m.db.AcceptGroupInvite(group.ID, m.userKey); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.successMsg = fmt.Sprintf("You joined #%s", group.Name)
+		m.err = nil
+		return m.reloadGroupMembers()
+
+	case m.keys.matches(msg, keyGroupSend):
+		if group.Pending {
+			m.err = fmt.Errorf("accept the invitation before sending to the group")
+			return m, nil
+		}
+		return m.openCompose("", group)
+
+	case m.keys.matches(msg, keyInvite):
+		if !isOwner {
+			m.err = fmt.Errorf("only owners can invite members")
+			return m, nil
+		}
+		m.invitingMember = true
+		m.groupInviteInput.SetValue("")
+		m.err = nil
+		m.successMsg = ""
+		return m, m.groupInviteInput.Focus()
+
+	case m.keys.matches(msg, keyToggleOwner):
+		if !isOwner || len(m.groupMembers) == 0 {
+			return m, nil
+		}
+		member := m.groupMembers[m.selectedGroupMember]
+		if member.MemberKey == m.userKey || member.Pending {
+			return m, nil
+		}
+		role, label := roleOwner, "is now an owner"
+		if member.Role == roleOwner {
+			role, label = roleMember, "is no longer an owner"
+		}
+		if err := m.db.SetGroupRole(group.ID, member.MemberKey, role); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.successMsg = fmt.Sprintf("%s... %s", member.MemberKey[:min(12, len(member.MemberKey))], label)
+		m.err = nil
+		return m.reloadGroupMembers()
+
+	case m.keys.matches(msg, keyRemoveMember):
+		if !isOwner || len(m.groupMembers) == 0 {
+			return m, nil
+		}
+		member := m.groupMembers[m.selectedGroupMember]
+		if member.MemberKey == m.userKey {
+			m.err = fmt.Errorf("press %s to leave the group", m.keys.hint(keyLeave))
+			return m, nil
+		}
+		if err := m.db.RemoveGroupMember(group.ID, member.MemberKey); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.successMsg = "Member removed"
+		m.err = nil
+		return m.reloadGroupMembers()
+
+	case m.keys.matches(msg, keyLeave):
+		if err := m.db.RemoveGroupMember(group.ID, m.userKey); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.currentGroup = nil
+		m.groupMembers = nil
+		m.currentScreen = groupList
+		if group.Pending {
+			m.successMsg = fmt.Sprintf("Declined the invitation to #%s", group.Name)
+		} else {
+			m.successMsg = fmt.Sprintf("You left #%s", group.Name)
+		}
+		m.err = nil
+		return m.reloadGroups()
+	}
+	return m, nil
+}
+
+func (m model) viewGroupList() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("👥  Groups")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	if m.namingGroup {
+		s.WriteString(st.inputLabelStyle.Render("Name your group"))
+		s.WriteString("\n\n")
+
+		// Error message (fixed height to keep bottom elements stable)
+		if m.err != nil {
+			s.WriteString(st.errorStyle.Render(" ✗ " + m.err.Error() + " "))
+		}
+		s.WriteString("\n\n")
+
+		input := st.inputBoxStyle.Width(m.contentWidth()).Render(m.groupNameInput.View())
+		s.WriteString(input)
+		s.WriteString("\n")
+		s.WriteString(st.helpStyle.Render("Press [enter] to create • [esc] to cancel"))
+		return s.String()
+	}
+
+	if len(m.groups) == 0 {
+		s.WriteString(st.emptyStateStyle.Width(m.contentWidth()).Render("You are not in any groups yet.\n\nCreate one and send to everyone in it\nby entering #name as the recipient."))
+		s.WriteString("\n")
+	} else {
+		for i, group := range m.groups {
+			members := "1 member"
+			if group.MemberCount != 1 {
+				members = fmt.Sprintf("%d members", group.MemberCount)
+			}
+			line := fmt.Sprintf("#%-32s %s", group.Name, members)
+
+			var badge string
+			if group.Pending {
+				badge = " " + st.newBadgeStyle.Render(" INVITED ")
+			} else if group.Role == roleOwner {
+				badge = " " + m.renderer.NewStyle().Foreground(st.mutedColor).Render("owner")
+			}
+
+			if i == m.selectedGroup {
+				indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+				s.WriteString("  " + indicator + m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Render(line) + badge)
+			} else {
+				s.WriteString("    " + m.renderer.NewStyle().Foreground(st.textColor).Render(line) + badge)
+			}
+			s.WriteString("\n")
+		}
+	}
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.Render(m.keyHint(keySelect, "to open") + " • " + m.keyHint(keyNew, "to create") + " • " + m.keyHint(keyAccept, "to accept invite") + " • " + m.navHint() + " • " + m.keyHint(keyBack, "to return")))
+
+	return s.String()
+}
+
+func (m model) viewGroupDetail() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	group := m.currentGroup
+	isOwner := group.Role == roleOwner && !group.Pending
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("👥  #" + group.Name)
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	if m.invitingMember {
+		s.WriteString(st.inputLabelStyle.Render("Invite a member by SSH key fingerprint"))
+		s.WriteString("\n\n")
+
+		// Error message (fixed height to keep bottom elements stable)
+		if m.err != nil {
+			s.WriteString(st.errorStyle.Render(" ✗ " + m.err.Error() + " "))
+		}
+		s.WriteString("\n\n")
+
+		input := st.inputBoxStyle.Width(m.contentWidth()).Render(m.groupInviteInput.View())
+		s.WriteString(input)
+		s.WriteString("\n")
+		s.WriteString(st.helpStyle.Render("Press [enter] to invite • [esc] to cancel"))
+		return s.String()
+	}
+
+	if group.Pending {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.highlight).Bold(true).Render("You have been invited to this group."))
+		s.WriteString("\n\n")
+	}
+
+	for i, member := range m.groupMembers {
+		line := member.MemberKey
+		if member.MemberKey == m.userKey {
+			line += " (you)"
+		}
+
+		var badge string
+		if member.Pending {
+			badge = " " + m.renderer.NewStyle().Foreground(st.mutedColor).Render("invited")
+		} else if member.Role == roleOwner {
+			badge = " " + m.renderer.NewStyle().Foreground(st.secondaryColor).Render("owner")
+		}
+
+		if i == m.selectedGroupMember {
+			indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+			s.WriteString("  " + indicator + m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Render(line) + badge)
+		} else {
+			s.WriteString("    " + m.renderer.NewStyle().Foreground(st.textColor).Render(line) + badge)
+		}
+		s.WriteString("\n")
+	}
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	var help string
+	switch {
+	case group.Pending:
+		help = m.keyHint(keyAccept, "to accept") + " • " + m.keyHint(keyLeave, "to decline") + " • " + m.keyHint(keyBack, "to return")
+	case isOwner:
+		help = m.keyHint(keyGroupSend, "to send") + " • " + m.keyHint(keyInvite, "to invite") + " • " + m.keyHint(keyToggleOwner, "to toggle owner") + " • " + m.keyHint(keyRemoveMember, "to remove") + " • " + m.keyHint(keyLeave, "to leave") + " • " + m.keyHint(keyBack, "to return")
+	default:
+		help = m.keyHint(keyGroupSend, "to send to the group") + " • " + m.keyHint(keyLeave, "to leave") + " • " + m.navHint() + " • " + m.keyHint(keyBack, "to return")
+	}
+	s.WriteString(st.helpStyle.Render(help))
+
+	return s.String()
+}
@@ -0,0 +1,578 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+const (
+	// Lines taken by the title, tabs, pane borders and status line, and by
+	// the title, box border, message header and status line. The help
+	// below them wraps on narrow terminals and is measured instead.
+	inboxChrome  = 11
+	readerChrome = 10
+
+	// With fewer spare lines than this the inbox drops the preview pane
+	inboxPreviewMinLines = 10
+
+	// Width of the sender column in the message list
+	inboxSenderWidth = 20
+)
+
+func (m model) openInbox() (tea.Model, tea.Cmd) {
+	messages, err := m.db.GetMessagesForUser(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.messages = messages
+
+	// Load bot IDs so their messages can be badged
+	botIDs, err := m.db.GetBotIDs()
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.botIDs = botIDs
+
+	// Load group names so group messages can be labelled
+	groupNames, err := m.db.GetGroupNames()
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.groupNames = groupNames
+
+	m.currentScreen = viewMessages
+	m.inboxUnreadOnly = false
+	m.selectedMessageIndex = 0
+	m.filterMessages()
+	m.err = nil
+	m.successMsg = ""
+	m.refreshMessageList()
+	m.messageList.GotoTop()
+	return m, nil
+}
+
+// filterMessages picks the messages the list shows. Messages read since the
+// filter was applied stay in the list until it is applied again, so the
+// reader can move between them.
+func (m *model) filterMessages() {
+	m.inboxRows = nil
+	for i, msg := range m.messages {
+		if !m.inboxUnreadOnly || !msg.Read {
+			m.inboxRows = append(m.inboxRows, i)
+		}
+	}
+	if m.selectedMessageIndex >= len(m.inboxRows) {
+		m.selectedMessageIndex = max(len(m.inboxRows)-1, 0)
+	}
+}
+
+// selectedMessage returns the message under the cursor, or nil if the list
+// is empty.
+func (m model) selectedMessage() *Message {
+	if m.selectedMessageIndex >= len(m.inboxRows) {
+		return nil
+	}
+	return &m.messages[m.inboxRows[m.selectedMessageIndex]]
+}
+
+// inboxPaneHeights returns the number of rows in the message list and of
+// lines in the preview pane below it, which is left out when space is short.
+func (m model) inboxPaneHeights() (list, preview int) {
+	if m.height == 0 {
+		return 8, 6
+	}
+	spare := m.height - inboxChrome - lipgloss.Height(m.getStyles().helpStyle.Render(m.inboxHelp()))
+	if spare < inboxPreviewMinLines {
+		// The preview's border lines go to the list
+		return max(spare+2, 3), 0
+	}
+	list = spare / 2
+	return list, spare - list
+}
+
+// refreshMessageList renders the list into its viewport and scrolls it so
+// the selected row is visible.
+func (m *model) refreshMessageList() {
+	height, _ := m.inboxPaneHeights()
+	m.messageList.Width = m.contentWidth() - 2
+	m.messageList.Height = height
+	m.messageList.SetContent(m.renderMessageRows())
+
+	if m.selectedMessageIndex < m.messageList.YOffset {
+		m.messageList.SetYOffset(m.selectedMessageIndex)
+	} else if m.selectedMessageIndex >= m.messageList.YOffset+height {
+		m.messageList.SetYOffset(m.selectedMessageIndex - height + 1)
+	}
+}
+
+func (m model) renderMessageRows() string {
+	st := m.getStyles()
+	width := m.messageList.Width
+
+	if len(m.inboxRows) == 0 {
+		empty := "📭 No messages yet! Your inbox is empty."
+		if m.inboxUnreadOnly {
+			empty = "📭 No unread messages • press u to show all"
+		}
+		return m.renderer.NewStyle().Foreground(st.mutedColor).Italic(true).Width(width).Align(lipgloss.Center).Render(empty)
+	}
+
+	// Narrow terminals lose the date column first
+	senderWidth := min(inboxSenderWidth, width/3)
+	dateWidth := len(m.timeLayoutFor(timeShort))
+	if width < 36+dateWidth {
+		dateWidth = 0
+	}
+	previewWidth := max(width-4-senderWidth-2-dateWidth-2, 0)
+
+	unreadStyle := m.renderer.NewStyle().Foreground(st.accentColor)
+	dateStyle := m.renderer.NewStyle().Foreground(st.mutedColor)
+	groupStyle := m.renderer.NewStyle().Foreground(st.secondaryColor)
+
+	rows := make([]string, len(m.inboxRows))
+	for row, i := range m.inboxRows {
+		msg := m.messages[i]
+		selected := row == m.selectedMessageIndex
+
+		textStyle := m.renderer.NewStyle().Foreground(st.textColor)
+		if selected {
+			textStyle = textStyle.Foreground(st.selectionColor).Bold(true)
+		} else if !msg.Read {
+			textStyle = textStyle.Bold(true)
+		}
+
+		indicator := "  "
+		if selected {
+			indicator = m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+		}
+		dot := "  "
+		if !msg.Read {
+			dot = unreadStyle.Render("● ")
+		}
+
+		sender := textStyle.Width(senderWidth).Render(ansi.Truncate(msg.FromKey, senderWidth, "…"))
+
+		// The first words of the message, after the group it went to
+		var preview string
+		if name, ok := m.groupNames[msg.GroupID]; ok {
+			label := ansi.Truncate("#"+name, previewWidth, "…")
+			preview = groupStyle.Render(label) + " "
+		}
+		snippet := ansi.Truncate(strings.Join(strings.Fields(msg.Message), " "), max(previewWidth-ansi.StringWidth(ansi.Strip(preview)), 0), "…")
+		preview += textStyle.UnsetBold().Render(snippet)
+		preview = m.renderer.NewStyle().Width(previewWidth).MaxWidth(previewWidth).Render(preview)
+
+		line := indicator + dot + sender + "  " + preview
+		if dateWidth > 0 {
+			line += "  " + dateStyle.Render(m.formatTime(msg.Timestamp, timeShort))
+		}
+		rows[row] = line
+	}
+	return strings.Join(rows, "\n")
+}
+
+// markMessageRead marks the i-th message read, telling webhooks about it.
+func (m *model) markMessageRead(i int) error {
+	msg := &m.messages[i]
+	if msg.Read {
+		return nil
+	}
+	if err := m.db.MarkMessageAsRead(msg.ID); err != nil {
+		return err
+	}
+	msg.Read = true
+	go m.webhookSender.Emit(eventMessageRead, msg.FromKey, *msg)
+	return nil
+}
+
+// deleteSelectedMessage deletes the message under the cursor and drops it
+// from the list.
+func (m *model) deleteSelectedMessage() error {
+	row := m.selectedMessageIndex
+	i := m.inboxRows[row]
+	if err := m.db.DeleteMessage(m.messages[i].ID); err != nil {
+		return err
+	}
+	m.removeMessage(i)
+	return nil
+}
+
+// removeMessage takes m.messages[i] out of the list, keeping the cursor on
+// the same message when another one goes.
+func (m *model) removeMessage(i int) {
+	m.messages = append(m.messages[:i], m.messages[i+1:]...)
+	rows := m.inboxRows[:0]
+	for r, j := range m.inboxRows {
+		switch {
+		case j == i:
+			if r < m.selectedMessageIndex {
+				m.selectedMessageIndex--
+			}
+			continue
+		case j > i:
+			j--
+		}
+		rows = append(rows, j)
+	}
+	m.inboxRows = rows
+	if m.selectedMessageIndex >= len(m.inboxRows) {
+		m.selectedMessageIndex = max(len(m.inboxRows)-1, 0)
+	}
+}
+
+func (m model) updateViewMessages(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	listHeight, _ := m.inboxPaneHeights()
+
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = mainMenu
+		m.messages = nil
+		m.inboxRows = nil
+		m.selectedMessageIndex = 0
+		m.err = nil
+		m.successMsg = ""
+		return m, nil
+
+	case m.keys.matches(msg, keyDown):
+		m.selectedMessageIndex = min(m.selectedMessageIndex+1, max(len(m.inboxRows)-1, 0))
+	case m.keys.matches(msg, keyUp):
+		m.selectedMessageIndex = max(m.selectedMessageIndex-1, 0)
+	case m.keys.matches(msg, keyPageDown):
+		m.selectedMessageIndex = min(m.selectedMessageIndex+listHeight, max(len(m.inboxRows)-1, 0))
+	case m.keys.matches(msg, keyPageUp):
+		m.selectedMessageIndex = max(m.selectedMessageIndex-listHeight, 0)
+	case m.keys.matches(msg, keyTop):
+		m.selectedMessageIndex = 0
+	case m.keys.matches(msg, keyBottom):
+		m.selectedMessageIndex = max(len(m.inboxRows)-1, 0)
+
+	case m.keys.matches(msg, keyUnreadOnly):
+		m.inboxUnreadOnly = !m.inboxUnreadOnly
+		m.selectedMessageIndex = 0
+		m.filterMessages()
+		m.messageList.GotoTop()
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keySelect):
+		if len(m.inboxRows) > 0 {
+			return m.openMessage(m.selectedMessageIndex)
+		}
+
+	case m.keys.matches(msg, keyReply):
+		if selected := m.selectedMessage(); selected != nil {
+			return m.replyTo(*selected)
+		}
+
+	case m.keys.matches(msg, keyToggleSource):
+		// Switch between rendered Markdown and the message source
+		m.rawMessages = !m.rawMessages
+
+	case m.keys.matches(msg, keyProfile):
+		if selected := m.selectedMessage(); selected != nil {
+			return m.openProfile(selected.FromKey)
+		}
+
+	case m.keys.matches(msg, keyDelete):
+		if len(m.inboxRows) > 0 {
+			if err := m.deleteSelectedMessage(); err != nil {
+				m.err = err
+				m.successMsg = ""
+				return m, nil
+			}
+			m.successMsg = "Message deleted"
+			m.err = nil
+			m.refreshMessageList()
+			return m, m.loadMessageCount()
+		}
+	}
+
+	m.refreshMessageList()
+	return m, nil
+}
+
+func (m model) viewMessagesScreen() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("✉  Your Messages")
+	s.WriteString(title)
+	s.WriteString("\n")
+
+	// All / unread tabs, with the position in the list on the right
+	unread := 0
+	for _, msg := range m.messages {
+		if !msg.Read {
+			unread++
+		}
+	}
+	activeTab := m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Underline(true)
+	inactiveTab := m.renderer.NewStyle().Foreground(st.mutedColor)
+	all, unreadOnly := activeTab.Render(fmt.Sprintf("All (%d)", len(m.messages))), inactiveTab.Render(fmt.Sprintf("Unread (%d)", unread))
+	if m.inboxUnreadOnly {
+		all, unreadOnly = inactiveTab.Render(fmt.Sprintf("All (%d)", len(m.messages))), activeTab.Render(fmt.Sprintf("Unread (%d)", unread))
+	}
+	tabs := "  " + all + "   " + unreadOnly
+	if len(m.inboxRows) > 0 {
+		position := m.renderer.NewStyle().Foreground(st.mutedColor).Render(fmt.Sprintf("%d of %d", m.selectedMessageIndex+1, len(m.inboxRows)))
+		tabs += strings.Repeat(" ", max(m.contentWidth()-lipgloss.Width(tabs)-lipgloss.Width(position), 1)) + position
+	}
+	s.WriteString(tabs)
+	s.WriteString("\n\n")
+
+	// Message list
+	list := m.renderer.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		BorderForeground(st.mutedColor).
+		Padding(0, 1).
+		Width(m.contentWidth()).
+		Render(m.messageList.View())
+	s.WriteString(list)
+	s.WriteString("\n")
+
+	// Preview of the selected message
+	if _, previewHeight := m.inboxPaneHeights(); previewHeight > 0 {
+		var preview string
+		if selected := m.selectedMessage(); selected != nil {
+			preview = m.renderMessagePreview(*selected, previewHeight)
+		}
+		box := m.renderer.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(st.accentColor).
+			Padding(0, 2).
+			Width(m.contentWidth()).
+			Height(previewHeight).
+			Render(preview)
+		s.WriteString(box)
+		s.WriteString("\n")
+	}
+
+	// Success or error messages (fixed height to keep bottom elements stable)
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+
+	s.WriteString(st.helpStyle.Render(m.inboxHelp()))
+
+	return s.String()
+}
+
+func (m model) inboxHelp() string {
+	filterHint := m.keyHint(keyUnreadOnly, "for unread only")
+	if m.inboxUnreadOnly {
+		filterHint = m.keyHint(keyUnreadOnly, "to show all")
+	}
+	return m.keyHint(keySelect, "to read") + " • " + filterHint + " • " + m.keyHint(keyReply, "to reply") + " • " + m.keyHint(keyProfile, "for profile") + " • " +
+		m.keyHint(keyDelete, "to delete") + " • " + m.keys.hint(keyPageUp) + "/" + m.keys.hint(keyPageDown) + " to page • " +
+		m.keys.hint(keyTop) + "/" + m.keys.hint(keyBottom) + " for top/bottom • " + m.keyHint(keyBack, "to return")
+}
+
+// messageHeader renders the sender and badges line and the date line shown
+// above a message body. Text for the right end of the date line is placed
+// against the edge of the body width.
+func (m model) messageHeader(msg Message, right string) string {
+	st := m.getStyles()
+
+	header := st.messageHeaderStyle.UnsetMarginBottom().Render(fmt.Sprintf("From: %s", msg.FromKey))
+	if m.botIDs[msg.FromKey] {
+		header += " " + st.botBadgeStyle.Render(" BOT ")
+	}
+	if !msg.Read {
+		header += " " + st.newBadgeStyle.Render(" NEW ")
+	}
+
+	timeStr := st.messageTimeStyle.Render(m.formatTime(msg.Timestamp, timeFull))
+	if !msg.EditedAt.IsZero() {
+		timeStr += m.renderer.NewStyle().Foreground(st.mutedColor).Italic(true).Render("  (edited)")
+	}
+	if name, ok := m.groupNames[msg.GroupID]; ok {
+		timeStr += m.renderer.NewStyle().Foreground(st.secondaryColor).Render("  to #" + name)
+	}
+	if right != "" {
+		spacing := max(m.bodyWidth()-lipgloss.Width(timeStr)-lipgloss.Width(right), 1)
+		timeStr += strings.Repeat(" ", spacing) + right
+	}
+	return header + "\n" + timeStr
+}
+
+// renderMessagePreview renders as much of msg as fits in height lines.
+func (m model) renderMessagePreview(msg Message, height int) string {
+	st := m.getStyles()
+
+	lines := []string{m.messageHeader(msg, "")}
+	body := m.messageBodyLines(msg.Message)
+	room := max(height-2, 0)
+	if len(body) > room {
+		body = body[:max(room-1, 0)]
+		body = append(body, m.renderer.NewStyle().Foreground(st.mutedColor).Italic(true).Render("… enter to read the rest"))
+	}
+	lines = append(lines, body...)
+	return strings.Join(lines, "\n")
+}
+
+// openMessage shows the message in the given list row in the reader and
+// marks it read.
+func (m model) openMessage(row int) (tea.Model, tea.Cmd) {
+	m.selectedMessageIndex = row
+	if err := m.markMessageRead(m.inboxRows[row]); err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.currentScreen = readMessage
+	m.err = nil
+	m.successMsg = ""
+	m.refreshReader()
+	m.messageViewport.GotoTop()
+	return m, m.updateWindowTitle()
+}
+
+// refreshReader fits the reader to the terminal and renders the selected
+// message into it.
+func (m *model) refreshReader() {
+	height := 15
+	if m.height > 0 {
+		height = max(m.height-readerChrome-lipgloss.Height(m.getStyles().helpStyle.Render(m.readerHelp())), 5)
+	}
+	m.messageViewport.Width = m.bodyWidth()
+	m.messageViewport.Height = height
+	if selected := m.selectedMessage(); selected != nil {
+		m.messageViewport.SetContent(strings.Join(m.messageBodyLines(selected.Message), "\n"))
+	}
+}
+
+func (m model) updateReadMessage(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case m.keys.matches(msg, keyBack):
+		// Messages read in the meantime leave the unread list now
+		m.currentScreen = viewMessages
+		m.filterMessages()
+		m.refreshMessageList()
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keyDown):
+		m.messageViewport.ScrollDown(1)
+	case m.keys.matches(msg, keyUp):
+		m.messageViewport.ScrollUp(1)
+	case m.keys.matches(msg, keyPageDown, keyScrollDown):
+		m.messageViewport.PageDown()
+	case m.keys.matches(msg, keyPageUp, keyScrollUp):
+		m.messageViewport.PageUp()
+	case m.keys.matches(msg, keyTop):
+		m.messageViewport.GotoTop()
+	case m.keys.matches(msg, keyBottom):
+		m.messageViewport.GotoBottom()
+
+	case m.keys.matches(msg, keyNextMessage):
+		if m.selectedMessageIndex < len(m.inboxRows)-1 {
+			return m.openMessage(m.selectedMessageIndex + 1)
+		}
+	case m.keys.matches(msg, keyPrevMessage):
+		if m.selectedMessageIndex > 0 {
+			return m.openMessage(m.selectedMessageIndex - 1)
+		}
+
+	case m.keys.matches(msg, keyReply):
+		if selected := m.selectedMessage(); selected != nil {
+			return m.replyTo(*selected)
+		}
+
+	case m.keys.matches(msg, keyToggleSource):
+		// Switch between rendered Markdown and the message source
+		m.rawMessages = !m.rawMessages
+		m.refreshReader()
+		m.messageViewport.GotoTop()
+
+	case m.keys.matches(msg, keyProfile):
+		if selected := m.selectedMessage(); selected != nil {
+			return m.openProfile(selected.FromKey)
+		}
+
+	case m.keys.matches(msg, keyDelete):
+		if err := m.deleteSelectedMessage(); err != nil {
+			m.err = err
+			m.successMsg = ""
+			return m, nil
+		}
+		if len(m.inboxRows) == 0 {
+			m.currentScreen = viewMessages
+			m.refreshMessageList()
+			m.successMsg = "Message deleted"
+			m.err = nil
+			return m, m.loadMessageCount()
+		}
+		updated, cmd := m.openMessage(m.selectedMessageIndex)
+		reader := updated.(model)
+		reader.successMsg = "Message deleted"
+		return reader, tea.Batch(cmd, m.loadMessageCount())
+	}
+	return m, nil
+}
+
+func (m model) viewReadMessage() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render(fmt.Sprintf("✉  Message %d of %d", m.selectedMessageIndex+1, len(m.inboxRows)))
+	s.WriteString(title)
+	s.WriteString("\n")
+
+	selected := m.selectedMessage()
+	if selected == nil {
+		return s.String()
+	}
+
+	// Where we are in a message longer than the screen
+	var position string
+	if m.messageViewport.TotalLineCount() > m.messageViewport.Height {
+		switch {
+		case m.messageViewport.AtTop():
+			position = "Top"
+		case m.messageViewport.AtBottom():
+			position = "Bottom"
+		default:
+			position = fmt.Sprintf("%d%%", int(m.messageViewport.ScrollPercent()*100))
+		}
+		position = m.renderer.NewStyle().Foreground(st.mutedColor).Render(position)
+	}
+
+	box := m.renderer.NewStyle().
+		Border(lipgloss.ThickBorder()).
+		BorderForeground(st.accentColor).
+		Padding(0, 2).
+		Width(m.contentWidth()).
+		Render(m.messageHeader(*selected, position) + "\n\n" + m.messageViewport.View())
+	s.WriteString(box)
+	s.WriteString("\n")
+
+	// Success or error messages (fixed height to keep bottom elements stable)
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+
+	s.WriteString(st.helpStyle.Render(m.readerHelp()))
+
+	return s.String()
+}
+
+func (m model) readerHelp() string {
+	viewHint := m.keyHint(keyToggleSource, "to view source")
+	if m.rawMessages {
+		viewHint = m.keyHint(keyToggleSource, "to render Markdown")
+	}
+	return m.keys.hint(keyScrollDown) + "/" + m.keys.hint(keyScrollUp) + " to page • " + m.keys.hint(keyPrevMessage) + "/" + m.keys.hint(keyNextMessage) + " for previous/next • " +
+		m.keyHint(keyReply, "to reply") + " • " + m.keyHint(keyProfile, "for profile") + " • " + viewHint + " • " + m.keyHint(keyDelete, "to delete") + " • " + m.keyHint(keyBack, "to return")
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/help"
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// keyAction names something a key does. The names are stored with users'
+// own bindings, so they must not change.
+type keyAction string
+
+const (
+	keyUp       keyAction = "up"
+	keyDown     keyAction = "down"
+	keyPageUp   keyAction = "page_up"
+	keyPageDown keyAction = "page_down"
+	keyTop      keyAction = "top"
+	keyBottom   keyAction = "bottom"
+	keySelect   keyAction = "select"
+	keyBack     keyAction = "back"
+	keyQuit     keyAction = "quit"
+	keyHelp     keyAction = "help"
+
+	keyNextMessage  keyAction = "next_message"
+	keyPrevMessage  keyAction = "prev_message"
+	keyScrollDown   keyAction = "scroll_down"
+	keyScrollUp     keyAction = "scroll_up"
+	keyReply        keyAction = "reply"
+	keyToggleSource keyAction = "toggle_source"
+	keyUnreadOnly   keyAction = "unread_only"
+
+	keyNew      keyAction = "new"
+	keyAdd      keyAction = "add"
+	keyDelete   keyAction = "delete"
+	keyEdit     keyAction = "edit"
+	keyCopy     keyAction = "copy"
+	keyTest     keyAction = "test"
+	keyRefresh  keyAction = "refresh"
+	keyProfile  keyAction = "profile"
+	keyMessage  keyAction = "message"
+	keyChat     keyAction = "chat"
+	keyJoinChat keyAction = "join_chat"
+
+	keySwitchTab keyAction = "switch_tab"
+	keyLike      keyAction = "like"
+	keyFollow    keyAction = "follow"
+
+	keyAccept       keyAction = "accept"
+	keyLeave        keyAction = "leave"
+	keyGroupSend    keyAction = "group_send"
+	keyInvite       keyAction = "invite"
+	keyToggleOwner  keyAction = "toggle_owner"
+	keyRemoveMember keyAction = "remove_member"
+
+	keyAddGlobal     keyAction = "add_global"
+	keyRateLimit     keyAction = "rate_limit"
+	keyNewToken      keyAction = "new_token"
+	keyEnterCode     keyAction = "enter_code"
+	keyFrequency     keyAction = "frequency"
+	keyRemoveAddress keyAction = "remove_address"
+
+	keySend         keyAction = "send"
+	keySchedule     keyAction = "schedule"
+	keyPreview      keyAction = "preview"
+	keyNewLine      keyAction = "new_line"
+	keyLeaveCompose keyAction = "leave_compose"
+)
+
+// keyActions lists every action in the order the keybindings screen shows
+// them, with the keys of the default preset.
+var keyActions = []struct {
+	action keyAction
+	desc   string
+	keys   []string
+}{
+	{keyUp, "move up", []string{"k", "up"}},
+	{keyDown, "move down", []string{"j", "down"}},
+	{keyPageUp, "page up", []string{"pgup", "ctrl+b"}},
+	{keyPageDown, "page down", []string{"pgdown", "ctrl+f"}},
+	{keyTop, "go to the top", []string{"g", "home"}},
+	{keyBottom, "go to the bottom", []string{"G", "end"}},
+	{keySelect, "select", []string{"enter", " "}},
+	{keyBack, "go back", []string{"esc", "q"}},
+	{keyQuit, "quit", []string{"q", "ctrl+c"}},
+	{keyHelp, "show all keys", []string{"?"}},
+
+	{keyNextMessage, "next message", []string{"right", "l"}},
+	{keyPrevMessage, "previous message", []string{"left", "h"}},
+	{keyScrollDown, "read on", []string{" ", "f"}},
+	{keyScrollUp, "read back", []string{"b"}},
+	{keyReply, "reply", []string{"r"}},
+	{keyToggleSource, "source or rendered", []string{"v"}},
+	{keyUnreadOnly, "unread or all", []string{"u"}},
+
+	{keyNew, "create", []string{"n"}},
+	{keyAdd, "add", []string{"a"}},
+	{keyDelete, "delete", []string{"d"}},
+	{keyEdit, "change", []string{"e"}},
+	{keyCopy, "copy", []string{"c"}},
+	{keyTest, "test", []string{"t"}},
+	{keyRefresh, "refresh", []string{"r"}},
+	{keyProfile, "profile", []string{"p"}},
+	{keyMessage, "send a message", []string{"m"}},
+	{keyChat, "chat", []string{"c"}},
+	{keyJoinChat, "join a chat", []string{"t"}},
+
+	{keySwitchTab, "switch tabs", []string{"tab"}},
+	{keyLike, "like", []string{"l"}},
+	{keyFollow, "follow or unfollow", []string{"f"}},
+
+	{keyAccept, "accept an invitation", []string{"a"}},
+	{keyLeave, "leave a group", []string{"l"}},
+	{keyGroupSend, "send to a group", []string{"s"}},
+	{keyInvite, "invite", []string{"i"}},
+	{keyToggleOwner, "make owner or member", []string{"o"}},
+	{keyRemoveMember, "remove a member", []string{"x"}},
+
+	{keyAddGlobal, "add a global webhook", []string{"g"}},
+	{keyRateLimit, "change a rate limit", []string{"r"}},
+	{keyNewToken, "new bot token", []string{"t"}},
+	{keyEnterCode, "enter a code", []string{"v"}},
+	{keyFrequency, "change frequency", []string{"f"}},
+	{keyRemoveAddress, "remove an address", []string{"r"}},
+
+	{keySend, "send, post or save", []string{"ctrl+s"}},
+	{keySchedule, "schedule", []string{"ctrl+t"}},
+	{keyPreview, "preview or edit", []string{"ctrl+r"}},
+	{keyNewLine, "new line in quick compose", []string{"alt+enter", "ctrl+j"}},
+	{keyLeaveCompose, "leave the editor", []string{"esc"}},
+}
+
+// keyPresets holds the keys each preset uses instead of the default ones.
+var keyPresets = map[string]map[keyAction][]string{
+	keyPresetDefault: {},
+	keyPresetVim: {
+		keyPageUp:      {"ctrl+u", "ctrl+b", "pgup"},
+		keyPageDown:    {"ctrl+d", "ctrl+f", "pgdown"},
+		keyNextMessage: {"J", "l", "right"},
+		keyPrevMessage: {"K", "h", "left"},
+		keyScrollDown:  {"ctrl+e", " "},
+		keyScrollUp:    {"ctrl+y", "b"},
+	},
+	keyPresetEmacs: {
+		keyUp:           {"ctrl+p", "up"},
+		keyDown:         {"ctrl+n", "down"},
+		keyPageUp:       {"alt+v", "pgup"},
+		keyPageDown:     {"ctrl+v", "pgdown"},
+		keyTop:          {"alt+<", "home"},
+		keyBottom:       {"alt+>", "end"},
+		keyBack:         {"ctrl+g", "esc", "q"},
+		keyNextMessage:  {"alt+n", "right"},
+		keyPrevMessage:  {"alt+p", "left"},
+		keyScrollDown:   {" "},
+		keyScrollUp:     {"backspace"},
+		keyLeaveCompose: {"ctrl+g", "esc"},
+	},
+}
+
+// screenKeys lists the actions each screen responds to outside of text
+// inputs, in the order the help overlay shows them.
+var screenKeys = map[screen][]keyAction{
+	mainMenu:            {keySelect, keyCopy, keyJoinChat, keyUp, keyDown, keyQuit, keyHelp},
+	viewMessages:        {keySelect, keyReply, keyProfile, keyToggleSource, keyUnreadOnly, keyDelete, keyUp, keyDown, keyPageUp, keyPageDown, keyTop, keyBottom, keyBack, keyHelp},
+	readMessage:         {keyNextMessage, keyPrevMessage, keyReply, keyProfile, keyToggleSource, keyDelete, keyUp, keyDown, keyScrollDown, keyScrollUp, keyPageUp, keyPageDown, keyTop, keyBottom, keyBack, keyHelp},
+	settingsMenu:        {keySelect, keyUp, keyDown, keyBack, keyHelp},
+	emailNotifications:  {keyEdit, keyEnterCode, keyFrequency, keyRemoveAddress, keyBack, keyHelp},
+	webhookSettings:     {keyAdd, keyAddGlobal, keyTest, keyEdit, keyCopy, keyDelete, keyUp, keyDown, keyBack, keyHelp},
+	apiTokenSettings:    {keyNew, keyDelete, keyUp, keyDown, keyBack, keyHelp},
+	botSettings:         {keyNew, keyRateLimit, keyNewToken, keyCopy, keyDelete, keyUp, keyDown, keyBack, keyHelp},
+	groupList:           {keySelect, keyNew, keyAccept, keyUp, keyDown, keyBack, keyHelp},
+	groupDetail:         {keyGroupSend, keyInvite, keyToggleOwner, keyRemoveMember, keyAccept, keyLeave, keyUp, keyDown, keyBack, keyHelp},
+	timeline:            {keyNew, keyLike, keyFollow, keyProfile, keyMessage, keyDelete, keySwitchTab, keyRefresh, keyUp, keyDown, keyBack, keyHelp},
+	profileSettings:     {keySelect, keyProfile, keyUp, keyDown, keyBack, keyHelp},
+	profileView:         {keyMessage, keyFollow, keyCopy, keyBack, keyHelp},
+	whosOnline:          {keyChat, keySelect, keyMessage, keyProfile, keyRefresh, keyUp, keyDown, keyBack, keyHelp},
+	alertSettingsScreen: {keySelect, keyTest, keyUp, keyDown, keyBack, keyHelp},
+	themePicker:         {keySelect, keyUp, keyDown, keyBack, keyHelp},
+	preferencesScreen:   {keySelect, keyUp, keyDown, keyBack, keyHelp},
+	keyBindingsScreen:   {keyUp, keyDown, keyBack, keyHelp},
+	draftsScreen:        {keySelect, keyEdit, keyDelete, keySwitchTab, keyUp, keyDown, keyBack, keyHelp},
+	sendMessageContent:  {keySend, keySchedule, keyPreview, keyNewLine, keyLeaveCompose},
+	composePost:         {keySend, keyLeaveCompose},
+}
+
+// navigationKeys are shown in their own column of the help overlay.
+var navigationKeys = map[keyAction]bool{
+	keyUp: true, keyDown: true, keyPageUp: true, keyPageDown: true, keyTop: true, keyBottom: true,
+	keyScrollDown: true, keyScrollUp: true, keyBack: true, keyQuit: true, keyHelp: true,
+}
+
+// keyMap holds the binding of every action for one session.
+type keyMap map[keyAction]key.Binding
+
+// newKeyMap builds the bindings of a preset with the user's own bindings,
+// by action name, on top.
+func newKeyMap(preset string, overrides map[string][]string) keyMap {
+	km := make(keyMap, len(keyActions))
+	for _, a := range keyActions {
+		keys := a.keys
+		if presetKeys, ok := keyPresets[preset][a.action]; ok {
+			keys = presetKeys
+		}
+		if own := overrides[string(a.action)]; len(own) > 0 {
+			keys = own
+		}
+		km[a.action] = key.NewBinding(key.WithKeys(keys...), key.WithHelp(keyNames(keys), a.desc))
+	}
+	return km
+}
+
+func (km keyMap) matches(msg tea.KeyMsg, actions ...keyAction) bool {
+	for _, action := range actions {
+		if key.Matches(msg, km[action]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hint returns the first key of an action as help text shows it.
+func (km keyMap) hint(action keyAction) string {
+	keys := km[action].Keys()
+	if len(keys) == 0 {
+		return "(unbound)"
+	}
+	return keyName(keys[0])
+}
+
+func keyName(k string) string {
+	switch k {
+	case " ":
+		return "space"
+	case "up":
+		return "↑"
+	case "down":
+		return "↓"
+	case "left":
+		return "←"
+	case "right":
+		return "→"
+	}
+	return k
+}
+
+func keyNames(keys []string) string {
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = keyName(k)
+	}
+	return strings.Join(names, "/")
+}
+
+func keyActionDesc(action keyAction) string {
+	for _, a := range keyActions {
+		if a.action == action {
+			return a.desc
+		}
+	}
+	return string(action)
+}
+
+// keyHint describes what an action's key does for help text, such as
+// "r to reply".
+func (m model) keyHint(action keyAction, text string) string {
+	return m.keys.hint(action) + " " + text
+}
+
+func (m model) navHint() string {
+	return m.keys.hint(keyDown) + "/" + m.keys.hint(keyUp) + " to navigate"
+}
+
+// keyConflict returns the action that already uses k on a screen where
+// action is also used.
+func (m model) keyConflict(action keyAction, k string) (keyAction, bool) {
+	for _, actions := range screenKeys {
+		if !containsAction(actions, action) {
+			continue
+		}
+		for _, other := range actions {
+			if other == action {
+				continue
+			}
+			for _, bound := range m.keys[other].Keys() {
+				if bound == k {
+					return other, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+func containsAction(actions []keyAction, action keyAction) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// textKey reports whether a key writes into a text input, so it can't
+// also be a command there.
+func textKey(msg tea.KeyMsg) bool {
+	switch msg.Type {
+	case tea.KeyRunes, tea.KeySpace, tea.KeyEnter, tea.KeyBackspace, tea.KeyTab:
+		return !msg.Alt
+	}
+	return false
+}
+
+// typing reports whether keys go to a text input, where they can't be
+// commands.
+func (m model) typing() bool {
+	switch m.currentScreen {
+	case sendMessageRecipient, sendMessageContent, composePost, chatScreen:
+		return true
+	case emailNotifications:
+		return m.emailStep != emailOverview
+	}
+	return m.editingTimezone || m.namingAPIToken || m.namingBot || m.namingGroup ||
+		m.invitingMember || m.addingWebhook || m.editingProfileField || m.capturingKey
+}
+
+// viewKeyHelp renders every key of the current screen, generated from the
+// session's bindings.
+func (m model) viewKeyHelp() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	title := st.titleStyle.Width(m.contentWidth()).Render("⌨  Keys")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	var actions, navigation []key.Binding
+	for _, action := range screenKeys[m.currentScreen] {
+		if navigationKeys[action] {
+			navigation = append(navigation, m.keys[action])
+		} else {
+			actions = append(actions, m.keys[action])
+		}
+	}
+	if m.currentScreen == keyBindingsScreen {
+		actions = append(actions, keyBindingsScreenKeys...)
+	}
+
+	h := help.New()
+	h.Width = m.contentWidth()
+	h.Styles.FullKey = m.renderer.NewStyle().Foreground(st.accentColor).Bold(true)
+	h.Styles.FullDesc = m.renderer.NewStyle().Foreground(st.textColor)
+	h.Styles.FullSeparator = m.renderer.NewStyle().Foreground(st.mutedColor)
+	h.Styles.Ellipsis = m.renderer.NewStyle().Foreground(st.mutedColor)
+	h.FullSeparator = "    "
+
+	// Side by side when the columns fit, one after the other otherwise
+	columns := m.renderer.NewStyle().PaddingLeft(2).Render(h.FullHelpView([][]key.Binding{actions, navigation}))
+	if lipgloss.Width(columns) > m.contentWidth() {
+		columns = h.FullHelpView([][]key.Binding{actions}) + "\n\n" + h.FullHelpView([][]key.Binding{navigation})
+	}
+	s.WriteString(columns)
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.Render("Press any key to close • change keys in Settings → Preferences"))
+	return s.String()
+}
+
+// keyBindingsScreenKeys are fixed so that rebinding can't lock anyone out.
+var keyBindingsScreenKeys = []key.Binding{
+	key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "choose a new key")),
+	key.NewBinding(key.WithKeys("backspace", "delete"), key.WithHelp("backspace", "back to the preset")),
+	key.NewBinding(key.WithKeys("tab"), key.WithHelp("tab", "change preset")),
+}
+
+func (m model) openKeyBindings() (tea.Model, tea.Cmd) {
+	m.currentScreen = keyBindingsScreen
+	m.selectedKeyAction = 0
+	m.capturingKey = false
+	m.err = nil
+	m.successMsg = ""
+	return m, nil
+}
+
+func (m model) updateKeyBindings(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	action := keyActions[m.selectedKeyAction].action
+
+	if m.capturingKey {
+		m.capturingKey = false
+		if msg.Type == tea.KeyEsc {
+			m.err = nil
+			m.successMsg = ""
+			return m, nil
+		}
+		k := msg.String()
+		if containsAction(screenKeys[sendMessageContent], action) && textKey(msg) {
+			m.err = fmt.Errorf("%s is needed for typing messages", keyName(k))
+			m.successMsg = ""
+			return m, nil
+		}
+		if other, ok := m.keyConflict(action, k); ok {
+			m.err = fmt.Errorf("%s already means %q", keyName(k), keyActionDesc(other))
+			m.successMsg = ""
+			return m, nil
+		}
+		if err := m.db.SetKeyBinding(m.userKey, string(action), []string{k}); err != nil {
+			m.err = err
+			m.successMsg = ""
+			return m, nil
+		}
+		m.keyOverrides[string(action)] = []string{k}
+		m.keys = newKeyMap(m.userSettings.KeyPreset, m.keyOverrides)
+		m.successMsg = fmt.Sprintf("%s now means %q", keyName(k), keyActionDesc(action))
+		m.err = nil
+		return m, nil
+	}
+
+	// Arrows and esc work whatever the bindings are
+	switch {
+	case msg.Type == tea.KeyEsc || m.keys.matches(msg, keyBack):
+		m.currentScreen = preferencesScreen
+		m.err = nil
+		m.successMsg = ""
+
+	case msg.Type == tea.KeyDown || m.keys.matches(msg, keyDown):
+		m.selectedKeyAction = (m.selectedKeyAction + 1) % len(keyActions)
+	case msg.Type == tea.KeyUp || m.keys.matches(msg, keyUp):
+		m.selectedKeyAction = (m.selectedKeyAction - 1 + len(keyActions)) % len(keyActions)
+
+	case key.Matches(msg, keyBindingsScreenKeys[0]):
+		m.capturingKey = true
+		m.err = nil
+		m.successMsg = ""
+
+	case key.Matches(msg, keyBindingsScreenKeys[1]):
+		if _, ok := m.keyOverrides[string(action)]; !ok {
+			return m, nil
+		}
+		if err := m.db.SetKeyBinding(m.userKey, string(action), nil); err != nil {
+			m.err = err
+			m.successMsg = ""
+			return m, nil
+		}
+		delete(m.keyOverrides, string(action))
+		m.keys = newKeyMap(m.userSettings.KeyPreset, m.keyOverrides)
+		m.successMsg = fmt.Sprintf("%q is back on %s", keyActionDesc(action), m.keys[action].Help().Key)
+		m.err = nil
+
+	case key.Matches(msg, keyBindingsScreenKeys[2]):
+		settings := m.userSettings
+		settings.KeyPreset = nextChoice(keyPresetChoices, settings.KeyPreset)
+		if err := m.saveUserSettings(settings); err != nil {
+			m.err = err
+			m.successMsg = ""
+			return m, nil
+		}
+		m.successMsg = choiceLabel(keyPresetChoices, settings.KeyPreset) + " keybindings"
+		m.err = nil
+	}
+	return m, nil
+}
+
+func (m model) viewKeyBindings() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("⌨  Keybindings")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	labelStyle := m.renderer.NewStyle().Width(24)
+	valueStyle := m.renderer.NewStyle().Foreground(st.textColor)
+	mutedStyle := m.renderer.NewStyle().Foreground(st.mutedColor)
+
+	s.WriteString("    " + labelStyle.Foreground(st.accentColor).Render("Preset") + valueStyle.Render(choiceLabel(keyPresetChoices, m.userSettings.KeyPreset)))
+	s.WriteString("\n\n")
+
+	help := st.helpStyle.Render("enter to rebind • backspace to reset • tab for another preset • esc to return")
+
+	// Title, preset and the status line take 9 lines
+	visible := 12
+	if m.height > 0 {
+		visible = max(m.height-9-lipgloss.Height(help), 3)
+	}
+	startIdx, endIdx := carouselWindow(m.selectedKeyAction, len(keyActions), visible)
+	for i := startIdx; i < endIdx; i++ {
+		a := keyActions[i]
+		keys := valueStyle.Render(m.keys[a.action].Help().Key)
+		if _, ok := m.keyOverrides[string(a.action)]; ok {
+			keys += mutedStyle.Italic(true).Render("  custom")
+		}
+		if i == m.selectedKeyAction {
+			if m.capturingKey {
+				keys = m.renderer.NewStyle().Foreground(st.accentColor).Render("press a key, esc to cancel")
+			}
+			indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+			s.WriteString("  " + indicator + labelStyle.Foreground(st.selectionColor).Bold(true).Render(a.desc) + keys)
+		} else {
+			s.WriteString("    " + labelStyle.Foreground(st.accentColor).Render(a.desc) + keys)
+		}
+		s.WriteString("\n")
+	}
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	s.WriteString(help)
+
+	return s.String()
+}
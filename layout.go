@@ -0,0 +1,105 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+const (
+	// Screens are drawn this wide until the terminal reports its size
+	defaultContentWidth = 70
+	minContentWidth     = 20
+	maxContentWidth     = 100
+
+	// Below these sizes the main menu drops the banner
+	compactWidth  = 72
+	compactHeight = 32
+
+	// Heights of carousel items, including the margin below them
+	expandedPostHeight = 12
+	compactItemHeight  = 4
+)
+
+// contentWidth is the width screens lay their boxes out in. Bordered boxes
+// add two columns for the border.
+func (m model) contentWidth() int {
+	if m.width == 0 {
+		return defaultContentWidth
+	}
+	return max(min(m.width-2, maxContentWidth), minContentWidth)
+}
+
+// bodyWidth is the width of text inside a box with horizontal padding of 2,
+// such as message bodies and the compose box.
+func (m model) bodyWidth() int {
+	return m.contentWidth() - 4
+}
+
+// compact reports whether the terminal is too small for decorations such as
+// the banner.
+func (m model) compact() bool {
+	return m.width > 0 && m.width < compactWidth || m.height > 0 && m.height < compactHeight
+}
+
+// carouselSize returns how many items a carousel shows: three until the
+// terminal reports its size, then as many as fit below chrome lines of
+// title, tabs and help.
+func (m model) carouselSize(chrome, expandedHeight int) int {
+	if m.height == 0 {
+		return 3
+	}
+	return max(1+(m.height-chrome-expandedHeight)/compactItemHeight, 1)
+}
+
+// carouselHeight is the number of lines a carousel of visible items takes.
+// Screens pad to it so the elements below don't move.
+func carouselHeight(visible, expandedHeight int) int {
+	return expandedHeight + (visible-1)*compactItemHeight
+}
+
+// layout centers a rendered screen in the terminal. The screen moves as a
+// block, measured without the trailing blanks that padding and margins
+// leave behind.
+func (m model) layout(view string) string {
+	if m.width == 0 {
+		return view
+	}
+
+	lines := strings.Split(view, "\n")
+	blockWidth := 0
+	for _, line := range lines {
+		blockWidth = max(blockWidth, lipgloss.Width(strings.TrimRight(ansi.Strip(line), " ")))
+	}
+
+	left := (m.width - blockWidth) / 2
+	if left <= 0 {
+		return view
+	}
+	indent := strings.Repeat(" ", left)
+	for i, line := range lines {
+		lines[i] = indent + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resizeInputs fits text inputs to the content width.
+func (m *model) resizeInputs() {
+	w := m.contentWidth()
+
+	// Input boxes have a border and horizontal padding of 2, and text
+	// inputs need room for their prompt and cursor
+	inputWidth := max(w-8, 10)
+	for _, input := range []*textinput.Model{
+		&m.recipientInput, &m.emailInput, &m.webhookInput, &m.apiTokenNameInput,
+		&m.botNameInput, &m.groupNameInput, &m.groupInviteInput, &m.profileInput, &m.timezoneInput,
+		&m.scheduleInput,
+	} {
+		input.Width = inputWidth
+	}
+	m.messageInput.SetWidth(max(w-4, 10))
+	m.postInput.SetWidth(max(w-4, 10))
+	m.chatInput.Width = max(w-6, 10)
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strconv"
@@ -18,6 +20,8 @@ import (
 	"github.com/charmbracelet/wish"
 	"github.com/charmbracelet/wish/bubbletea"
 	"github.com/charmbracelet/wish/logging"
+	"github.com/charmbracelet/wish/scp"
+	"github.com/muesli/termenv"
 	gossh "golang.org/x/crypto/ssh"
 )
 
@@ -26,6 +30,23 @@ const (
 )
 
 func main() {
+	// Maintenance subcommands run instead of the server
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "backup":
+			err = runBackupCommand(os.Args[2:])
+		case "restore":
+			err = runRestoreCommand(os.Args[2:])
+		default:
+			err = fmt.Errorf("unknown command %q (available: backup, restore)", os.Args[1])
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Get host from environment variable, default to localhost
 	host := os.Getenv("SOSHIAL_HOST")
 	if host == "" {
@@ -40,15 +61,93 @@ func main() {
 		}
 	}
 
+	// Extra themes are loaded from SOSHIAL_THEMES_DIR
+	if themesDir := os.Getenv("SOSHIAL_THEMES_DIR"); themesDir != "" {
+		loaded, err := loadThemes(themesDir)
+		if err != nil {
+			log.Fatalf("Failed to load themes: %v", err)
+		}
+		log.Printf("Loaded %d themes from %s", loaded, themesDir)
+	}
+
+	// Restores are refused while the server holds this lock
+	lock, err := lockDatabase(dbPath)
+	if err != nil {
+		log.Fatalf("Failed to lock database: %v", err)
+	}
+	defer lock.Close()
+
 	db, err := NewDatabase(dbPath)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 	defer db.Close()
 
+	// Background workers stop when the server shuts down
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	// Periodic snapshots are enabled by setting SOSHIAL_BACKUP_DIR
+	if backupDir := os.Getenv("SOSHIAL_BACKUP_DIR"); backupDir != "" {
+		interval := 24 * time.Hour
+		if intervalEnv := os.Getenv("SOSHIAL_BACKUP_INTERVAL"); intervalEnv != "" {
+			if d, err := time.ParseDuration(intervalEnv); err == nil && d > 0 {
+				interval = d
+			}
+		}
+		keep := 7
+		if keepEnv := os.Getenv("SOSHIAL_BACKUP_KEEP"); keepEnv != "" {
+			if k, err := strconv.Atoi(keepEnv); err == nil {
+				keep = k
+			}
+		}
+		go runBackupScheduler(workerCtx, db, backupDir, interval, keep)
+		log.Printf("Backing up to %s every %s (keeping %d)", backupDir, interval, keep)
+	}
+
+	// Webhooks are always available; users register them from settings
+	webhooks := NewWebhooks(db)
+	webhooks.Run(workerCtx)
+
+	// Email notifications are enabled by setting SOSHIAL_RELAY_ADDR
+	var mailer *Mailer
+	if relayAddr := os.Getenv("SOSHIAL_RELAY_ADDR"); relayAddr != "" {
+		from := os.Getenv("SOSHIAL_RELAY_FROM")
+		if from == "" {
+			from = "soshial@" + host
+		}
+		mailer = NewMailer(relayAddr, os.Getenv("SOSHIAL_RELAY_USER"), os.Getenv("SOSHIAL_RELAY_PASSWORD"), from)
+		go runEmailNotifier(workerCtx, db, mailer, fmt.Sprintf("ssh %s -p %d", host, port))
+		log.Printf("Sending email notifications through %s", relayAddr)
+	}
+
+	// Admins may manage server-wide settings such as global webhooks
+	admins := make(map[string]bool)
+	for _, key := range strings.Split(os.Getenv("SOSHIAL_ADMINS"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			admins[key] = true
+		}
+	}
+
+	// Senders may change messages for SOSHIAL_EDIT_WINDOW after sending, or
+	// until they are read if it is 0
+	editWindow := defaultEditWindow
+	if windowEnv := os.Getenv("SOSHIAL_EDIT_WINDOW"); windowEnv != "" {
+		if d, err := time.ParseDuration(windowEnv); err == nil && d >= 0 {
+			editWindow = d
+		}
+	}
+
 	// Create rate limiter
 	rateLimiter := NewRateLimiter(10 * time.Second)
 
+	// Connected sessions, for who's online and pushing live updates
+	presence := NewPresence()
+
+	// Scheduled messages go out from the server, whether or not their
+	// sender is connected
+	go runScheduledSender(workerCtx, db, webhooks, presence)
+
 	s, err := wish.NewServer(
 		wish.WithAddress(fmt.Sprintf("%s:%d", host, port)),
 		wish.WithHostKeyPath(".ssh/soshial_host_key"),
@@ -57,7 +156,9 @@ func main() {
 			return true
 		}),
 		wish.WithMiddleware(
-			bubbleTeaMiddleware(db, rateLimiter),
+			bubbleTeaMiddleware(db, rateLimiter, mailer, webhooks, admins, presence, editWindow),
+			exportMiddleware(db),
+			scp.Middleware(&exportSCPHandler{db: db}, nil),
 			logging.Middleware(),
 		),
 	)
@@ -65,6 +166,55 @@ func main() {
 		log.Fatalf("Failed to create server: %v", err)
 	}
 
+	// Optional SMTP gateway, enabled by setting SOSHIAL_SMTP_ADDR
+	var smtpGateway *SMTPGateway
+	if smtpAddr := os.Getenv("SOSHIAL_SMTP_ADDR"); smtpAddr != "" {
+		domain := os.Getenv("SOSHIAL_SMTP_DOMAIN")
+		if domain == "" {
+			domain = host
+		}
+
+		var tlsConfig *tls.Config
+		if certFile := os.Getenv("SOSHIAL_SMTP_TLS_CERT"); certFile != "" {
+			cert, err := tls.LoadX509KeyPair(certFile, os.Getenv("SOSHIAL_SMTP_TLS_KEY"))
+			if err != nil {
+				log.Fatalf("Failed to load SMTP TLS certificate: %v", err)
+			}
+			tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		}
+
+		smtpGateway, err = NewSMTPGateway(db, webhooks, presence, rateLimiter, domain, os.Getenv("SOSHIAL_SMTP_TOKENS"), tlsConfig)
+		if err != nil {
+			log.Fatalf("Failed to create SMTP gateway: %v", err)
+		}
+
+		log.Printf("Starting SMTP gateway on %s for @%s", smtpAddr, domain)
+		go func() {
+			if err := smtpGateway.ListenAndServe(smtpAddr); err != nil {
+				log.Fatalf("Failed to start SMTP gateway: %v", err)
+			}
+		}()
+	}
+
+	// Optional HTTP API, enabled by setting SOSHIAL_HTTP_ADDR
+	var httpServer *http.Server
+	if httpAddr := os.Getenv("SOSHIAL_HTTP_ADDR"); httpAddr != "" {
+		api := NewAPIServer(db, rateLimiter, webhooks, presence)
+		api.Run(workerCtx)
+		httpServer = &http.Server{
+			Addr:              httpAddr,
+			Handler:           api.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		log.Printf("Starting HTTP API on %s", httpAddr)
+		go func() {
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to start HTTP API: %v", err)
+			}
+		}()
+	}
+
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
@@ -80,8 +230,16 @@ func main() {
 
 	<-done
 	log.Println("Stopping server...")
+	if smtpGateway != nil {
+		smtpGateway.Close()
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
+	if httpServer != nil {
+		if err := httpServer.Shutdown(ctx); err != nil {
+			log.Printf("Failed to shutdown HTTP API: %v", err)
+		}
+	}
 	if err := s.Shutdown(ctx); err != nil {
 		log.Fatalf("Failed to shutdown server: %v", err)
 	}
@@ -103,6 +261,12 @@ func NewRateLimiter(minInterval time.Duration) *RateLimiter {
 
 // CanSendMessage checks if a user can send a message
 func (rl *RateLimiter) CanSendMessage(userKey string) bool {
+	return rl.CanSendMessageEvery(userKey, rl.minInterval)
+}
+
+// CanSendMessageEvery checks if a user can send a message using a custom
+// interval, for senders such as bots that have their own limits
+func (rl *RateLimiter) CanSendMessageEvery(userKey string, minInterval time.Duration) bool {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
@@ -111,7 +275,7 @@ func (rl *RateLimiter) CanSendMessage(userKey string) bool {
 		return true
 	}
 
-	return time.Since(lastTime) >= rl.minInterval
+	return time.Since(lastTime) >= minInterval
 }
 
 // RecordMessage records that a user sent a message
@@ -121,48 +285,75 @@ func (rl *RateLimiter) RecordMessage(userKey string) {
 	rl.lastMessageTime[userKey] = time.Now()
 }
 
-func bubbleTeaMiddleware(db *Database, rateLimiter *RateLimiter) wish.Middleware {
-	teaHandler := func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
+// fingerprintFor returns the SHA256 fingerprint of a key without the
+// "SHA256:" prefix, which is how users are identified.
+func fingerprintFor(pubKey ssh.PublicKey) string {
+	return strings.TrimPrefix(gossh.FingerprintSHA256(pubKey), "SHA256:")
+}
+
+func bubbleTeaMiddleware(db *Database, rateLimiter *RateLimiter, mailer *Mailer, webhooks *Webhooks, admins map[string]bool, presence *Presence, editWindow time.Duration) wish.Middleware {
+	teaHandler := func(s ssh.Session) *tea.Program {
 		pty, _, active := s.Pty()
 		if !active {
 			wish.Fatalln(s, "no active terminal, skipping")
-			return nil, nil
+			return nil
 		}
 
 		// Get SSH public key fingerprint
 		pubKey := s.PublicKey()
 		if pubKey == nil {
 			wish.Fatalln(s, "no public key found")
-			return nil, nil
+			return nil
 		}
-		// Get fingerprint and strip "SHA256:" prefix
-		fingerprintFull := gossh.FingerprintSHA256(pubKey)
-		fingerprint := strings.TrimPrefix(fingerprintFull, "SHA256:")
+		fingerprint := fingerprintFor(pubKey)
 
 		// Upsert user in database
+		known, err := db.UserExists(fingerprint)
+		if err != nil {
+			wish.Fatalln(s, fmt.Sprintf("failed to look up user: %v", err))
+			return nil
+		}
 		if err := db.UpsertUser(fingerprint); err != nil {
 			wish.Fatalln(s, fmt.Sprintf("failed to update user: %v", err))
-			return nil, nil
+			return nil
+		}
+		if !known {
+			go webhooks.Emit(eventUserFirstSeen, fingerprint, map[string]string{"fingerprint": fingerprint})
 		}
 
-		// Create a renderer with color support for the SSH session
+		// Create a renderer with as many colors as the client's terminal
+		// supports. Users can override this in their preferences.
 		renderer := lipgloss.NewRenderer(s)
+		profile := detectColorProfile(pty.Term, s.Environ())
+		log.Printf("Terminal type: %s, colors: %s", pty.Term, profile.Name())
+		renderer.SetColorProfile(profile)
 
-		// Force color output - ANSI256 colors (profile ID 2)
-		termEnv := pty.Term
-		log.Printf("Terminal type: %s", termEnv)
-
-		// Force ANSI256 color profile
-		renderer.SetColorProfile(2) // 2 = ANSI256
-
-		m := newModel(db, fingerprint, renderer, rateLimiter)
+		m := newModel(db, fingerprint, renderer, rateLimiter, mailer, webhooks)
+		m.isAdmin = admins[fingerprint]
+		m.editWindow = editWindow
 		m.width = pty.Window.Width
 		m.height = pty.Window.Height
+		m.sessionTimezone = timezoneFromEnv(s.Environ())
 
-		return m, []tea.ProgramOption{
-			tea.WithAltScreen(),
-		}
+		// Track the session until the connection closes
+		m.presence = presence
+		m.sessionID = presence.Connect(fingerprint)
+		go func() {
+			<-s.Context().Done()
+			presence.Disconnect(m.sessionID)
+			// Keep what the user was writing for when they reconnect
+			if _, err := m.draft.save(true); err != nil {
+				log.Printf("failed to save draft: %v", err)
+			}
+			if err := db.UpsertUser(fingerprint); err != nil {
+				log.Printf("failed to update last seen: %v", err)
+			}
+		}()
+
+		program := tea.NewProgram(m, append(bubbletea.MakeOptions(s), tea.WithAltScreen())...)
+		presence.SetProgram(m.sessionID, program)
+		return program
 	}
 
-	return bubbletea.Middleware(teaHandler)
+	return bubbletea.MiddlewareWithProgramHandler(teaHandler, termenv.Ascii)
 }
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/alecthomas/chroma/v2"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
+)
+
+var (
+	mdHeadingRe = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	mdListRe    = regexp.MustCompile(`^(\s*)([-*+]|\d{1,9}[.)])\s+(.*)$`)
+	mdTaskRe    = regexp.MustCompile(`^\[([ xX])\]\s+`)
+)
+
+// Characters that can be escaped with a backslash
+const mdPunctuation = "\\`*_{}[]()<>#+-.!|~"
+
+// mdSpan is a run of inline text with the same formatting.
+type mdSpan struct {
+	text   string
+	bold   bool
+	italic bool
+	strike bool
+	code   bool
+	muted  bool
+	url    string // Set for links
+}
+
+// markdownRenderer renders the Markdown people tend to write in messages:
+// emphasis, inline code, fenced code blocks, headings, quotes, lists and
+// links. Line breaks are kept as written, like in chat apps, instead of
+// being joined into paragraphs.
+type markdownRenderer struct {
+	r     *lipgloss.Renderer
+	st    styles
+	width int
+}
+
+// renderMarkdown renders src with the colors of the current theme, wrapped
+// to width cells.
+func (m model) renderMarkdown(src string, width int) string {
+	md := markdownRenderer{r: m.renderer, st: m.getStyles(), width: width}
+	return strings.Join(md.render(src), "\n")
+}
+
+// messageBodyLines splits a message body into display lines, rendering
+// Markdown unless the user asked to see the source, which is soft wrapped
+// instead.
+func (m model) messageBodyLines(body string) []string {
+	if m.rawMessages {
+		return strings.Split(ansi.Wrap(body, m.bodyWidth(), ""), "\n")
+	}
+	return strings.Split(m.renderMarkdown(body, m.bodyWidth()), "\n")
+}
+
+func (md markdownRenderer) render(src string) []string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\t", "    ")
+	lines := strings.Split(src, "\n")
+
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+
+		// Fenced code blocks run to the closing fence or the end of the message
+		if fence, lang, ok := mdCodeFence(trimmed); ok {
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			out = append(out, md.codeBlock(strings.Join(code, "\n"), lang)...)
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			out = append(out, "")
+
+		case mdIsRule(trimmed):
+			out = append(out, md.r.NewStyle().Foreground(md.st.mutedColor).Render(strings.Repeat("─", md.width)))
+
+		case mdHeadingRe.MatchString(trimmed):
+			match := mdHeadingRe.FindStringSubmatch(trimmed)
+			base := md.r.NewStyle().Foreground(md.st.primaryColor).Bold(true)
+			if len(match[1]) == 1 {
+				base = base.Underline(true)
+			}
+			out = append(out, md.wrap(parseInline(match[2]), base, md.width)...)
+
+		case strings.HasPrefix(trimmed, ">"):
+			text := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+			bar := md.r.NewStyle().Foreground(md.st.mutedColor).Render("┃ ")
+			base := md.r.NewStyle().Foreground(md.st.mutedColor).Italic(true)
+			for _, line := range md.wrap(parseInline(text), base, md.width-2) {
+				out = append(out, bar+line)
+			}
+
+		case mdListRe.MatchString(lines[i]):
+			out = append(out, md.listItem(mdListRe.FindStringSubmatch(lines[i]))...)
+
+		default:
+			out = append(out, md.wrap(parseInline(trimmed), md.r.NewStyle(), md.width)...)
+		}
+	}
+	return out
+}
+
+func mdCodeFence(line string) (fence, lang string, ok bool) {
+	for _, fence := range []string{"```", "~~~"} {
+		if strings.HasPrefix(line, fence) {
+			info := strings.Fields(strings.TrimLeft(line, fence[:1]))
+			if len(info) > 0 {
+				lang = info[0]
+			}
+			return fence, lang, true
+		}
+	}
+	return "", "", false
+}
+
+// mdIsRule reports whether line is a thematic break such as --- or * * *.
+func mdIsRule(line string) bool {
+	line = strings.ReplaceAll(line, " ", "")
+	if len(line) < 3 {
+		return false
+	}
+	for _, c := range []string{"-", "*", "_"} {
+		if strings.Trim(line, c) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// listItem renders a bullet or numbered item with a hanging indent, nesting
+// by two spaces of indentation per level.
+func (md markdownRenderer) listItem(match []string) []string {
+	level := min(len(match[1])/2, 3)
+	text := match[3]
+
+	marker := match[2]
+	if !unicode.IsDigit(rune(marker[0])) {
+		marker = []string{"•", "◦", "▪", "▫"}[level]
+	}
+	markerStyle := md.r.NewStyle().Foreground(md.st.accentColor)
+
+	if task := mdTaskRe.FindStringSubmatch(text); task != nil {
+		text = text[len(task[0]):]
+		if task[1] == " " {
+			marker += " ☐"
+		} else {
+			marker += " " + md.r.NewStyle().Foreground(md.st.successColor).Render("☑")
+		}
+	}
+
+	prefix := strings.Repeat("  ", level) + markerStyle.Render(marker) + " "
+	indent := strings.Repeat(" ", lipgloss.Width(prefix))
+
+	lines := md.wrap(parseInline(text), md.r.NewStyle(), max(md.width-lipgloss.Width(prefix), 10))
+	for i := range lines {
+		if i == 0 {
+			lines[i] = prefix + lines[i]
+		} else {
+			lines[i] = indent + lines[i]
+		}
+	}
+	return lines
+}
+
+// codeBlock highlights code with the theme colors. Long lines are cut off
+// rather than wrapped so the code keeps its shape.
+func (md markdownRenderer) codeBlock(code, lang string) []string {
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		lexer = lexers.Analyse(code)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+
+	var lines []string
+	var line strings.Builder
+	if iter, err := chroma.Coalesce(lexer).Tokenise(nil, code); err == nil {
+		for _, token := range iter.Tokens() {
+			style := md.tokenStyle(token.Type)
+			for i, part := range strings.Split(token.Value, "\n") {
+				if i > 0 {
+					lines = append(lines, line.String())
+					line.Reset()
+				}
+				if part != "" {
+					line.WriteString(style.Render(part))
+				}
+			}
+		}
+		lines = append(lines, line.String())
+	} else {
+		lines = strings.Split(code, "\n")
+	}
+
+	// Lexers may add a final newline
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	bar := md.r.NewStyle().Foreground(md.st.mutedColor).Render("│ ")
+	clip := md.r.NewStyle().MaxWidth(md.width - 2)
+	for i := range lines {
+		lines[i] = bar + clip.Render(lines[i])
+	}
+	return lines
+}
+
+func (md markdownRenderer) tokenStyle(t chroma.TokenType) lipgloss.Style {
+	style := md.r.NewStyle()
+	switch {
+	case t.InCategory(chroma.Comment):
+		return style.Foreground(md.st.mutedColor).Italic(true)
+	case t.InCategory(chroma.Keyword):
+		return style.Foreground(md.st.primaryColor).Bold(true)
+	case t.InSubCategory(chroma.LiteralString):
+		return style.Foreground(md.st.successColor)
+	case t.InSubCategory(chroma.LiteralNumber):
+		return style.Foreground(md.st.highlight)
+	case t == chroma.NameFunction, t == chroma.NameClass, t == chroma.NameTag:
+		return style.Foreground(md.st.accentColor)
+	case t == chroma.NameBuiltin, t == chroma.NameBuiltinPseudo, t == chroma.NameAttribute:
+		return style.Foreground(md.st.secondaryColor)
+	case t.InCategory(chroma.Operator):
+		return style.Foreground(md.st.secondaryColor)
+	case t == chroma.GenericInserted:
+		return style.Foreground(md.st.successColor)
+	case t == chroma.GenericDeleted:
+		return style.Foreground(md.st.errorColor)
+	case t == chroma.GenericHeading, t == chroma.GenericSubheading:
+		return style.Foreground(md.st.primaryColor).Bold(true)
+	}
+	return style.Foreground(md.st.textColor)
+}
+
+// wrap lays spans out in lines of at most width cells. Words are styled one
+// at a time so formatting and links survive line breaks.
+func (md markdownRenderer) wrap(spans []mdSpan, base lipgloss.Style, width int) []string {
+	var lines []string
+	var line strings.Builder
+	lineWidth := 0
+	space := false
+
+	for _, span := range spans {
+		style := md.spanStyle(base, span)
+		for i, word := range strings.Split(span.text, " ") {
+			if i > 0 {
+				space = true
+			}
+			for word != "" {
+				if space && lineWidth > 0 {
+					if lineWidth+1+lipgloss.Width(word) > width {
+						lines = append(lines, line.String())
+						line.Reset()
+						lineWidth = 0
+					} else {
+						line.WriteString(" ")
+						lineWidth++
+					}
+				}
+				space = false
+
+				// Hard break words that don't fit on a line of their own
+				piece := word
+				if lineWidth+lipgloss.Width(piece) > width {
+					piece = mdCutToWidth(word, width-lineWidth)
+					if piece == "" && lineWidth > 0 {
+						lines = append(lines, line.String())
+						line.Reset()
+						lineWidth = 0
+						continue
+					}
+					if piece == "" {
+						_, size := utf8.DecodeRuneInString(word)
+						piece = word[:size]
+					}
+				}
+				word = word[len(piece):]
+
+				rendered := style.Render(piece)
+				if span.url != "" {
+					rendered = osc8Link(span.url, rendered)
+				}
+				line.WriteString(rendered)
+				lineWidth += lipgloss.Width(piece)
+			}
+		}
+	}
+	return append(lines, line.String())
+}
+
+// mdCutToWidth returns the longest prefix of s that fits in width cells.
+func mdCutToWidth(s string, width int) string {
+	cut := 0
+	for cut < len(s) {
+		_, size := utf8.DecodeRuneInString(s[cut:])
+		if lipgloss.Width(s[:cut+size]) > width {
+			break
+		}
+		cut += size
+	}
+	return s[:cut]
+}
+
+func (md markdownRenderer) spanStyle(base lipgloss.Style, span mdSpan) lipgloss.Style {
+	style := base
+	if span.bold {
+		style = style.Bold(true)
+	}
+	if span.italic {
+		style = style.Italic(true)
+	}
+	if span.strike {
+		style = style.Strikethrough(true)
+	}
+	if span.code {
+		style = style.Foreground(md.st.highlight)
+	}
+	if span.muted {
+		style = style.Foreground(md.st.mutedColor)
+	}
+	if span.url != "" {
+		style = style.Foreground(md.st.accentColor).Underline(true)
+	}
+	return style
+}
+
+// osc8Link makes text a clickable hyperlink in terminals that support it.
+// Other terminals just show the text.
+func osc8Link(target, text string) string {
+	return "\033]8;;" + target + "\033\\" + text + "\033]8;;\033\\"
+}
+
+// mdLinkTarget checks that a link points somewhere safe to open.
+func mdLinkTarget(raw string) (*url.URL, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u, u.Host != ""
+	case "mailto":
+		return u, u.Opaque != ""
+	}
+	return nil, false
+}
+
+// parseInline splits a line into formatted spans.
+func parseInline(text string) []mdSpan {
+	var spans []mdSpan
+	var cur mdSpan
+	var buf strings.Builder
+
+	emit := func() {
+		if buf.Len() > 0 {
+			span := cur
+			span.text = buf.String()
+			spans = append(spans, span)
+			buf.Reset()
+		}
+	}
+
+	// toggle opens or closes a delimited run at i. Like CommonMark, runs
+	// open before and close after non-space text, and only open when they
+	// are closed later on. Otherwise the delimiter is just text.
+	toggle := func(flag *bool, delim string, i int) {
+		before, after := text[:i], text[i+len(delim):]
+		switch {
+		case *flag && before != "" && !mdEndsWithSpace(before):
+			emit()
+			*flag = false
+		case !*flag && after != "" && !mdStartsWithSpace(after) && mdHasCloser(after, delim):
+			emit()
+			*flag = true
+		default:
+			buf.WriteString(delim)
+		}
+	}
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.IndexByte(mdPunctuation, rest[1]) >= 0:
+			buf.WriteByte(rest[1])
+			i += 2
+
+		case rest[0] == '`':
+			n := len(rest) - len(strings.TrimLeft(rest, "`"))
+			delim := rest[:n]
+			end := strings.Index(rest[n:], delim)
+			if end < 0 {
+				buf.WriteString(delim)
+				i += n
+				continue
+			}
+			emit()
+			code := cur
+			code.code = true
+			code.text = rest[n : n+end]
+			if strings.TrimSpace(code.text) != "" {
+				code.text = strings.TrimPrefix(strings.TrimSuffix(code.text, " "), " ")
+			}
+			spans = append(spans, code)
+			i += n + end + n
+
+		case strings.HasPrefix(rest, "**"), strings.HasPrefix(rest, "__"):
+			toggle(&cur.bold, rest[:2], i)
+			i += 2
+
+		case strings.HasPrefix(rest, "~~"):
+			toggle(&cur.strike, "~~", i)
+			i += 2
+
+		case rest[0] == '*':
+			toggle(&cur.italic, "*", i)
+			i++
+
+		case rest[0] == '_':
+			// Underscores inside words, as in snake_case, are not emphasis
+			if i > 0 && len(rest) > 1 && mdIsWordByte(text[i-1]) && mdIsWordByte(rest[1]) {
+				buf.WriteByte('_')
+			} else {
+				toggle(&cur.italic, "_", i)
+			}
+			i++
+
+		case rest[0] == '[':
+			close := strings.Index(rest, "](")
+			end := -1
+			if close > 0 {
+				end = strings.IndexByte(rest[close+2:], ')')
+			}
+			if end < 0 {
+				buf.WriteByte('[')
+				i++
+				continue
+			}
+			label, target := rest[1:close], strings.TrimSpace(rest[close+2:close+2+end])
+			u, ok := mdLinkTarget(target)
+			if !ok {
+				buf.WriteByte('[')
+				i++
+				continue
+			}
+			emit()
+			link := cur
+			link.text, link.url = label, u.String()
+			spans = append(spans, link)
+			// Show where the link goes, as the label may say otherwise
+			if label != target && u.Host != "" {
+				spans = append(spans, mdSpan{text: " (" + u.Host + ")", muted: true})
+			}
+			i += close + 2 + end + 1
+
+		case rest[0] == '<' && strings.IndexByte(rest, '>') > 0:
+			end := strings.IndexByte(rest, '>')
+			u, ok := mdLinkTarget(rest[1:end])
+			if !ok {
+				buf.WriteByte('<')
+				i++
+				continue
+			}
+			emit()
+			link := cur
+			link.text, link.url = rest[1:end], u.String()
+			spans = append(spans, link)
+			i += end + 1
+
+		case (strings.HasPrefix(rest, "https://") || strings.HasPrefix(rest, "http://")) && (i == 0 || !mdIsWordByte(text[i-1])):
+			// Bare URLs, minus trailing punctuation that is part of the sentence
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			raw := strings.TrimRight(rest[:end], ".,;:!?'\")")
+			u, ok := mdLinkTarget(raw)
+			if !ok {
+				buf.WriteString(raw)
+				i += len(raw)
+				continue
+			}
+			emit()
+			link := cur
+			link.text, link.url = raw, u.String()
+			spans = append(spans, link)
+			i += len(raw)
+
+		default:
+			_, size := utf8.DecodeRuneInString(rest)
+			buf.WriteString(rest[:size])
+			i += size
+		}
+	}
+	emit()
+	return spans
+}
+
+// mdHasCloser reports whether s contains delim right after non-space text.
+func mdHasCloser(s, delim string) bool {
+	for i := 1; i < len(s); i++ {
+		if strings.HasPrefix(s[i:], delim) && !mdEndsWithSpace(s[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func mdStartsWithSpace(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsSpace(r)
+}
+
+func mdEndsWithSpace(s string) bool {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return unicode.IsSpace(r)
+}
+
+func mdIsWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b >= 0x80
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	frequencyOff       = "off"
+	frequencyImmediate = "immediate"
+	frequencyDaily     = "daily"
+
+	verificationCodeTTL = 15 * time.Minute
+
+	// Wrong guesses after which a verification code stops working
+	maxVerificationAttempts = 5
+)
+
+var frequencyLabels = map[string]string{
+	frequencyOff:       "Off",
+	frequencyImmediate: "Immediately",
+	frequencyDaily:     "Daily digest",
+}
+
+// Mailer sends plain text email through an SMTP relay.
+type Mailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewMailer creates a mailer for the relay at addr (host:port). Credentials
+// are optional; leave username empty for relays that don't need them.
+func NewMailer(addr, username, password, from string) *Mailer {
+	m := &Mailer{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+func (m *Mailer) Send(to, subject, body string) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(msg.String()))
+}
+
+// runEmailNotifier checks for unread mail every minute and emails subscribers
+// according to their frequency preference. It returns when ctx is cancelled.
+func runEmailNotifier(ctx context.Context, db *Database, mailer *Mailer, connectHint string) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			subscribers, err := db.GetEmailSubscribers()
+			if err != nil {
+				log.Printf("Failed to load email subscribers: %v", err)
+				continue
+			}
+			for _, sub := range subscribers {
+				if err := notifySubscriber(db, mailer, sub, connectHint); err != nil {
+					log.Printf("Failed to notify %s: %v", sub.SSHKeyFingerprint, err)
+				}
+			}
+		}
+	}
+}
+
+func notifySubscriber(db *Database, mailer *Mailer, sub EmailSettings, connectHint string) error {
+	now := time.Now()
+	if sub.Frequency == frequencyDaily && now.Sub(sub.LastNotified) < 24*time.Hour {
+		return nil
+	}
+
+	messages, err := db.GetUnreadMessagesSince(sub.SSHKeyFingerprint, sub.LastNotified)
+	if err != nil {
+		return err
+	}
+
+	if len(messages) > 0 {
+		subject := "You have a new message on SoSHial"
+		if len(messages) > 1 {
+			subject = fmt.Sprintf("You have %d new messages on SoSHial", len(messages))
+		}
+		settings, err := db.GetUserSettings(sub.SSHKeyFingerprint)
+		if err != nil {
+			return err
+		}
+		if err := mailer.Send(sub.Email, subject, digestBody(messages, settings, connectHint)); err != nil {
+			return err
+		}
+	} else if sub.Frequency == frequencyImmediate {
+		return nil
+	}
+
+	// Daily digests advance even when empty so the next one stays a day out
+	return db.MarkNotified(sub.SSHKeyFingerprint, now)
+}
+
+// digestBody lists messages with their dates in the recipient's time zone
+// and timestamp format.
+func digestBody(messages []Message, settings UserSettings, connectHint string) string {
+	loc := loadTimezone(settings.Timezone)
+	if loc == nil {
+		loc = time.Local
+	}
+	layout, ok := timestampLayouts[settings.TimestampFormat]
+	if !ok {
+		layout = timestampLayouts[timestampFormat24h]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "You have %d unread message(s) waiting:\n", len(messages))
+
+	for _, msg := range messages {
+		fmt.Fprintf(&b, "\nFrom: %s\n", msg.FromKey)
+		fmt.Fprintf(&b, "Date: %s\n\n", msg.Timestamp.In(loc).Format(layout[timeFull]))
+		for _, line := range strings.Split(msg.Message, "\n") {
+			b.WriteString("    ")
+			b.WriteString(line)
+			b.WriteString("\n")
+		}
+	}
+
+	fmt.Fprintf(&b, "\nRead and reply with: %s\n", connectHint)
+	b.WriteString("Change how often you get these emails under Settings > Email notifications.\n")
+	return b.String()
+}
+
+func newVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+type emailStep int
+
+const (
+	emailOverview emailStep = iota
+	emailEnterAddress
+	emailEnterCode
+)
+
+type emailCodeSentMsg struct{ err error }
+
+func (m model) openEmailSettings() (tea.Model, tea.Cmd) {
+	settings, err := m.db.GetEmailSettings(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.emailSettings = settings
+	m.emailStep = emailOverview
+	m.currentScreen = emailNotifications
+	m.err = nil
+	m.successMsg = ""
+	return m, nil
+}
+
+func (m model) sendVerificationCode(email string) tea.Cmd {
+	return func() tea.Msg {
+		code, err := newVerificationCode()
+		if err != nil {
+			return emailCodeSentMsg{err}
+		}
+		if err := m.db.SetPendingEmail(m.userKey, email, code, time.Now().Add(verificationCodeTTL)); err != nil {
+			return emailCodeSentMsg{err}
+		}
+		body := fmt.Sprintf("Your SoSHial verification code is %s\n\nIt expires in %d minutes.\n", code, int(verificationCodeTTL.Minutes()))
+		return emailCodeSentMsg{m.mailer.Send(email, "Your SoSHial verification code", body)}
+	}
+}
+
+func (m model) updateEmailNotifications(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch m.emailStep {
+	case emailEnterAddress, emailEnterCode:
+		switch msg.String() {
+		case "esc":
+			m.emailStep = emailOverview
+			m.emailInput.Blur()
+			m.err = nil
+			return m, nil
+
+		case "enter":
+			value := strings.TrimSpace(m.emailInput.Value())
+			if m.emailStep == emailEnterAddress {
+				addr, err := mail.ParseAddress(value)
+				if err != nil {
+					m.err = fmt.Errorf("invalid email address")
+					return m, nil
+				}
+				key := "email:" + m.userKey
+				if !m.rateLimiter.CanSendMessage(key) {
+					m.err = fmt.Errorf("rate limit: please wait before requesting another code")
+					return m, nil
+				}
+				m.rateLimiter.RecordMessage(key)
+				m.err = nil
+				m.successMsg = "Sending verification code..."
+				return m, m.sendVerificationCode(addr.Address)
+			}
+
+			ok, err := m.db.VerifyEmail(m.userKey, value, maxVerificationAttempts)
+			if err != nil {
+				m.err = err
+				return m, nil
+			}
+			if !ok {
+				m.err = fmt.Errorf("wrong or expired code")
+				return m, nil
+			}
+			m.emailInput.Blur()
+			m.successMsg = "Email address verified!"
+			return m.reloadEmailSettings()
+		}
+
+		m.emailInput, cmd = m.emailInput.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = settingsMenu
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keyEdit):
+		if m.mailer == nil {
+			m.err = fmt.Errorf("email notifications are not enabled on this server")
+			return m, nil
+		}
+		m.emailStep = emailEnterAddress
+		m.emailInput.Placeholder = "you@example.com"
+		m.emailInput.SetValue("")
+		m.err = nil
+		m.successMsg = ""
+		return m, m.emailInput.Focus()
+
+	case m.keys.matches(msg, keyEnterCode):
+		if m.emailSettings == nil || m.emailSettings.Verified {
+			return m, nil
+		}
+		m.emailStep = emailEnterCode
+		m.emailInput.Placeholder = "123456"
+		m.emailInput.SetValue("")
+		m.err = nil
+		m.successMsg = ""
+		return m, m.emailInput.Focus()
+
+	case m.keys.matches(msg, keyFrequency):
+		if m.emailSettings == nil {
+			return m, nil
+		}
+		next := map[string]string{
+			frequencyOff:       frequencyImmediate,
+			frequencyImmediate: frequencyDaily,
+			frequencyDaily:     frequencyOff,
+		}[m.emailSettings.Frequency]
+		if err := m.db.SetNotificationFrequency(m.userKey, next); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.successMsg = "Notifications: " + frequencyLabels[next]
+		return m.reloadEmailSettings()
+
+	case m.keys.matches(msg, keyRemoveAddress):
+		if m.emailSettings == nil {
+			return m, nil
+		}
+		if err := m.db.DeleteEmailSettings(m.userKey); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.emailSettings = nil
+		m.successMsg = "Email address removed"
+		m.err = nil
+	}
+	return m, nil
+}
+
+func (m model) reloadEmailSettings() (tea.Model, tea.Cmd) {
+	settings, err := m.db.GetEmailSettings(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.emailSettings = settings
+	m.emailStep = emailOverview
+	m.err = nil
+	return m, nil
+}
+
+func (m model) viewEmailNotifications() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("📧  Email Notifications")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	switch m.emailStep {
+	case emailEnterAddress, emailEnterCode:
+		label := "Enter your email address"
+		help := "Press [enter] to send a verification code • [esc] to cancel"
+		if m.emailStep == emailEnterCode {
+			label = fmt.Sprintf("Enter the code sent to %s", m.emailSettings.Email)
+			help = "Press [enter] to verify • [esc] to cancel"
+		}
+		s.WriteString(st.inputLabelStyle.Render(label))
+		s.WriteString("\n\n")
+
+		// Error message (fixed height to keep bottom elements stable)
+		if m.err != nil {
+			s.WriteString(st.errorStyle.Render(" ✗ " + m.err.Error() + " "))
+		}
+		s.WriteString("\n\n")
+
+		input := st.inputBoxStyle.Width(m.contentWidth()).Render(m.emailInput.View())
+		s.WriteString(input)
+		s.WriteString("\n")
+		s.WriteString(st.helpStyle.Render(help))
+		return s.String()
+	}
+
+	labelStyle := m.renderer.NewStyle().Foreground(st.accentColor).Width(12)
+	valueStyle := m.renderer.NewStyle().Foreground(st.textColor)
+
+	var help string
+	if m.emailSettings == nil {
+		s.WriteString(st.emptyStateStyle.Width(m.contentWidth()).Render("No email address registered.\n\nAdd one to hear about unread messages\nwhen you're not connected."))
+		s.WriteString("\n")
+		help = m.keyHint(keyEdit, "to add an address") + " • " + m.keyHint(keyBack, "to return")
+	} else {
+		status := m.renderer.NewStyle().Foreground(st.successColor).Render("✓ verified")
+		if !m.emailSettings.Verified {
+			status = m.renderer.NewStyle().Foreground(st.highlight).Render("awaiting verification")
+		}
+		s.WriteString(labelStyle.Render("Address") + valueStyle.Render(m.emailSettings.Email) + "  " + status)
+		s.WriteString("\n")
+		s.WriteString(labelStyle.Render("Frequency") + valueStyle.Render(frequencyLabels[m.emailSettings.Frequency]))
+		s.WriteString("\n")
+
+		if m.emailSettings.Verified {
+			help = m.keyHint(keyFrequency, "to change frequency") + " • " + m.keyHint(keyEdit, "to change address") + " • " + m.keyHint(keyRemoveAddress, "to remove") + " • " + m.keyHint(keyBack, "to return")
+		} else {
+			help = m.keyHint(keyEnterCode, "to enter code") + " • " + m.keyHint(keyEdit, "to change address") + " • " + m.keyHint(keyRemoveAddress, "to remove") + " • " + m.keyHint(keyBack, "to return")
+		}
+	}
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.Render(help))
+
+	return s.String()
+}
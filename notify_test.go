@@ -0,0 +1,210 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeSMTPServer accepts mail on a local port and passes the data of each
+// message it receives to the returned channel.
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	received := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeSMTP(conn, received)
+		}
+	}()
+	return l.Addr().String(), received
+}
+
+func serveFakeSMTP(conn net.Conn, received chan<- string) {
+	text := textproto.NewConn(conn)
+	defer text.Close()
+
+	text.PrintfLine("220 fake ESMTP")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, _, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 fake")
+		case "DATA":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			data, err := io.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			received <- string(data)
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+// newTestSubscriber creates a user with a verified address who wants email
+// at frequency, last notified at lastNotified.
+func newTestSubscriber(t *testing.T, frequency string, lastNotified time.Time) (*Database, EmailSettings) {
+	t.Helper()
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "soshial.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, key := range []string{"alice", "bob"} {
+		if err := db.UpsertUser(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.SetPendingEmail("bob", "bob@example.com", "123456", time.Now().Add(verificationCodeTTL)); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := db.VerifyEmail("bob", "123456", maxVerificationAttempts); err != nil || !ok {
+		t.Fatalf("VerifyEmail = %v, %v", ok, err)
+	}
+	if err := db.SetNotificationFrequency("bob", frequency); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.MarkNotified("bob", lastNotified); err != nil {
+		t.Fatal(err)
+	}
+
+	subscribers, err := db.GetEmailSubscribers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subscribers) != 1 {
+		t.Fatalf("got %d subscribers, want 1", len(subscribers))
+	}
+	return db, subscribers[0]
+}
+
+func TestNotifyImmediate(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	mailer := NewMailer(addr, "", "", "soshial@example.com")
+	db, sub := newTestSubscriber(t, frequencyImmediate, time.Now().Add(-time.Minute))
+
+	// Nothing is sent without unread mail
+	if err := notifySubscriber(db, mailer, sub, "ssh example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 0 {
+		t.Fatalf("got %d emails without unread mail, want 0", len(received))
+	}
+
+	if _, err := db.SendMessage("alice", "bob", "lunch at noon?"); err != nil {
+		t.Fatal(err)
+	}
+	if err := notifySubscriber(db, mailer, sub, "ssh example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 {
+		t.Fatalf("got %d emails, want 1", len(received))
+	}
+	mail := <-received
+	for _, want := range []string{"To: bob@example.com", "Subject: You have a new message on SoSHial", "lunch at noon?", "ssh example.com"} {
+		if !strings.Contains(mail, want) {
+			t.Errorf("email is missing %q:\n%s", want, mail)
+		}
+	}
+
+	// The same message isn't sent twice
+	subscribers, err := db.GetEmailSubscribers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifySubscriber(db, mailer, subscribers[0], "ssh example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 0 {
+		t.Fatalf("got %d emails for mail already notified, want 0", len(received))
+	}
+}
+
+func TestNotifyDailyDigest(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	mailer := NewMailer(addr, "", "", "soshial@example.com")
+	db, sub := newTestSubscriber(t, frequencyDaily, time.Now().Add(-25*time.Hour))
+
+	for _, body := range []string{"first", "second"} {
+		if _, err := db.SendMessage("alice", "bob", body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := notifySubscriber(db, mailer, sub, "ssh example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 1 {
+		t.Fatalf("got %d emails, want 1 digest", len(received))
+	}
+	mail := <-received
+	for _, want := range []string{"Subject: You have 2 new messages on SoSHial", "first", "second"} {
+		if !strings.Contains(mail, want) {
+			t.Errorf("digest is missing %q:\n%s", want, mail)
+		}
+	}
+
+	// The next digest waits a day, even with new mail
+	if _, err := db.SendMessage("alice", "bob", "third"); err != nil {
+		t.Fatal(err)
+	}
+	subscribers, err := db.GetEmailSubscribers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifySubscriber(db, mailer, subscribers[0], "ssh example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 0 {
+		t.Fatalf("got %d emails within a day of the last digest, want 0", len(received))
+	}
+}
+
+func TestVerifyEmailAttempts(t *testing.T) {
+	db, err := NewDatabase(filepath.Join(t.TempDir(), "soshial.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.UpsertUser("bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetPendingEmail("bob", "bob@example.com", "123456", time.Now().Add(verificationCodeTTL)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < maxVerificationAttempts; i++ {
+		if ok, err := db.VerifyEmail("bob", "000000", maxVerificationAttempts); ok || err != nil {
+			t.Fatalf("wrong code %d: VerifyEmail = %v, %v, want false, nil", i, ok, err)
+		}
+	}
+	if _, err := db.VerifyEmail("bob", "000000", maxVerificationAttempts); err == nil {
+		t.Fatal("last wrong code was accepted without an error")
+	}
+	if ok, _ := db.VerifyEmail("bob", "123456", maxVerificationAttempts); ok {
+		t.Fatal("right code still works after too many wrong ones")
+	}
+}
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// Time zones work on servers without a zoneinfo database
+	_ "time/tzdata"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	"github.com/muesli/termenv"
+)
+
+const (
+	alertScopeAll    = "all"
+	alertScopeDirect = "direct"
+
+	timestampFormat24h = "24h"
+	timestampFormat12h = "12h"
+	timestampFormatISO = "iso"
+
+	composeModeMultiline = "multiline"
+	composeModeQuick     = "quick"
+
+	keyPresetDefault = "default"
+	keyPresetVim     = "vim"
+	keyPresetEmacs   = "emacs"
+)
+
+// preferenceChoice is one of the values a preference cycles through.
+type preferenceChoice struct {
+	value string
+	label string
+}
+
+var (
+	alertScopeChoices = []preferenceChoice{
+		{alertScopeAll, "All messages"},
+		{alertScopeDirect, "Direct messages only"},
+	}
+	timestampFormatChoices = []preferenceChoice{
+		{timestampFormat24h, "24-hour"},
+		{timestampFormat12h, "12-hour"},
+		{timestampFormatISO, "ISO 8601"},
+	}
+	composeModeChoices = []preferenceChoice{
+		{composeModeMultiline, "Multi-line (ctrl+s sends)"},
+		{composeModeQuick, "Quick (enter sends)"},
+	}
+	keyPresetChoices = []preferenceChoice{
+		{keyPresetDefault, "Default"},
+		{keyPresetVim, "Vim"},
+		{keyPresetEmacs, "Emacs"},
+	}
+)
+
+// nextChoice returns the value after current, wrapping around.
+func nextChoice(choices []preferenceChoice, current string) string {
+	for i, choice := range choices {
+		if choice.value == current {
+			return choices[(i+1)%len(choices)].value
+		}
+	}
+	return choices[0].value
+}
+
+func choiceLabel(choices []preferenceChoice, value string) string {
+	for _, choice := range choices {
+		if choice.value == value {
+			return choice.label
+		}
+	}
+	return value
+}
+
+// timeLayout selects how much of a timestamp to show.
+type timeLayout int
+
+const (
+	timeFull  timeLayout = iota // Mon, Jan 2 2006 at 15:04 CET
+	timeShort                   // Jan 02 15:04
+	timeClock                   // 15:04
+)
+
+// timestampLayouts are the Go time layouts of each timestamp format, by
+// timeLayout. Short layouts keep a fixed width so they line up in lists.
+var timestampLayouts = map[string][3]string{
+	timestampFormat24h: {"Mon, Jan 2 2006 at 15:04 MST", "Jan 02 15:04", "15:04"},
+	timestampFormat12h: {"Mon, Jan 2 2006 at 3:04 PM MST", "Jan 02 03:04PM", "3:04 PM"},
+	timestampFormatISO: {"2006-01-02 15:04 -07:00", "2006-01-02 15:04", "15:04"},
+}
+
+// timeLayoutFor returns the Go time layout the user's format uses for l.
+func (m model) timeLayoutFor(l timeLayout) string {
+	layouts, ok := timestampLayouts[m.userSettings.TimestampFormat]
+	if !ok {
+		layouts = timestampLayouts[timestampFormat24h]
+	}
+	return layouts[l]
+}
+
+// formatTime formats t in the user's time zone and timestamp format. Users
+// who like relative times see recent ones that way instead, padded to the
+// width of the short layout.
+func (m model) formatTime(t time.Time, l timeLayout) string {
+	layout := m.timeLayoutFor(l)
+	formatted := t.In(m.location()).Format(layout)
+	if !m.userSettings.RelativeTimes || l == timeClock {
+		return formatted
+	}
+
+	relative, ok := relativeTime(t, time.Now())
+	if !ok {
+		return formatted
+	}
+	if l == timeShort {
+		return fmt.Sprintf("%*s", len(layout), relative)
+	}
+	return formatted + " (" + relative + ")"
+}
+
+// relativeTime describes t as seen from now, such as "5m ago" or "in 2h".
+// Times more than a week away aren't described.
+func relativeTime(t, now time.Time) (string, bool) {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+
+	var amount string
+	switch {
+	case d < time.Minute:
+		return "just now", true
+	case d < time.Hour:
+		amount = fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		amount = fmt.Sprintf("%dh", int(d.Hours()))
+	case d < 7*24*time.Hour:
+		amount = fmt.Sprintf("%dd", int(d.Hours()/24))
+	default:
+		return "", false
+	}
+	if future {
+		return "in " + amount, true
+	}
+	return amount + " ago", true
+}
+
+// location returns the user's time zone, falling back to the one their
+// terminal sent and then the server's.
+func (m model) location() *time.Location {
+	if m.timezone != nil {
+		return m.timezone
+	}
+	if m.sessionTimezone != nil {
+		return m.sessionTimezone
+	}
+	return time.Local
+}
+
+// loadTimezone returns the zone with the given IANA name, or nil if name is
+// empty or unknown.
+func loadTimezone(name string) *time.Location {
+	if name == "" {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+// timezoneFromEnv returns the zone in the TZ variable of a client's
+// environment. OpenSSH only sends it when configured with SendEnv TZ.
+func timezoneFromEnv(environ []string) *time.Location {
+	for _, kv := range environ {
+		if value, ok := strings.CutPrefix(kv, "TZ="); ok {
+			// POSIX allows a leading colon before a zone name
+			return loadTimezone(strings.TrimPrefix(value, ":"))
+		}
+	}
+	return nil
+}
+
+// applyUserSettings makes the session use settings.
+func (m *model) applyUserSettings(settings UserSettings) {
+	m.userSettings = settings
+
+	m.currentTheme = themeName(settings.Theme)
+	if _, ok := themes[m.currentTheme]; !ok {
+		// The theme file may have been removed since it was chosen
+		m.currentTheme = themeGruvbox
+	}
+
+	m.timezone = loadTimezone(settings.Timezone)
+
+	if m.renderer != nil {
+		m.renderer.SetColorProfile(m.colorProfile())
+	}
+
+	m.keys = newKeyMap(settings.KeyPreset, m.keyOverrides)
+}
+
+// colorProfile returns the profile the user chose, or the one detected for
+// their terminal.
+func (m model) colorProfile() termenv.Profile {
+	if profile, ok := colorProfiles[m.userSettings.ColorProfile]; ok {
+		return profile
+	}
+	return m.detectedColors
+}
+
+func (m model) openPreferences() (tea.Model, tea.Cmd) {
+	settings, err := m.db.GetUserSettings(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.applyUserSettings(settings)
+	m.currentScreen = preferencesScreen
+	m.selectedPreference = 0
+	m.editingTimezone = false
+	m.err = nil
+	m.successMsg = ""
+	return m, nil
+}
+
+// saveUserSettings stores settings and applies them to the session.
+func (m *model) saveUserSettings(settings UserSettings) error {
+	if err := m.db.SaveUserSettings(settings); err != nil {
+		return err
+	}
+	m.applyUserSettings(settings)
+	return nil
+}
+
+func (m model) updatePreferences(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	if m.editingTimezone {
+		switch msg.String() {
+		case "esc":
+			m.editingTimezone = false
+			m.timezoneInput.Blur()
+			m.err = nil
+			return m, nil
+
+		case "enter":
+			value := strings.TrimSpace(m.timezoneInput.Value())
+			if value != "" {
+				if _, err := time.LoadLocation(value); err != nil {
+					m.err = fmt.Errorf("unknown time zone %q (try a name such as Europe/Berlin)", value)
+					return m, nil
+				}
+			}
+			settings := m.userSettings
+			settings.Timezone = value
+			if err := m.saveUserSettings(settings); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.editingTimezone = false
+			m.timezoneInput.Blur()
+			m.successMsg = "Time zone set to " + m.location().String()
+			m.err = nil
+			return m, nil
+		}
+
+		m.timezoneInput, cmd = m.timezoneInput.Update(msg)
+		return m, cmd
+	}
+
+	// Theme, alerts, timestamps, relative times, time zone, compose mode,
+	// keybindings and colors
+	const rows = 8
+
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = settingsMenu
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keyDown):
+		m.selectedPreference = (m.selectedPreference + 1) % rows
+	case m.keys.matches(msg, keyUp):
+		m.selectedPreference = (m.selectedPreference - 1 + rows) % rows
+
+	case m.keys.matches(msg, keySelect):
+		settings := m.userSettings
+		switch m.selectedPreference {
+		case 0:
+			return m.openThemePicker()
+		case 1:
+			settings.AlertScope = nextChoice(alertScopeChoices, settings.AlertScope)
+			m.successMsg = "Alerts for " + strings.ToLower(choiceLabel(alertScopeChoices, settings.AlertScope))
+		case 2:
+			settings.TimestampFormat = nextChoice(timestampFormatChoices, settings.TimestampFormat)
+			m.successMsg = choiceLabel(timestampFormatChoices, settings.TimestampFormat) + " timestamps"
+		case 3:
+			settings.RelativeTimes = !settings.RelativeTimes
+			m.successMsg = "Recent times shown as exact times"
+			if settings.RelativeTimes {
+				m.successMsg = "Recent times shown as \"5m ago\""
+			}
+		case 4:
+			m.editingTimezone = true
+			m.timezoneInput.SetValue(settings.Timezone)
+			m.timezoneInput.CursorEnd()
+			m.err = nil
+			m.successMsg = ""
+			return m, m.timezoneInput.Focus()
+		case 5:
+			settings.ComposeMode = nextChoice(composeModeChoices, settings.ComposeMode)
+			m.successMsg = "Compose mode: " + choiceLabel(composeModeChoices, settings.ComposeMode)
+		case 6:
+			return m.openKeyBindings()
+		case 7:
+			settings.ColorProfile = nextChoice(colorProfileChoices, settings.ColorProfile)
+			m.successMsg = "Colors: " + m.colorProfileValue(settings.ColorProfile)
+		}
+
+		if err := m.saveUserSettings(settings); err != nil {
+			m.err = err
+			m.successMsg = ""
+			return m, nil
+		}
+		m.err = nil
+	}
+	return m, nil
+}
+
+// colorProfileValue describes a color profile setting, naming what was
+// detected when it is automatic.
+func (m model) colorProfileValue(value string) string {
+	if value == colorProfileAuto {
+		return "Automatic (" + colorProfileLabel(m.detectedColors) + ")"
+	}
+	return choiceLabel(colorProfileChoices, value)
+}
+
+func (m model) viewPreferences() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("🔧  Preferences")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	if m.editingTimezone {
+		s.WriteString(st.inputLabelStyle.Render("Time zone, such as Europe/Berlin or America/New_York"))
+		s.WriteString("\n\n")
+
+		// Error message (fixed height to keep bottom elements stable)
+		if m.err != nil {
+			s.WriteString(st.errorStyle.Render(" ✗ " + m.err.Error() + " "))
+		}
+		s.WriteString("\n\n")
+
+		input := st.inputBoxStyle.Width(m.contentWidth()).Render(m.timezoneInput.View())
+		s.WriteString(input)
+		s.WriteString("\n")
+		s.WriteString(st.helpStyle.Render("Press [enter] to save • leave empty for your terminal's or the server's • [esc] to cancel"))
+		return s.String()
+	}
+
+	timezone := m.userSettings.Timezone
+	switch {
+	case timezone != "":
+	case m.sessionTimezone != nil:
+		timezone = "From your terminal (" + m.sessionTimezone.String() + ")"
+	default:
+		zone, _ := time.Now().Zone()
+		timezone = "Server time (" + zone + ")"
+	}
+	relativeTimes := "Off"
+	if m.userSettings.RelativeTimes {
+		relativeTimes = "On"
+	}
+	keyBindings := choiceLabel(keyPresetChoices, m.userSettings.KeyPreset)
+	if n := len(m.keyOverrides); n > 0 {
+		keyBindings += fmt.Sprintf(" with %d of your own", n)
+	}
+	rows := []struct{ label, value string }{
+		{"Theme", themes[m.currentTheme].name},
+		{"Alert me about", choiceLabel(alertScopeChoices, m.userSettings.AlertScope)},
+		{"Timestamps", choiceLabel(timestampFormatChoices, m.userSettings.TimestampFormat) + " • " + m.formatTime(time.Now(), timeFull)},
+		{"Relative times", relativeTimes},
+		{"Time zone", timezone},
+		{"Compose mode", choiceLabel(composeModeChoices, m.userSettings.ComposeMode)},
+		{"Keybindings", keyBindings},
+		{"Colors", m.colorProfileValue(m.userSettings.ColorProfile)},
+	}
+
+	labelStyle := m.renderer.NewStyle().Width(16)
+	valueStyle := m.renderer.NewStyle().Foreground(st.textColor)
+	for i, row := range rows {
+		// Long values are cut short on narrow terminals
+		row.value = ansi.Truncate(row.value, m.contentWidth()-20, "…")
+		if i == m.selectedPreference {
+			indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+			s.WriteString("  " + indicator + labelStyle.Foreground(st.selectionColor).Bold(true).Render(row.label) + valueStyle.Render(row.value))
+		} else {
+			s.WriteString("    " + labelStyle.Foreground(st.accentColor).Render(row.label) + valueStyle.Render(row.value))
+		}
+		s.WriteString("\n")
+	}
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.Render(m.keyHint(keySelect, "to change") + " • " + m.navHint() + " • " + m.keyHint(keyBack, "to return")))
+
+	return s.String()
+}
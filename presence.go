@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	statusOnline = "online"
+	statusAway   = "away"
+	statusIdle   = "idle"
+
+	// How long after the last key press a session counts as away or idle
+	awayAfter = 5 * time.Minute
+	idleAfter = 30 * time.Minute
+)
+
+// Presence tracks connected SSH sessions so users can see who else is
+// online, and so the server can push messages into running sessions. All
+// methods are safe to call on a nil *Presence.
+type Presence struct {
+	mu       sync.Mutex
+	nextID   int
+	sessions map[int]*presenceSession
+}
+
+type presenceSession struct {
+	fingerprint  string
+	program      *tea.Program
+	connectedAt  time.Time
+	lastActivity time.Time
+}
+
+// OnlineUser summarizes the sessions of one connected user.
+type OnlineUser struct {
+	Fingerprint  string
+	Status       string
+	Sessions     int
+	ConnectedAt  time.Time // Earliest session
+	LastActivity time.Time // Most recent key press in any session
+}
+
+// presenceChangedMsg tells running sessions that someone connected or
+// disconnected.
+type presenceChangedMsg struct{}
+
+func NewPresence() *Presence {
+	return &Presence{sessions: make(map[int]*presenceSession)}
+}
+
+// Connect registers a new session and returns its ID.
+func (p *Presence) Connect(fingerprint string) int {
+	if p == nil {
+		return 0
+	}
+	p.mu.Lock()
+	p.nextID++
+	id := p.nextID
+	now := time.Now()
+	p.sessions[id] = &presenceSession{fingerprint: fingerprint, connectedAt: now, lastActivity: now}
+	p.mu.Unlock()
+
+	p.Broadcast(presenceChangedMsg{})
+	return id
+}
+
+// SetProgram attaches the session's running program so messages can be
+// pushed to it.
+func (p *Presence) SetProgram(id int, program *tea.Program) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s, ok := p.sessions[id]; ok {
+		s.program = program
+	}
+}
+
+func (p *Presence) Disconnect(id int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	delete(p.sessions, id)
+	p.mu.Unlock()
+
+	p.Broadcast(presenceChangedMsg{})
+}
+
+// Touch records keyboard activity in a session.
+func (p *Presence) Touch(id int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s, ok := p.sessions[id]; ok {
+		s.lastActivity = time.Now()
+	}
+}
+
+// Online returns everyone with at least one session, most recently active
+// first.
+func (p *Presence) Online() []OnlineUser {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	byUser := make(map[string]*OnlineUser)
+	for _, s := range p.sessions {
+		u, ok := byUser[s.fingerprint]
+		if !ok {
+			u = &OnlineUser{Fingerprint: s.fingerprint, ConnectedAt: s.connectedAt}
+			byUser[s.fingerprint] = u
+		}
+		u.Sessions++
+		if s.connectedAt.Before(u.ConnectedAt) {
+			u.ConnectedAt = s.connectedAt
+		}
+		if s.lastActivity.After(u.LastActivity) {
+			u.LastActivity = s.lastActivity
+		}
+	}
+	p.mu.Unlock()
+
+	users := make([]OnlineUser, 0, len(byUser))
+	for _, u := range byUser {
+		u.Status = activityStatus(u.LastActivity)
+		users = append(users, *u)
+	}
+	slices.SortFunc(users, func(a, b OnlineUser) int {
+		return b.LastActivity.Compare(a.LastActivity)
+	})
+	return users
+}
+
+// Status returns the user's status, or "" if they are not connected.
+func (p *Presence) Status(fingerprint string) string {
+	for _, u := range p.Online() {
+		if u.Fingerprint == fingerprint {
+			return u.Status
+		}
+	}
+	return ""
+}
+
+// Send delivers msg to every session of the user. It reports whether the
+// user had any session to deliver to.
+func (p *Presence) Send(fingerprint string, msg tea.Msg) bool {
+	if p == nil {
+		return false
+	}
+	var programs []*tea.Program
+	p.mu.Lock()
+	for _, s := range p.sessions {
+		if s.fingerprint == fingerprint && s.program != nil {
+			programs = append(programs, s.program)
+		}
+	}
+	p.mu.Unlock()
+
+	// Program.Send blocks until the program reads the message
+	for _, program := range programs {
+		go program.Send(msg)
+	}
+	return len(programs) > 0
+}
+
+// Broadcast delivers msg to every session.
+func (p *Presence) Broadcast(msg tea.Msg) {
+	if p == nil {
+		return
+	}
+	var programs []*tea.Program
+	p.mu.Lock()
+	for _, s := range p.sessions {
+		if s.program != nil {
+			programs = append(programs, s.program)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, program := range programs {
+		go program.Send(msg)
+	}
+}
+
+func activityStatus(lastActivity time.Time) string {
+	switch since := time.Since(lastActivity); {
+	case since < awayAfter:
+		return statusOnline
+	case since < idleAfter:
+		return statusAway
+	default:
+		return statusIdle
+	}
+}
+
+// formatDuration renders a coarse duration such as "3m" or "2h 5m".
+func formatDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "<1m"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	default:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+}
+
+func (m model) openWhosOnline() (tea.Model, tea.Cmd) {
+	m.currentScreen = whosOnline
+	m.selectedOnlineUser = 0
+	m.err = nil
+	m.successMsg = ""
+	return m.reloadWhosOnline()
+}
+
+// reloadWhosOnline refreshes the list. People who hide their last seen time
+// are left out of it too.
+func (m model) reloadWhosOnline() (tea.Model, tea.Cmd) {
+	var users []OnlineUser
+	names := make(map[string]string)
+	for _, u := range m.presence.Online() {
+		profile, err := m.db.GetProfile(u.Fingerprint)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		if !profile.ShowLastSeen && u.Fingerprint != m.userKey {
+			continue
+		}
+		names[u.Fingerprint] = profile.DisplayName
+		users = append(users, u)
+	}
+	m.onlineUsers = users
+	m.onlineNames = names
+
+	if m.selectedOnlineUser >= len(users) {
+		m.selectedOnlineUser = max(len(users)-1, 0)
+	}
+	return m, nil
+}
+
+func (m model) updateWhosOnline(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = mainMenu
+		m.onlineUsers = nil
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keyDown):
+		if len(m.onlineUsers) > 0 {
+			m.selectedOnlineUser = (m.selectedOnlineUser + 1) % len(m.onlineUsers)
+		}
+	case m.keys.matches(msg, keyUp):
+		if len(m.onlineUsers) > 0 {
+			m.selectedOnlineUser = (m.selectedOnlineUser - 1 + len(m.onlineUsers)) % len(m.onlineUsers)
+		}
+
+	case m.keys.matches(msg, keyRefresh):
+		return m.reloadWhosOnline()
+
+	case m.keys.matches(msg, keyProfile):
+		if len(m.onlineUsers) > 0 {
+			return m.openProfile(m.onlineUsers[m.selectedOnlineUser].Fingerprint)
+		}
+
+	case m.keys.matches(msg, keyChat):
+		if len(m.onlineUsers) > 0 {
+			return m.openChat(m.onlineUsers[m.selectedOnlineUser].Fingerprint)
+		}
+
+	case m.keys.matches(msg, keySelect, keyMessage):
+		if len(m.onlineUsers) == 0 {
+			return m, nil
+		}
+		key := m.onlineUsers[m.selectedOnlineUser].Fingerprint
+		if key == m.userKey {
+			return m, nil
+		}
+		return m.openCompose(key, nil)
+	}
+	return m, nil
+}
+
+func (m model) viewWhosOnline() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("🟢  Who's Online")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	if len(m.onlineUsers) == 0 {
+		s.WriteString(st.emptyStateStyle.Width(m.contentWidth()).Render("Nobody else is here right now."))
+		s.WriteString("\n")
+	}
+
+	for i, u := range m.onlineUsers {
+		dotStyle := m.renderer.NewStyle().Foreground(st.mutedColor)
+		dot := "○"
+		switch u.Status {
+		case statusOnline:
+			dotStyle, dot = dotStyle.Foreground(st.successColor), "●"
+		case statusAway:
+			dotStyle, dot = dotStyle.Foreground(st.highlight), "◐"
+		}
+
+		name := m.onlineNames[u.Fingerprint]
+		if name == "" {
+			name = u.Fingerprint[:min(20, len(u.Fingerprint))]
+		}
+		if len([]rune(name)) > 24 {
+			name = string([]rune(name)[:21]) + "..."
+		}
+		if u.Fingerprint == m.userKey {
+			name += " (you)"
+		}
+
+		line := fmt.Sprintf("%-30s %-7s for %s", name, u.Status, formatDuration(time.Since(u.ConnectedAt)))
+		if u.Sessions > 1 {
+			line += fmt.Sprintf(" • %d sessions", u.Sessions)
+		}
+
+		if i == m.selectedOnlineUser {
+			indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+			s.WriteString("  " + indicator + dotStyle.Render(dot) + " " + m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Render(line))
+		} else {
+			s.WriteString("    " + dotStyle.Render(dot) + " " + m.renderer.NewStyle().Foreground(st.textColor).Render(line))
+		}
+		s.WriteString("\n")
+	}
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.Width(m.contentWidth()).Render(m.keyHint(keyChat, "to chat") + " • " + m.keyHint(keySelect, "to message") + " • " + m.keyHint(keyProfile, "for profile") + " • " + m.keyHint(keyRefresh, "to refresh") + " • " + m.navHint() + " • " + m.keyHint(keyBack, "to return")))
+
+	return s.String()
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// profileField is one editable line of the profile screen.
+type profileField struct {
+	label    string
+	limit    int
+	get      func(p Profile) string
+	set      func(p *Profile, value string)
+	validate func(value string) error
+}
+
+var profileFields = []profileField{
+	{"Name", 40, func(p Profile) string { return p.DisplayName }, func(p *Profile, v string) { p.DisplayName = v }, nil},
+	{"Pronouns", 24, func(p Profile) string { return p.Pronouns }, func(p *Profile, v string) { p.Pronouns = v }, nil},
+	{"Status", 80, func(p Profile) string { return p.Status }, func(p *Profile, v string) { p.Status = v }, nil},
+	{"Bio", 280, func(p Profile) string { return p.Bio }, func(p *Profile, v string) { p.Bio = v }, nil},
+	{"Link", 200, func(p Profile) string { return p.Link }, func(p *Profile, v string) { p.Link = v }, validateProfileLink},
+}
+
+func validateProfileLink(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("link must be an http:// or https:// URL")
+	}
+	return nil
+}
+
+func (m model) openProfileSettings() (tea.Model, tea.Cmd) {
+	profile, err := m.db.GetProfile(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.profile = profile
+	m.currentScreen = profileSettings
+	m.selectedProfileField = 0
+	m.editingProfileField = false
+	m.err = nil
+	m.successMsg = ""
+	return m, nil
+}
+
+func (m model) updateProfileSettings(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	if m.editingProfileField {
+		field := profileFields[m.selectedProfileField]
+		switch msg.String() {
+		case "esc":
+			m.editingProfileField = false
+			m.profileInput.Blur()
+			m.err = nil
+			return m, nil
+
+		case "enter":
+			value := strings.TrimSpace(m.profileInput.Value())
+			if field.validate != nil {
+				if err := field.validate(value); err != nil {
+					m.err = err
+					return m, nil
+				}
+			}
+			profile := m.profile
+			field.set(&profile, value)
+			if err := m.db.SaveProfile(profile); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.profile = profile
+			m.editingProfileField = false
+			m.profileInput.Blur()
+			m.successMsg = field.label + " saved"
+			m.err = nil
+			return m, nil
+		}
+
+		m.profileInput, cmd = m.profileInput.Update(msg)
+		return m, cmd
+	}
+
+	// The last row is the last-seen privacy toggle
+	rows := len(profileFields) + 1
+
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = settingsMenu
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keyDown):
+		m.selectedProfileField = (m.selectedProfileField + 1) % rows
+	case m.keys.matches(msg, keyUp):
+		m.selectedProfileField = (m.selectedProfileField - 1 + rows) % rows
+
+	case m.keys.matches(msg, keySelect):
+		if m.selectedProfileField == len(profileFields) {
+			profile := m.profile
+			profile.ShowLastSeen = !profile.ShowLastSeen
+			if err := m.db.SaveProfile(profile); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.profile = profile
+			if profile.ShowLastSeen {
+				m.successMsg = "Others can see when you were last online"
+			} else {
+				m.successMsg = "Your last seen time is now hidden"
+			}
+			m.err = nil
+			return m, nil
+		}
+
+		field := profileFields[m.selectedProfileField]
+		m.editingProfileField = true
+		m.profileInput.CharLimit = field.limit
+		m.profileInput.Placeholder = field.label
+		m.profileInput.SetValue(field.get(m.profile))
+		m.profileInput.CursorEnd()
+		m.err = nil
+		m.successMsg = ""
+		return m, m.profileInput.Focus()
+
+	case m.keys.matches(msg, keyProfile):
+		return m.openProfile(m.userKey)
+	}
+	return m, nil
+}
+
+func (m model) viewProfileSettings() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("👤  Your Profile")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	if m.editingProfileField {
+		field := profileFields[m.selectedProfileField]
+		s.WriteString(st.inputLabelStyle.Render(fmt.Sprintf("%s (up to %d characters)", field.label, field.limit)))
+		s.WriteString("\n\n")
+
+		// Error message (fixed height to keep bottom elements stable)
+		if m.err != nil {
+			s.WriteString(st.errorStyle.Render(" ✗ " + m.err.Error() + " "))
+		}
+		s.WriteString("\n\n")
+
+		input := st.inputBoxStyle.Width(m.contentWidth()).Render(m.profileInput.View())
+		s.WriteString(input)
+		s.WriteString("\n")
+		s.WriteString(st.helpStyle.Render("Press [enter] to save • leave empty to clear • [esc] to cancel"))
+		return s.String()
+	}
+
+	labelStyle := m.renderer.NewStyle().Width(12)
+	for i := 0; i <= len(profileFields); i++ {
+		var label, value string
+		if i < len(profileFields) {
+			label = profileFields[i].label
+			value = profileFields[i].get(m.profile)
+			if len([]rune(value)) > 50 {
+				value = string([]rune(value)[:47]) + "..."
+			}
+		} else {
+			label = "Last seen"
+			value = "hidden from others"
+			if m.profile.ShowLastSeen {
+				value = "visible to everyone"
+			}
+		}
+
+		valueStyle := m.renderer.NewStyle().Foreground(st.textColor)
+		if value == "" {
+			value = "not set"
+			valueStyle = valueStyle.Foreground(st.mutedColor).Italic(true)
+		}
+
+		if i == m.selectedProfileField {
+			indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+			s.WriteString("  " + indicator + labelStyle.Foreground(st.selectionColor).Bold(true).Render(label) + valueStyle.Render(value))
+		} else {
+			s.WriteString("    " + labelStyle.Foreground(st.accentColor).Render(label) + valueStyle.Render(value))
+		}
+		s.WriteString("\n")
+	}
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.Render(m.keyHint(keySelect, "to edit") + " • " + m.keyHint(keyProfile, "to preview") + " • " + m.navHint() + " • " + m.keyHint(keyBack, "to return")))
+
+	return s.String()
+}
+
+// openProfile shows a user's public profile. Esc returns to the screen it
+// was opened from.
+func (m model) openProfile(fingerprint string) (tea.Model, tea.Cmd) {
+	user, err := m.db.GetUser(fingerprint)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	if user == nil {
+		m.err = fmt.Errorf("no user with that fingerprint has connected yet")
+		return m, nil
+	}
+	profile, err := m.db.GetProfile(fingerprint)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	following, err := m.db.GetFollowing(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	botIDs, err := m.db.GetBotIDs()
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+
+	m.viewedUser = user
+	m.viewedProfile = profile
+	m.following = following
+	m.botIDs = botIDs
+	if m.currentScreen != profileView {
+		m.profileReturnScreen = m.currentScreen
+	}
+	m.currentScreen = profileView
+	m.err = nil
+	m.successMsg = ""
+	return m, nil
+}
+
+func (m model) updateProfileView(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := m.viewedUser.SSHKeyFingerprint
+
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = m.profileReturnScreen
+		m.viewedUser = nil
+		m.err = nil
+		m.successMsg = ""
+		if m.currentScreen == timeline {
+			// Follow state may have changed
+			return m.reloadTimeline()
+		}
+
+	case m.keys.matches(msg, keyCopy):
+		m.clipboardText = key
+		m.successMsg = "Fingerprint copied to clipboard!"
+
+	case m.keys.matches(msg, keyMessage):
+		if key == m.userKey {
+			return m, nil
+		}
+		return m.openCompose(key, nil)
+
+	case m.keys.matches(msg, keyFollow):
+		if key == m.userKey {
+			return m, nil
+		}
+		if m.following[key] {
+			if err := m.db.Unfollow(m.userKey, key); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.successMsg = "Unfollowed"
+		} else {
+			if err := m.db.Follow(m.userKey, key); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.successMsg = "Following"
+		}
+		following, err := m.db.GetFollowing(m.userKey)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.following = following
+		m.err = nil
+	}
+	return m, nil
+}
+
+func (m model) viewProfileView() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	user := m.viewedUser
+	profile := m.viewedProfile
+	isSelf := user.SSHKeyFingerprint == m.userKey
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("👤  Profile")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	// Name line with pronouns and badges
+	name := profile.DisplayName
+	if name == "" {
+		name = "Anonymous"
+	}
+	nameLine := m.renderer.NewStyle().Foreground(st.primaryColor).Bold(true).Render(name)
+	if profile.Pronouns != "" {
+		nameLine += m.renderer.NewStyle().Foreground(st.mutedColor).Render(" (" + profile.Pronouns + ")")
+	}
+	if m.botIDs[user.SSHKeyFingerprint] {
+		nameLine += " " + st.botBadgeStyle.Render(" BOT ")
+	}
+	if isSelf {
+		nameLine += m.renderer.NewStyle().Foreground(st.mutedColor).Render(" (you)")
+	} else if m.following[user.SSHKeyFingerprint] {
+		nameLine += m.renderer.NewStyle().Foreground(st.accentColor).Render(" ✓ following")
+	}
+	s.WriteString("  " + nameLine)
+	s.WriteString("\n")
+	s.WriteString("  " + m.renderer.NewStyle().Foreground(st.mutedColor).Render(user.SSHKeyFingerprint))
+	s.WriteString("\n\n")
+
+	if profile.Status != "" {
+		s.WriteString("  " + m.renderer.NewStyle().Foreground(st.secondaryColor).Italic(true).Render("“"+profile.Status+"”"))
+		s.WriteString("\n\n")
+	}
+
+	if profile.Bio != "" {
+		bio := m.renderer.NewStyle().Foreground(st.textColor).Width(m.bodyWidth()).PaddingLeft(2).Render(profile.Bio)
+		s.WriteString(bio)
+		s.WriteString("\n\n")
+	}
+
+	labelStyle := m.renderer.NewStyle().Foreground(st.accentColor).Width(14).PaddingLeft(2)
+	valueStyle := m.renderer.NewStyle().Foreground(st.textColor)
+	if profile.Link != "" {
+		s.WriteString(labelStyle.Render("Link") + valueStyle.Render(profile.Link))
+		s.WriteString("\n")
+	}
+	s.WriteString(labelStyle.Render("Joined") + valueStyle.Render(user.FirstSeen.In(m.location()).Format("Jan 2, 2006")))
+	s.WriteString("\n")
+	if profile.ShowLastSeen || isSelf {
+		if status := m.presence.Status(user.SSHKeyFingerprint); status != "" {
+			s.WriteString(labelStyle.Render("Last seen") + m.renderer.NewStyle().Foreground(st.successColor).Render(status+" now"))
+		} else {
+			s.WriteString(labelStyle.Render("Last seen") + valueStyle.Render(m.formatTime(user.LastSeen, timeFull)))
+		}
+	} else {
+		s.WriteString(labelStyle.Render("Last seen") + m.renderer.NewStyle().Foreground(st.mutedColor).Italic(true).Render("hidden"))
+	}
+	s.WriteString("\n")
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	help := m.keyHint(keyMessage, "to message") + " • " + m.keyHint(keyFollow, "to follow") + " • " + m.keyHint(keyCopy, "to copy fingerprint") + " • " + m.keyHint(keyBack, "to return")
+	if isSelf {
+		help = m.keyHint(keyCopy, "to copy fingerprint") + " • " + m.keyHint(keyBack, "to return")
+	}
+	s.WriteString(st.helpStyle.Render(help))
+
+	return s.String()
+}
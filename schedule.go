@@ -0,0 +1,471 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+)
+
+// How often the queue is checked for messages that are due
+const scheduledSendInterval = 10 * time.Second
+
+// How far ahead messages can be scheduled
+const maxScheduleAhead = 365 * 24 * time.Hour
+
+// Time of day for days given without one, such as "tomorrow"
+const defaultScheduleHour = 9
+
+// How many messages each user can have waiting to be sent
+const maxScheduledPerUser = 50
+
+// scheduledSentMsg tells the sender's sessions that the queue changed.
+type scheduledSentMsg struct{}
+
+// runScheduledSender delivers scheduled messages once they are due.
+func runScheduledSender(ctx context.Context, db *Database, webhooks *Webhooks, presence *Presence) {
+	ticker := time.NewTicker(scheduledSendInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sendDueMessages(db, webhooks, presence)
+		}
+	}
+}
+
+func sendDueMessages(db *Database, webhooks *Webhooks, presence *Presence) {
+	due, err := db.GetDueScheduledMessages(utcNow())
+	if err != nil {
+		log.Printf("Failed to load scheduled messages: %v", err)
+		return
+	}
+
+	for _, msg := range due {
+		// Sessions may cancel or change the message until it is claimed
+		claimed, err := db.ClaimScheduledMessage(msg.ID)
+		if err != nil {
+			log.Printf("Failed to claim scheduled message %d: %v", msg.ID, err)
+			continue
+		}
+		if claimed == nil {
+			continue
+		}
+
+		if err := deliverScheduledMessage(db, webhooks, presence, *claimed); err != nil {
+			// Back in the queue for the sender to fix or cancel
+			log.Printf("Failed to send scheduled message %d: %v", msg.ID, err)
+			claimed.Error = err.Error()
+			if _, err := db.ScheduleMessage(*claimed); err != nil {
+				log.Printf("Failed to requeue scheduled message %d: %v", msg.ID, err)
+			}
+		}
+		presence.Send(claimed.FromKey, scheduledSentMsg{})
+	}
+}
+
+func deliverScheduledMessage(db *Database, webhooks *Webhooks, presence *Presence, msg ScheduledMessage) error {
+	if msg.GroupID != 0 {
+		sent, err := db.SendGroupMessage(msg.FromKey, msg.GroupID, msg.Body)
+		if err != nil {
+			return err
+		}
+		for _, sentMsg := range sent {
+			go webhooks.Emit(eventMessageReceived, sentMsg.ToKey, sentMsg)
+			presence.Send(sentMsg.ToKey, newMailMsg{sentMsg})
+		}
+		return nil
+	}
+
+	sent, err := db.SendMessage(msg.FromKey, msg.Recipient, msg.Body)
+	if err != nil {
+		return err
+	}
+	go webhooks.Emit(eventMessageReceived, msg.Recipient, sent)
+	presence.Send(msg.Recipient, newMailMsg{sent})
+	return nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// parseSendTime reads when to send a message. It understands delays such as
+// "in 2h" or "in 3 days", days and times such as "tomorrow 9am", "fri
+// 17:30" or "noon", and dates such as "2026-03-01 08:00". Times are in loc.
+func parseSendTime(input string, now time.Time, loc *time.Location) (time.Time, error) {
+	input = strings.TrimSpace(input)
+	at, ok := parseSendTimeIn(input, now.In(loc))
+	if !ok {
+		return time.Time{}, fmt.Errorf(`couldn't understand %q, try "in 2h", "tomorrow 9am" or "YYYY-MM-DD HH:MM"`, input)
+	}
+	if !at.After(now) {
+		return time.Time{}, fmt.Errorf("%s has already passed", at.Format("Mon, Jan 2 2006 at 15:04"))
+	}
+	if at.Sub(now) > maxScheduleAhead {
+		return time.Time{}, fmt.Errorf("messages can be scheduled at most a year ahead")
+	}
+	return at, nil
+}
+
+func parseSendTimeIn(input string, now time.Time) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02"} {
+		if at, err := time.ParseInLocation(layout, input, now.Location()); err == nil {
+			if layout == "2006-01-02" {
+				at = time.Date(at.Year(), at.Month(), at.Day(), defaultScheduleHour, 0, 0, 0, at.Location())
+			}
+			return at, true
+		}
+	}
+
+	fields := strings.Fields(strings.ToLower(input))
+	if len(fields) > 1 && fields[0] == "in" {
+		delay, ok := parseDelay(fields[1:])
+		return now.Add(delay), ok && delay > 0
+	}
+
+	// A day, a time of day or both, in either order
+	days, hour, minute := -1, -1, 0
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		if i+1 < len(fields) && (fields[i+1] == "am" || fields[i+1] == "pm") {
+			field += fields[i+1]
+			i++
+		}
+		switch field {
+		case "at", "on", "next":
+			continue
+		case "today":
+			days = 0
+			continue
+		case "tomorrow":
+			days = 1
+			continue
+		}
+		if weekday, ok := weekdays[field]; ok {
+			// The coming one, a week from now on the day itself
+			days = (int(weekday)-int(now.Weekday())+6)%7 + 1
+			continue
+		}
+		h, m, ok := parseClock(field)
+		if !ok || hour >= 0 {
+			return time.Time{}, false
+		}
+		hour, minute = h, m
+	}
+
+	switch {
+	case days < 0 && hour < 0:
+		return time.Time{}, false
+	case hour < 0:
+		hour = defaultScheduleHour
+	}
+	at := time.Date(now.Year(), now.Month(), now.Day()+max(days, 0), hour, minute, 0, 0, now.Location())
+	if days < 0 && !at.After(now) {
+		// A time that has passed today means tomorrow
+		at = at.AddDate(0, 0, 1)
+	}
+	return at, true
+}
+
+// parseDelay reads the part of "in 2h", "in 90 minutes" or "in a week" after
+// "in".
+func parseDelay(fields []string) (time.Duration, bool) {
+	if d, err := time.ParseDuration(strings.Join(fields, "")); err == nil {
+		return d, true
+	}
+	if len(fields) != 2 {
+		return 0, false
+	}
+
+	n, err := strconv.Atoi(fields[0])
+	if fields[0] == "a" || fields[0] == "an" {
+		n, err = 1, nil
+	}
+	if err != nil {
+		return 0, false
+	}
+	switch strings.TrimSuffix(fields[1], "s") {
+	case "min", "minute":
+		return time.Duration(n) * time.Minute, true
+	case "hr", "hour":
+		return time.Duration(n) * time.Hour, true
+	case "day":
+		return time.Duration(n) * 24 * time.Hour, true
+	case "week":
+		return time.Duration(n) * 7 * 24 * time.Hour, true
+	}
+	return 0, false
+}
+
+// parseClock reads a time of day such as "9am", "9:30pm", "17:00" or "noon".
+func parseClock(s string) (hour, minute int, ok bool) {
+	switch s {
+	case "noon":
+		return 12, 0, true
+	case "midnight":
+		return 0, 0, true
+	}
+
+	suffix := ""
+	if strings.HasSuffix(s, "am") || strings.HasSuffix(s, "pm") {
+		s, suffix = s[:len(s)-2], s[len(s)-2:]
+	}
+	h, m, hasMinutes := strings.Cut(s, ":")
+	hour, err := strconv.Atoi(h)
+	if err != nil {
+		return 0, 0, false
+	}
+	if hasMinutes {
+		if len(m) != 2 {
+			return 0, 0, false
+		}
+		if minute, err = strconv.Atoi(m); err != nil || minute < 0 || minute > 59 {
+			return 0, 0, false
+		}
+	}
+
+	switch suffix {
+	case "":
+		if hour < 0 || hour > 23 {
+			return 0, 0, false
+		}
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return 0, 0, false
+		}
+		hour %= 12
+		if suffix == "pm" {
+			hour += 12
+		}
+	}
+	return hour, minute, true
+}
+
+// openSchedulePrompt asks when to send the message being written.
+func (m model) openSchedulePrompt() (tea.Model, tea.Cmd) {
+	if strings.TrimSpace(m.messageInput.Value()) == "" {
+		m.err = fmt.Errorf("message cannot be empty")
+		return m, nil
+	}
+	m.scheduling = true
+	m.composePreview = false
+	m.scheduleInput.SetValue("")
+	if m.editingScheduled != nil {
+		m.scheduleInput.SetValue(m.editingScheduled.SendAt.In(m.location()).Format("2006-01-02 15:04"))
+	}
+	m.messageInput.Blur()
+	m.err = nil
+	m.successMsg = ""
+	return m, m.scheduleInput.Focus()
+}
+
+func (m model) updateSchedulePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	switch msg.String() {
+	case "esc":
+		m.scheduling = false
+		m.scheduleInput.Blur()
+		m.err = nil
+		return m, m.messageInput.Focus()
+
+	case "enter":
+		at, err := parseSendTime(m.scheduleInput.Value(), time.Now(), m.location())
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.scheduling = false
+		m.scheduleInput.Blur()
+
+		if m.editingScheduled != nil {
+			return m.saveScheduledEdit(at)
+		}
+
+		// Queued messages count against the same limit as sending now, so
+		// the queue can't be used to send faster
+		if !m.rateLimiter.CanSendMessage(m.userKey) {
+			m.err = fmt.Errorf("rate limit: please wait 10 seconds between messages")
+			return m, m.messageInput.Focus()
+		}
+		pending, err := m.db.CountScheduledMessages(m.userKey)
+		if err != nil {
+			m.err = err
+			return m, m.messageInput.Focus()
+		}
+		if pending >= maxScheduledPerUser {
+			m.err = fmt.Errorf("you already have %d messages scheduled, cancel one first", pending)
+			return m, m.messageInput.Focus()
+		}
+
+		scheduled := ScheduledMessage{
+			FromKey:   m.userKey,
+			Recipient: m.recipient,
+			Body:      m.messageInput.Value(),
+			SendAt:    at,
+		}
+		if m.recipientGroup != nil {
+			scheduled.GroupID = m.recipientGroup.ID
+		}
+		if _, err := m.db.ScheduleMessage(scheduled); err != nil {
+			m.err = err
+			return m, m.messageInput.Focus()
+		}
+		m.rateLimiter.RecordMessage(m.userKey)
+
+		m.currentScreen = mainMenu
+		m.recipient = ""
+		m.recipientGroup = nil
+		m.err = m.draft.discard()
+		m.successMsg = "Message scheduled for " + m.formatTime(at, timeFull)
+		m.refreshDraftCounts()
+		return m, nil
+	}
+
+	m.scheduleInput, cmd = m.scheduleInput.Update(msg)
+	return m, cmd
+}
+
+// openScheduledEdit changes the text or time of a message that hasn't been
+// sent yet. It isn't autosaved: leaving without saving keeps the message as
+// it was.
+func (m model) openScheduledEdit(scheduled ScheduledMessage) (tea.Model, tea.Cmd) {
+	var group *Group
+	if scheduled.GroupID != 0 {
+		var err error
+		if group, err = m.resolveGroupRecipient(scheduled.Recipient); err != nil {
+			m.err = err
+			return m, nil
+		}
+	}
+
+	m.currentScreen = sendMessageContent
+	m.recipient = scheduled.Recipient
+	m.recipientGroup = group
+	m.composePreview = false
+	m.editingScheduled = &scheduled
+	m.messageInput.SetValue(scheduled.Body)
+	m.draftGen++ // Stops autosaving whatever was written before
+	m.err = nil
+	m.successMsg = ""
+	return m, m.messageInput.Focus()
+}
+
+// saveScheduledEdit stores the edited message to be sent at at and goes back
+// to the scheduled messages.
+func (m model) saveScheduledEdit(at time.Time) (tea.Model, tea.Cmd) {
+	if strings.TrimSpace(m.messageInput.Value()) == "" {
+		m.err = fmt.Errorf("message cannot be empty")
+		return m, m.messageInput.Focus()
+	}
+	edited := *m.editingScheduled
+	edited.Body = m.messageInput.Value()
+	edited.SendAt = at
+	if err := m.db.UpdateScheduledMessage(edited); err != nil {
+		m.err = err
+		return m, m.messageInput.Focus()
+	}
+
+	m.closeEdit()
+	m.successMsg = "Message rescheduled for " + m.formatTime(at, timeFull)
+	return m.reloadDrafts()
+}
+
+func (m model) updateScheduled(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case m.keys.matches(msg, keyDown):
+		if len(m.scheduled) > 0 {
+			m.selectedScheduled = (m.selectedScheduled + 1) % len(m.scheduled)
+		}
+	case m.keys.matches(msg, keyUp):
+		if len(m.scheduled) > 0 {
+			m.selectedScheduled = (m.selectedScheduled - 1 + len(m.scheduled)) % len(m.scheduled)
+		}
+
+	case m.keys.matches(msg, keySelect, keyEdit):
+		if len(m.scheduled) == 0 {
+			return m, nil
+		}
+		return m.openScheduledEdit(m.scheduled[m.selectedScheduled])
+
+	case m.keys.matches(msg, keyDelete):
+		if len(m.scheduled) == 0 {
+			return m, nil
+		}
+		scheduled := m.scheduled[m.selectedScheduled]
+		if err := m.db.CancelScheduledMessage(scheduled.ID, m.userKey); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.successMsg = "Scheduled message cancelled"
+		m.err = nil
+		return m.reloadDrafts()
+	}
+	return m, nil
+}
+
+func (m model) viewScheduled(s *strings.Builder) {
+	st := m.getStyles()
+
+	if len(m.scheduled) == 0 {
+		s.WriteString(st.emptyStateStyle.Width(m.contentWidth()).Render("Nothing scheduled.\n\nPress " + m.keys.hint(keySchedule) + " while writing a message\nto send it later."))
+		s.WriteString("\n")
+	}
+
+	visible := 10
+	if m.height > 0 {
+		visible = max(m.height-draftsChrome, 1)
+	}
+	startIdx, endIdx := carouselWindow(m.selectedScheduled, len(m.scheduled), visible)
+	lineWidth := m.contentWidth() - 4
+	for i := startIdx; i < endIdx; i++ {
+		scheduled := m.scheduled[i]
+		when := m.formatTime(scheduled.SendAt, timeShort)
+		whenStyle := m.renderer.NewStyle().Foreground(st.mutedColor)
+		if scheduled.Error != "" {
+			when = fmt.Sprintf("%*s", len(when), "not sent")
+			whenStyle = whenStyle.Foreground(st.errorColor)
+		}
+		to := ansi.Truncate(scheduled.Recipient, 16, "…")
+		snippet := strings.Join(strings.Fields(scheduled.Body), " ")
+		snippet = ansi.Truncate(snippet, max(lineWidth-18-len(when)-2, 0), "…")
+		gap := strings.Repeat(" ", max(lineWidth-18-ansi.StringWidth(snippet)-len(when), 1))
+		line := fmt.Sprintf("%-16s  %s%s", to, snippet, gap)
+		if i == m.selectedScheduled {
+			indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+			s.WriteString("  " + indicator + m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Render(line) + whenStyle.Render(when))
+		} else {
+			s.WriteString("    " + m.renderer.NewStyle().Foreground(st.textColor).Render(line) + whenStyle.Render(when))
+		}
+		s.WriteString("\n")
+	}
+
+	// Success or error messages, or why the selected message wasn't sent
+	s.WriteString("\n")
+	switch {
+	case m.successMsg != "":
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	case m.err != nil:
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	case len(m.scheduled) > 0 && m.scheduled[m.selectedScheduled].Error != "":
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ Not sent: " + m.scheduled[m.selectedScheduled].Error))
+	}
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.Width(m.contentWidth()).Render(m.keyHint(keyEdit, "to edit") + " • " + m.keyHint(keyDelete, "to cancel") + " • " + m.keyHint(keySwitchTab, "for sent") + " • " + m.navHint() + " • " + m.keyHint(keyBack, "to return")))
+}
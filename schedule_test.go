@@ -0,0 +1,180 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// A Wednesday afternoon, an hour ahead of UTC
+var (
+	testZone = time.FixedZone("UTC+1", 60*60)
+	testNow  = time.Date(2026, 3, 4, 14, 30, 0, 0, testZone)
+)
+
+func TestParseSendTimeIn(t *testing.T) {
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, testZone)
+	}
+	tests := []struct {
+		input string
+		want  time.Time
+		ok    bool
+	}{
+		{"2026-03-10 08:00", at(3, 10, 8, 0), true},
+		{"2026-03-10T08:00", at(3, 10, 8, 0), true},
+		{"2026-03-10", at(3, 10, defaultScheduleHour, 0), true},
+
+		{"in 2h", at(3, 4, 16, 30), true},
+		{"in 1.5h", at(3, 4, 16, 0), true},
+		{"in 2 h", at(3, 4, 16, 30), true},
+		{"in 90 minutes", at(3, 4, 16, 0), true},
+		{"in 1 min", at(3, 4, 14, 31), true},
+		{"in an hour", at(3, 4, 15, 30), true},
+		{"in 3 days", at(3, 7, 14, 30), true},
+		{"in a week", at(3, 11, 14, 30), true},
+		{"In 2H", at(3, 4, 16, 30), true},
+
+		{"today 18:00", at(3, 4, 18, 0), true},
+		{"16:00", at(3, 4, 16, 0), true},
+		{"tomorrow", at(3, 5, defaultScheduleHour, 0), true},
+		{"tomorrow 9am", at(3, 5, 9, 0), true},
+		{"9am tomorrow", at(3, 5, 9, 0), true},
+		{"tomorrow at 5:15 pm", at(3, 5, 17, 15), true},
+		{"tomorrow midnight", at(3, 5, 0, 0), true},
+
+		// Weekdays are the coming one, wrapping into next week
+		{"fri 17:30", at(3, 6, 17, 30), true},
+		{"sunday noon", at(3, 8, 12, 0), true},
+		{"next monday", at(3, 9, defaultScheduleHour, 0), true},
+		{"tue", at(3, 10, defaultScheduleHour, 0), true},
+		{"wed", at(3, 11, defaultScheduleHour, 0), true},
+		{"on thurs at 8pm", at(3, 5, 20, 0), true},
+
+		// Times that have passed today mean tomorrow
+		{"noon", at(3, 5, 12, 0), true},
+		{"12pm", at(3, 5, 12, 0), true},
+		{"12am", at(3, 5, 0, 0), true},
+		{"midnight", at(3, 5, 0, 0), true},
+		{"14:30", at(3, 5, 14, 30), true},
+		{"14:31", at(3, 4, 14, 31), true},
+
+		{"", time.Time{}, false},
+		{"someday", time.Time{}, false},
+		{"in", time.Time{}, false},
+		{"in soon", time.Time{}, false},
+		{"in 0m", time.Time{}, false},
+		{"in -5m", time.Time{}, false},
+		{"in 3 fortnights", time.Time{}, false},
+		{"9am 5pm", time.Time{}, false},
+		{"13pm", time.Time{}, false},
+		{"0am", time.Time{}, false},
+		{"25:00", time.Time{}, false},
+		{"9:5", time.Time{}, false},
+		{"9:60", time.Time{}, false},
+		{"2026-02-30", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseSendTimeIn(tt.input, testNow)
+		if ok != tt.ok || (ok && !got.Equal(tt.want)) {
+			t.Errorf("parseSendTimeIn(%q) = %v, %v, want %v, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseSendTime(t *testing.T) {
+	now := testNow.UTC()
+	tests := []struct {
+		input   string
+		want    time.Time
+		wantErr string
+	}{
+		// Times are read in the user's zone, not the server's
+		{"2026-03-04 16:00", time.Date(2026, 3, 4, 15, 0, 0, 0, time.UTC), ""},
+		{"in 2h", time.Date(2026, 3, 4, 15, 30, 0, 0, time.UTC), ""},
+		{"  tomorrow 9am  ", time.Date(2026, 3, 5, 8, 0, 0, 0, time.UTC), ""},
+
+		{"2026-03-04 14:00", time.Time{}, "has already passed"},
+		{"today 9am", time.Time{}, "has already passed"},
+		{"2027-03-05", time.Time{}, "at most a year ahead"},
+		{"in 400 days", time.Time{}, "at most a year ahead"},
+		{"whenever", time.Time{}, "couldn't understand"},
+	}
+	for _, tt := range tests {
+		got, err := parseSendTime(tt.input, now, testZone)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseSendTime(%q) = %v, %v, want an error containing %q", tt.input, got, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseSendTime(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseDelay(t *testing.T) {
+	tests := []struct {
+		input string
+		want  time.Duration
+		ok    bool
+	}{
+		{"45m", 45 * time.Minute, true},
+		{"1h30m", 90 * time.Minute, true},
+		{"2 h", 2 * time.Hour, true},
+		{"5 mins", 5 * time.Minute, true},
+		{"1 minute", time.Minute, true},
+		{"3 hrs", 3 * time.Hour, true},
+		{"an hour", time.Hour, true},
+		{"a day", 24 * time.Hour, true},
+		{"2 weeks", 14 * 24 * time.Hour, true},
+
+		{"", 0, false},
+		{"a while", 0, false},
+		{"two hours", 0, false},
+		{"2 hours and 5 minutes", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseDelay(strings.Fields(tt.input))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseDelay(%q) = %v, %v, want %v, %v", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		input        string
+		hour, minute int
+		ok           bool
+	}{
+		{"9am", 9, 0, true},
+		{"9:30pm", 21, 30, true},
+		{"12am", 0, 0, true},
+		{"12pm", 12, 0, true},
+		{"12:45am", 0, 45, true},
+		{"17:00", 17, 0, true},
+		{"0:05", 0, 5, true},
+		{"23:59", 23, 59, true},
+		{"7", 7, 0, true},
+		{"noon", 12, 0, true},
+		{"midnight", 0, 0, true},
+
+		{"24:00", 0, 0, false},
+		{"13am", 0, 0, false},
+		{"0pm", 0, 0, false},
+		{"9:5", 0, 0, false},
+		{"9:075", 0, 0, false},
+		{"9:60", 0, 0, false},
+		{"nine", 0, 0, false},
+		{"am", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		hour, minute, ok := parseClock(tt.input)
+		if hour != tt.hour || minute != tt.minute || ok != tt.ok {
+			t.Errorf("parseClock(%q) = %d, %d, %v, want %d, %d, %v", tt.input, hour, minute, ok, tt.hour, tt.minute, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// settingsItem is one entry of the settings screen.
+type settingsItem struct {
+	label string
+	open  func(m model) (tea.Model, tea.Cmd)
+}
+
+var settingsItems = []settingsItem{
+	{"👤 Profile", model.openProfileSettings},
+	{"🔧 Preferences", model.openPreferences},
+	{"📧 Email notifications", model.openEmailSettings},
+	{"🔔 New mail alerts", model.openAlertSettings},
+	{"🔗 Webhooks", model.openWebhooks},
+	{"🔑 API tokens", model.openAPITokens},
+	{"🤖 Bots", model.openBots},
+}
+
+func (m model) openSettings() (tea.Model, tea.Cmd) {
+	m.currentScreen = settingsMenu
+	m.selectedSettingsItem = 0
+	m.err = nil
+	m.successMsg = ""
+	return m, nil
+}
+
+func (m model) updateSettingsMenu(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = mainMenu
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keyDown):
+		m.selectedSettingsItem = (m.selectedSettingsItem + 1) % len(settingsItems)
+	case m.keys.matches(msg, keyUp):
+		m.selectedSettingsItem = (m.selectedSettingsItem - 1 + len(settingsItems)) % len(settingsItems)
+
+	case m.keys.matches(msg, keySelect):
+		return settingsItems[m.selectedSettingsItem].open(m)
+	}
+	return m, nil
+}
+
+func (m model) viewSettingsMenu() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("⚙  Settings")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	for i, item := range settingsItems {
+		if i == m.selectedSettingsItem {
+			indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+			s.WriteString("  " + indicator + m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Render(item.label))
+		} else {
+			s.WriteString("    " + m.renderer.NewStyle().Foreground(st.textColor).Render(item.label))
+		}
+		s.WriteString("\n")
+	}
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	s.WriteString(st.helpStyle.Render(m.navHint() + " • " + m.keyHint(keySelect, "to select") + " • " + m.keyHint(keyBack, "to return")))
+
+	return s.String()
+}
@@ -0,0 +1,589 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	smtpMaxMessageBytes = 1 << 20
+	smtpMaxRecipients   = 50
+	smtpMaxMessageRunes = 1000 // Same limit as the compose textarea
+	smtpIdleTimeout     = 5 * time.Minute
+	smtpSenderPrefix    = "smtp:"
+)
+
+// SMTPGateway accepts mail for <fingerprint>@<domain> and delivers it as
+// regular messages. Senders authenticate with AUTH PLAIN or AUTH LOGIN using
+// either one of the configured tokens, which sends as "smtp:<name>", or a
+// personal API token with send scope, which sends as its owner. The prefix
+// keeps token senders from passing as users, whose fingerprints never
+// contain a colon.
+type SMTPGateway struct {
+	db          *Database
+	webhooks    *Webhooks
+	presence    *Presence
+	rateLimiter *RateLimiter
+	domain      string
+	tokens      map[string]string // token -> sender
+	tlsConfig   *tls.Config
+	listener    net.Listener
+}
+
+// NewSMTPGateway creates a gateway for the given domain. tokens is an optional
+// comma separated list of name:token pairs, e.g. "ci:s3cret,pager:hunter2".
+func NewSMTPGateway(db *Database, webhooks *Webhooks, presence *Presence, rateLimiter *RateLimiter, domain, tokens string, tlsConfig *tls.Config) (*SMTPGateway, error) {
+	if domain == "" {
+		return nil, fmt.Errorf("smtp gateway needs a domain")
+	}
+
+	g := &SMTPGateway{
+		db:          db,
+		webhooks:    webhooks,
+		presence:    presence,
+		rateLimiter: rateLimiter,
+		domain:      strings.ToLower(domain),
+		tokens:      make(map[string]string),
+		tlsConfig:   tlsConfig,
+	}
+	for _, pair := range strings.Split(tokens, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, token, ok := strings.Cut(pair, ":")
+		if !ok || name == "" || token == "" {
+			return nil, fmt.Errorf("invalid smtp token %q (want name:token)", pair)
+		}
+		g.tokens[token] = smtpSenderPrefix + name
+	}
+	return g, nil
+}
+
+// ListenAndServe accepts connections on addr until Close is called.
+func (g *SMTPGateway) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	g.listener = l
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go g.serve(conn)
+	}
+}
+
+// Close stops accepting new connections.
+func (g *SMTPGateway) Close() error {
+	if g.listener == nil {
+		return nil
+	}
+	return g.listener.Close()
+}
+
+// authenticate returns the sender for a token.
+func (g *SMTPGateway) authenticate(token string) (string, bool) {
+	for t, name := range g.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return name, true
+		}
+	}
+
+	if strings.HasPrefix(token, apiTokenPrefix) {
+		apiToken, err := g.db.AuthenticateAPIToken(hashAPIToken(token))
+		if err != nil {
+			log.Printf("SMTP token lookup failed: %v", err)
+			return "", false
+		}
+		if apiToken != nil && apiToken.Scope == scopeSend {
+			return apiToken.SSHKeyFingerprint, true
+		}
+	}
+	return "", false
+}
+
+// smtpSession holds the state of one SMTP connection.
+type smtpSession struct {
+	g          *SMTPGateway
+	conn       net.Conn
+	text       *textproto.Conn
+	tls        bool
+	greeted    bool
+	sender     string // Authenticated sender
+	mailFrom   string
+	recipients []string
+}
+
+func (g *SMTPGateway) serve(conn net.Conn) {
+	s := &smtpSession{g: g, conn: conn, text: textproto.NewConn(conn)}
+	defer s.text.Close()
+
+	s.reply(220, "%s SoSHial ESMTP ready", g.domain)
+
+	for {
+		conn.SetDeadline(time.Now().Add(smtpIdleTimeout))
+		line, err := s.text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			s.greeted = true
+			s.reset()
+			s.reply(250, "%s", g.domain)
+		case "EHLO":
+			s.greeted = true
+			s.reset()
+			ext := []string{g.domain, "PIPELINING", "8BITMIME", fmt.Sprintf("SIZE %d", smtpMaxMessageBytes)}
+			if g.tlsConfig != nil && !s.tls {
+				ext = append(ext, "STARTTLS")
+			} else {
+				ext = append(ext, "AUTH PLAIN LOGIN")
+			}
+			s.replyLines(250, ext)
+		case "STARTTLS":
+			if !s.handleStartTLS() {
+				return
+			}
+		case "AUTH":
+			s.handleAuth(arg)
+		case "MAIL":
+			s.handleMail(arg)
+		case "RCPT":
+			s.handleRcpt(arg)
+		case "DATA":
+			s.handleData()
+		case "RSET":
+			s.reset()
+			s.reply(250, "OK")
+		case "NOOP":
+			s.reply(250, "OK")
+		case "VRFY":
+			s.reply(252, "Cannot verify user")
+		case "QUIT":
+			s.reply(221, "Bye")
+			return
+		default:
+			s.reply(502, "Command not implemented")
+		}
+	}
+}
+
+func (s *smtpSession) reply(code int, format string, args ...any) {
+	s.text.PrintfLine("%d %s", code, fmt.Sprintf(format, args...))
+}
+
+func (s *smtpSession) replyLines(code int, lines []string) {
+	for i, line := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		s.text.PrintfLine("%d%s%s", code, sep, line)
+	}
+}
+
+func (s *smtpSession) reset() {
+	s.mailFrom = ""
+	s.recipients = nil
+}
+
+// handleStartTLS upgrades the connection to TLS. It reports false when the
+// handshake failed and the connection can't be used any more.
+func (s *smtpSession) handleStartTLS() bool {
+	if s.g.tlsConfig == nil || s.tls {
+		s.reply(502, "STARTTLS not available")
+		return true
+	}
+	// Commands pipelined after STARTTLS were sent in plaintext and must not
+	// be run as if they came over TLS
+	if s.text.R.Buffered() > 0 {
+		s.reply(501, "Nothing may follow STARTTLS before the TLS handshake")
+		return true
+	}
+	s.reply(220, "Ready to start TLS")
+
+	tlsConn := tls.Server(s.conn, s.g.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		log.Printf("SMTP TLS handshake failed: %v", err)
+		return false
+	}
+	s.conn = tlsConn
+	s.text = textproto.NewConn(tlsConn)
+	s.tls = true
+	s.greeted = false
+	s.sender = ""
+	s.reset()
+	return true
+}
+
+func (s *smtpSession) handleAuth(arg string) {
+	if !s.greeted {
+		s.reply(503, "Send EHLO first")
+		return
+	}
+	if s.sender != "" {
+		s.reply(503, "Already authenticated")
+		return
+	}
+	// Tokens must not cross the network in the clear when TLS is available
+	if s.g.tlsConfig != nil && !s.tls {
+		s.reply(530, "Must issue a STARTTLS command first")
+		return
+	}
+
+	mechanism, initial, _ := strings.Cut(arg, " ")
+	var token string
+	switch strings.ToUpper(mechanism) {
+	case "PLAIN":
+		if initial == "" {
+			s.reply(334, "")
+			line, err := s.text.ReadLine()
+			if err != nil {
+				return
+			}
+			initial = line
+		}
+		decoded, err := base64.StdEncoding.DecodeString(initial)
+		if err != nil {
+			s.reply(501, "Invalid base64")
+			return
+		}
+		// authzid \0 authcid \0 password
+		parts := strings.Split(string(decoded), "\x00")
+		if len(parts) != 3 {
+			s.reply(501, "Invalid PLAIN credentials")
+			return
+		}
+		token = parts[2]
+
+	case "LOGIN":
+		s.reply(334, "%s", base64.StdEncoding.EncodeToString([]byte("Username:")))
+		if _, err := s.text.ReadLine(); err != nil {
+			return
+		}
+		s.reply(334, "%s", base64.StdEncoding.EncodeToString([]byte("Password:")))
+		line, err := s.text.ReadLine()
+		if err != nil {
+			return
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			s.reply(501, "Invalid base64")
+			return
+		}
+		token = string(decoded)
+
+	default:
+		s.reply(504, "Unrecognized authentication mechanism")
+		return
+	}
+
+	name, ok := s.g.authenticate(token)
+	if !ok {
+		s.reply(535, "Authentication failed")
+		return
+	}
+	s.sender = name
+	s.reply(235, "Authentication successful")
+}
+
+func (s *smtpSession) handleMail(arg string) {
+	if s.sender == "" {
+		s.reply(530, "Authentication required")
+		return
+	}
+	if s.mailFrom != "" {
+		s.reply(503, "Sender already specified")
+		return
+	}
+	addr, ok := parsePathArg(arg, "FROM:")
+	if !ok {
+		s.reply(501, "Syntax: MAIL FROM:<address>")
+		return
+	}
+	if addr == "" {
+		addr = "<>"
+	}
+	s.mailFrom = addr
+	s.reply(250, "OK")
+}
+
+func (s *smtpSession) handleRcpt(arg string) {
+	if s.mailFrom == "" {
+		s.reply(503, "Need MAIL before RCPT")
+		return
+	}
+	if len(s.recipients) >= smtpMaxRecipients {
+		s.reply(452, "Too many recipients")
+		return
+	}
+	addr, ok := parsePathArg(arg, "TO:")
+	if !ok || addr == "" {
+		s.reply(501, "Syntax: RCPT TO:<address>")
+		return
+	}
+
+	local, domain, ok := strings.Cut(addr, "@")
+	if !ok || strings.ToLower(domain) != s.g.domain {
+		s.reply(550, "Relay not permitted")
+		return
+	}
+	exists, err := s.g.db.UserExists(local)
+	if err != nil {
+		log.Printf("SMTP recipient lookup failed: %v", err)
+		s.reply(451, "Temporary lookup failure")
+		return
+	}
+	if !exists {
+		s.reply(550, "No such user")
+		return
+	}
+
+	s.recipients = append(s.recipients, local)
+	s.reply(250, "OK")
+}
+
+func (s *smtpSession) handleData() {
+	if len(s.recipients) == 0 {
+		s.reply(503, "Need RCPT before DATA")
+		return
+	}
+	s.reply(354, "End data with <CR><LF>.<CR><LF>")
+
+	dot := s.text.DotReader()
+	raw, err := io.ReadAll(io.LimitReader(dot, smtpMaxMessageBytes+1))
+	if err != nil {
+		return
+	}
+	if len(raw) > smtpMaxMessageBytes {
+		// Drain the rest of the message before replying
+		io.Copy(io.Discard, dot)
+		s.reply(552, "Message too large")
+		s.reset()
+		return
+	}
+
+	body, err := mailToText(string(raw))
+	if err != nil {
+		s.reply(554, "Could not parse message: %v", err)
+		s.reset()
+		return
+	}
+	if body == "" {
+		s.reply(554, "Message is empty")
+		s.reset()
+		return
+	}
+
+	if !s.g.rateLimiter.CanSendMessage(s.sender) {
+		s.reply(450, "Rate limit: please wait between messages")
+		s.reset()
+		return
+	}
+	if err := s.g.db.UpsertUser(s.sender); err != nil {
+		log.Printf("SMTP failed to update sender: %v", err)
+		s.reply(451, "Temporary failure")
+		s.reset()
+		return
+	}
+	for _, to := range s.recipients {
+		delivered, err := s.g.db.SendMessage(s.sender, to, body)
+		if err != nil {
+			log.Printf("SMTP delivery to %s failed: %v", to, err)
+			s.reply(451, "Temporary failure")
+			s.reset()
+			return
+		}
+		go s.g.webhooks.Emit(eventMessageReceived, to, delivered)
+		s.g.presence.Send(to, newMailMsg{delivered})
+	}
+	s.g.rateLimiter.RecordMessage(s.sender)
+
+	log.Printf("SMTP delivered mail from %s (%s) to %d recipient(s)", s.sender, s.mailFrom, len(s.recipients))
+	s.reply(250, "OK: delivered")
+	s.reset()
+}
+
+// parsePathArg extracts the address from "FROM:<addr> PARAMS" style arguments.
+func parsePathArg(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(rest, "<") {
+		return "", false
+	}
+	end := strings.Index(rest, ">")
+	if end < 0 {
+		return "", false
+	}
+	return rest[1:end], true
+}
+
+// mailToText converts a raw RFC 5322 message into the plain text body stored
+// in a Message. The subject, if any, becomes the first line.
+func mailToText(raw string) (string, error) {
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	if err != nil {
+		return "", err
+	}
+
+	body, err := partToText(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return "", err
+	}
+
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+	subject = strings.TrimSpace(stripControl(subject))
+
+	text := strings.TrimSpace(stripControl(body))
+	if subject != "" {
+		text = strings.TrimSpace(subject + "\n\n" + text)
+	}
+
+	if runes := []rune(text); len(runes) > smtpMaxMessageRunes {
+		text = string(runes[:smtpMaxMessageRunes-3]) + "..."
+	}
+	return text, nil
+}
+
+// partToText returns the text of a MIME part, preferring text/plain over
+// text/html within multipart messages.
+func partToText(header textproto.MIMEHeader, body io.Reader) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	body = decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body)
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		mr := multipart.NewReader(body, params["boundary"])
+		var plain, htmlText string
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return "", err
+			}
+			text, err := partToText(part.Header, part)
+			if err != nil {
+				return "", err
+			}
+			partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+			if partType == "text/html" {
+				if htmlText == "" {
+					htmlText = text
+				}
+			} else if plain == "" {
+				plain = text
+			}
+		}
+		if plain != "" {
+			return plain, nil
+		}
+		return htmlText, nil
+
+	case mediaType == "text/html":
+		b, err := io.ReadAll(body)
+		if err != nil {
+			return "", err
+		}
+		return stripHTML(string(b)), nil
+
+	case strings.HasPrefix(mediaType, "text/"):
+		b, err := io.ReadAll(body)
+		if err != nil {
+			return "", err
+		}
+		return strings.ReplaceAll(string(b), "\r\n", "\n"), nil
+	}
+
+	// Attachments and other media are dropped
+	return "", nil
+}
+
+func decodeTransferEncoding(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: bufio.NewReader(r)})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	}
+	return r
+}
+
+// newlineStripper drops CR and LF bytes so wrapped base64 can be decoded.
+type newlineStripper struct {
+	r io.ByteReader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	i := 0
+	for i < len(p) {
+		b, err := n.r.ReadByte()
+		if err != nil {
+			return i, err
+		}
+		if b == '\r' || b == '\n' {
+			continue
+		}
+		p[i] = b
+		i++
+	}
+	return i, nil
+}
+
+var (
+	htmlDropRe  = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>`)
+	htmlBreakRe = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|li|tr|h[1-6])>`)
+	htmlTagRe   = regexp.MustCompile(`(?s)<[^>]*>`)
+	blankRunRe  = regexp.MustCompile(`\n{3,}`)
+)
+
+// stripHTML reduces an HTML body to readable plain text.
+func stripHTML(s string) string {
+	s = htmlDropRe.ReplaceAllString(s, "")
+	s = htmlBreakRe.ReplaceAllString(s, "\n")
+	s = htmlTagRe.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	return blankRunRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+}
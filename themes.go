@@ -0,0 +1,436 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type themeName string
+
+const (
+	themeGruvbox         themeName = "gruvbox"
+	themeDracula         themeName = "dracula"
+	themeNord            themeName = "nord"
+	themeSolarizedDark   themeName = "solarized-dark"
+	themeCatppuccinMocha themeName = "catppuccin-mocha"
+	themeGruvboxLight    themeName = "gruvbox-light"
+	themeSolarizedLight  themeName = "solarized-light"
+	themeCatppuccinLatte themeName = "catppuccin-latte"
+)
+
+var themeColorRe = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+type theme struct {
+	name       string
+	light      bool // Meant for terminals with a light background
+	background lipgloss.Color
+	foreground lipgloss.Color
+	primary    lipgloss.Color
+	secondary  lipgloss.Color
+	accent     lipgloss.Color
+	success    lipgloss.Color
+	error      lipgloss.Color
+	muted      lipgloss.Color
+	highlight  lipgloss.Color
+	selection  lipgloss.Color
+}
+
+var themes = map[themeName]theme{
+	themeGruvbox: {
+		name:       "Gruvbox",
+		background: lipgloss.Color("#282828"),
+		foreground: lipgloss.Color("#FBF1C7"), // fg0 (bright/white)
+		primary:    lipgloss.Color("#FABD2F"), // yellow (bright)
+		secondary:  lipgloss.Color("#D3869B"), // purple (bright)
+		accent:     lipgloss.Color("#8EC07C"), // aqua (bright)
+		success:    lipgloss.Color("#B8BB26"), // green (bright)
+		error:      lipgloss.Color("#FB4934"), // red (bright)
+		muted:      lipgloss.Color("#A89984"), // gray (brighter)
+		highlight:  lipgloss.Color("#FE8019"), // orange (bright)
+		selection:  lipgloss.Color("#83A598"), // blue (bright)
+	},
+	themeDracula: {
+		name:       "Dracula",
+		background: lipgloss.Color("#282a36"),
+		foreground: lipgloss.Color("#f8f8f2"),
+		primary:    lipgloss.Color("#bd93f9"), // purple
+		secondary:  lipgloss.Color("#ff79c6"), // pink
+		accent:     lipgloss.Color("#8be9fd"), // cyan
+		success:    lipgloss.Color("#50fa7b"), // green
+		error:      lipgloss.Color("#ff5555"), // red
+		muted:      lipgloss.Color("#6272a4"), // comment
+		highlight:  lipgloss.Color("#ffb86c"), // orange
+		selection:  lipgloss.Color("#8be9fd"), // cyan
+	},
+	themeNord: {
+		name:       "Nord",
+		background: lipgloss.Color("#2E3440"), // nord0
+		foreground: lipgloss.Color("#ECEFF4"), // nord6
+		primary:    lipgloss.Color("#88C0D0"), // nord8 (frost)
+		secondary:  lipgloss.Color("#B48EAD"), // nord15 (purple)
+		accent:     lipgloss.Color("#8FBCBB"), // nord7 (frost)
+		success:    lipgloss.Color("#A3BE8C"), // nord14 (green)
+		error:      lipgloss.Color("#BF616A"), // nord11 (red)
+		muted:      lipgloss.Color("#7B88A1"), // nord3, brightened
+		highlight:  lipgloss.Color("#D08770"), // nord12 (orange)
+		selection:  lipgloss.Color("#81A1C1"), // nord9 (frost)
+	},
+	themeSolarizedDark: {
+		name:       "Solarized Dark",
+		background: lipgloss.Color("#002b36"), // base03
+		foreground: lipgloss.Color("#93a1a1"), // base1
+		primary:    lipgloss.Color("#b58900"), // yellow
+		secondary:  lipgloss.Color("#d33682"), // magenta
+		accent:     lipgloss.Color("#2aa198"), // cyan
+		success:    lipgloss.Color("#859900"), // green
+		error:      lipgloss.Color("#dc322f"), // red
+		muted:      lipgloss.Color("#586e75"), // base01
+		highlight:  lipgloss.Color("#cb4b16"), // orange
+		selection:  lipgloss.Color("#268bd2"), // blue
+	},
+	themeCatppuccinMocha: {
+		name:       "Catppuccin Mocha",
+		background: lipgloss.Color("#1e1e2e"), // base
+		foreground: lipgloss.Color("#cdd6f4"), // text
+		primary:    lipgloss.Color("#cba6f7"), // mauve
+		secondary:  lipgloss.Color("#f5c2e7"), // pink
+		accent:     lipgloss.Color("#89dceb"), // sky
+		success:    lipgloss.Color("#a6e3a1"), // green
+		error:      lipgloss.Color("#f38ba8"), // red
+		muted:      lipgloss.Color("#7f849c"), // overlay1
+		highlight:  lipgloss.Color("#fab387"), // peach
+		selection:  lipgloss.Color("#89b4fa"), // blue
+	},
+	themeGruvboxLight: {
+		name:       "Gruvbox Light",
+		light:      true,
+		background: lipgloss.Color("#FBF1C7"), // bg0
+		foreground: lipgloss.Color("#3C3836"), // fg1
+		primary:    lipgloss.Color("#B57614"), // yellow (faded)
+		secondary:  lipgloss.Color("#8F3F71"), // purple (faded)
+		accent:     lipgloss.Color("#427B58"), // aqua (faded)
+		success:    lipgloss.Color("#79740E"), // green (faded)
+		error:      lipgloss.Color("#9D0006"), // red (faded)
+		muted:      lipgloss.Color("#7C6F64"), // gray
+		highlight:  lipgloss.Color("#AF3A03"), // orange (faded)
+		selection:  lipgloss.Color("#076678"), // blue (faded)
+	},
+	themeSolarizedLight: {
+		name:       "Solarized Light",
+		light:      true,
+		background: lipgloss.Color("#fdf6e3"), // base3
+		foreground: lipgloss.Color("#586e75"), // base01
+		primary:    lipgloss.Color("#b58900"), // yellow
+		secondary:  lipgloss.Color("#d33682"), // magenta
+		accent:     lipgloss.Color("#2aa198"), // cyan
+		success:    lipgloss.Color("#859900"), // green
+		error:      lipgloss.Color("#dc322f"), // red
+		muted:      lipgloss.Color("#93a1a1"), // base1
+		highlight:  lipgloss.Color("#cb4b16"), // orange
+		selection:  lipgloss.Color("#268bd2"), // blue
+	},
+	themeCatppuccinLatte: {
+		name:       "Catppuccin Latte",
+		light:      true,
+		background: lipgloss.Color("#eff1f5"), // base
+		foreground: lipgloss.Color("#4c4f69"), // text
+		primary:    lipgloss.Color("#8839ef"), // mauve
+		secondary:  lipgloss.Color("#ea76cb"), // pink
+		accent:     lipgloss.Color("#04a5e5"), // sky
+		success:    lipgloss.Color("#40a02b"), // green
+		error:      lipgloss.Color("#d20f39"), // red
+		muted:      lipgloss.Color("#8c8fa1"), // overlay1
+		highlight:  lipgloss.Color("#fe640b"), // peach
+		selection:  lipgloss.Color("#1e66f5"), // blue
+	},
+}
+
+// themeOrder is the order the picker lists themes in: the built-in dark
+// themes, the light ones, then any loaded from the themes directory.
+var themeOrder = []themeName{
+	themeGruvbox, themeDracula, themeNord, themeSolarizedDark, themeCatppuccinMocha,
+	themeGruvboxLight, themeSolarizedLight, themeCatppuccinLatte,
+}
+
+// palette returns the theme's colors in the order they are used to color
+// text letter by letter.
+func (t theme) palette() []lipgloss.Color {
+	return []lipgloss.Color{t.primary, t.accent, t.secondary, t.success, t.highlight, t.error, t.selection}
+}
+
+// themeFile is the format of theme files. Colors are "#rgb" or "#rrggbb",
+// or an ANSI color number from 0 to 255.
+type themeFile struct {
+	Name       string `toml:"name" json:"name"`
+	Light      bool   `toml:"light" json:"light"`
+	Background string `toml:"background" json:"background"`
+	Foreground string `toml:"foreground" json:"foreground"`
+	Primary    string `toml:"primary" json:"primary"`
+	Secondary  string `toml:"secondary" json:"secondary"`
+	Accent     string `toml:"accent" json:"accent"`
+	Success    string `toml:"success" json:"success"`
+	Error      string `toml:"error" json:"error"`
+	Muted      string `toml:"muted" json:"muted"`
+	Highlight  string `toml:"highlight" json:"highlight"`
+	Selection  string `toml:"selection" json:"selection"`
+}
+
+func validThemeColor(color string) bool {
+	if themeColorRe.MatchString(color) {
+		return true
+	}
+	n, err := strconv.Atoi(color)
+	return err == nil && n >= 0 && n <= 255
+}
+
+func (f themeFile) theme() (theme, error) {
+	colors := []struct{ key, value string }{
+		{"background", f.Background},
+		{"foreground", f.Foreground},
+		{"primary", f.Primary},
+		{"secondary", f.Secondary},
+		{"accent", f.Accent},
+		{"success", f.Success},
+		{"error", f.Error},
+		{"muted", f.Muted},
+		{"highlight", f.Highlight},
+		{"selection", f.Selection},
+	}
+	for _, color := range colors {
+		if color.value == "" {
+			return theme{}, fmt.Errorf("missing %s color", color.key)
+		}
+		if !validThemeColor(color.value) {
+			return theme{}, fmt.Errorf("%s is not a color: %q", color.key, color.value)
+		}
+	}
+
+	return theme{
+		name:       f.Name,
+		light:      f.Light,
+		background: lipgloss.Color(f.Background),
+		foreground: lipgloss.Color(f.Foreground),
+		primary:    lipgloss.Color(f.Primary),
+		secondary:  lipgloss.Color(f.Secondary),
+		accent:     lipgloss.Color(f.Accent),
+		success:    lipgloss.Color(f.Success),
+		error:      lipgloss.Color(f.Error),
+		muted:      lipgloss.Color(f.Muted),
+		highlight:  lipgloss.Color(f.Highlight),
+		selection:  lipgloss.Color(f.Selection),
+	}, nil
+}
+
+// loadThemes adds the themes defined by the .toml and .json files in dir
+// and returns how many there were. Themes are keyed by file name, so a file
+// such as nord.toml replaces the built-in theme of that name.
+func loadThemes(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var added []themeName
+	loaded := 0
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".toml" && ext != ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return loaded, err
+		}
+
+		// Unknown keys are most likely misspelled colors
+		var file themeFile
+		if ext == ".toml" {
+			var meta toml.MetaData
+			meta, err = toml.Decode(string(data), &file)
+			if err == nil && len(meta.Undecoded()) > 0 {
+				err = fmt.Errorf("unknown key %q", meta.Undecoded()[0].String())
+			}
+		} else {
+			decoder := json.NewDecoder(bytes.NewReader(data))
+			decoder.DisallowUnknownFields()
+			err = decoder.Decode(&file)
+		}
+		if err != nil {
+			return loaded, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+
+		t, err := file.theme()
+		if err != nil {
+			return loaded, fmt.Errorf("%s: %w", entry.Name(), err)
+		}
+
+		key := themeName(strings.ToLower(strings.TrimSuffix(entry.Name(), ext)))
+		if t.name == "" {
+			t.name = string(key)
+		}
+		if _, exists := themes[key]; !exists {
+			added = append(added, key)
+		}
+		themes[key] = t
+		loaded++
+	}
+
+	sort.Slice(added, func(i, j int) bool { return added[i] < added[j] })
+	themeOrder = append(themeOrder, added...)
+	return loaded, nil
+}
+
+// renderThemeName renders the name of t with each letter in the next color
+// of its palette.
+func (m model) renderThemeName(t theme) string {
+	palette := t.palette()
+	var s strings.Builder
+	i := 0
+	for _, char := range t.name {
+		if char == ' ' {
+			s.WriteRune(char)
+			continue
+		}
+		s.WriteString(m.renderer.NewStyle().Foreground(palette[i%len(palette)]).Bold(true).Render(string(char)))
+		i++
+	}
+	return s.String()
+}
+
+func (m model) openThemePicker() (tea.Model, tea.Cmd) {
+	m.themeReturnScreen = m.currentScreen
+	m.currentScreen = themePicker
+	m.themeBeforePicker = m.currentTheme
+	m.selectedTheme = 0
+	for i, name := range themeOrder {
+		if name == m.currentTheme {
+			m.selectedTheme = i
+		}
+	}
+	m.err = nil
+	m.successMsg = ""
+	return m, nil
+}
+
+func (m model) updateThemePicker(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case m.keys.matches(msg, keyBack):
+		// Put back the theme from before the preview
+		m.currentTheme = m.themeBeforePicker
+		m.currentScreen = m.themeReturnScreen
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keyDown):
+		m.selectedTheme = (m.selectedTheme + 1) % len(themeOrder)
+		m.currentTheme = themeOrder[m.selectedTheme]
+	case m.keys.matches(msg, keyUp):
+		m.selectedTheme = (m.selectedTheme - 1 + len(themeOrder)) % len(themeOrder)
+		m.currentTheme = themeOrder[m.selectedTheme]
+
+	case m.keys.matches(msg, keySelect):
+		settings := m.userSettings
+		settings.Theme = string(themeOrder[m.selectedTheme])
+		if err := m.saveUserSettings(settings); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.currentScreen = m.themeReturnScreen
+		m.successMsg = "Theme changed to " + themes[m.currentTheme].name
+		m.err = nil
+	}
+	return m, nil
+}
+
+func (m model) viewThemePicker() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("🎨  Themes")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	preview := m.viewThemePreview()
+	help := st.helpStyle.Render(m.keys.hint(keyDown) + "/" + m.keys.hint(keyUp) + " to preview • " + m.keyHint(keySelect, "to use") + " • " + m.keyHint(keyBack, "to keep "+themes[m.themeBeforePicker].name))
+
+	// Each theme's name is drawn in its own colors. Long lists scroll around
+	// the selection when the terminal is short.
+	visible := len(themeOrder)
+	if m.height > 0 {
+		// Title, blank lines and the status line take 8 lines
+		visible = max(m.height-8-lipgloss.Height(preview)-lipgloss.Height(help), 3)
+	}
+	startIdx, endIdx := carouselWindow(m.selectedTheme, len(themeOrder), visible)
+	lightTag := m.renderer.NewStyle().Foreground(st.mutedColor).Italic(true).Render("  light")
+	for i := startIdx; i < endIdx; i++ {
+		t := themes[themeOrder[i]]
+		name := m.renderThemeName(t)
+		if t.light {
+			name += lightTag
+		}
+		if i == m.selectedTheme {
+			indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+			s.WriteString("  " + indicator + name)
+		} else {
+			s.WriteString("    " + name)
+		}
+		s.WriteString("\n")
+	}
+	s.WriteString("\n")
+
+	// Live preview of the selected theme, which the whole screen already uses
+	s.WriteString(preview)
+	s.WriteString("\n")
+
+	// Success or error messages
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+
+	s.WriteString(help)
+
+	return s.String()
+}
+
+// viewThemePreview renders a sample message and the theme's palette.
+func (m model) viewThemePreview() string {
+	st := m.getStyles()
+	t := themes[m.currentTheme]
+
+	header := st.messageHeaderStyle.UnsetMarginBottom().Render("From: alice") + " " +
+		st.newBadgeStyle.Render(" NEW ") + " " + st.botBadgeStyle.Render(" BOT ")
+	timeStr := st.messageTimeStyle.Render("Mon, Jan 2 2006 at 15:04") +
+		m.renderer.NewStyle().Foreground(st.secondaryColor).Render("  to #book-club")
+	body := m.renderMarkdown("Have you tried the **new themes**? Run `ssh` and press [enter](https://example.com).", m.bodyWidth())
+	statuses := m.renderer.NewStyle().Foreground(st.successColor).Render("✓ Saved") + "   " +
+		m.renderer.NewStyle().Foreground(st.errorColor).Render("✗ Failed") + "   " +
+		m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ") +
+		m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Render("Selected")
+
+	var swatches strings.Builder
+	for _, color := range append([]lipgloss.Color{t.foreground, t.muted}, t.palette()...) {
+		swatches.WriteString(m.renderer.NewStyle().Foreground(color).Render("██") + " ")
+	}
+
+	return m.renderer.NewStyle().
+		Border(lipgloss.ThickBorder()).
+		BorderForeground(st.accentColor).
+		Padding(0, 2).
+		Width(m.contentWidth()).
+		Render(strings.Join([]string{header, timeStr, "", body, "", statuses, swatches.String()}, "\n"))
+}
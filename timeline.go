@@ -0,0 +1,385 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	maxPostLength = 280
+	timelineLimit = 100
+)
+
+func (m model) openTimeline() (tea.Model, tea.Cmd) {
+	m.currentScreen = timeline
+	m.selectedPost = 0
+	m.err = nil
+	m.successMsg = ""
+	return m.reloadTimeline()
+}
+
+func (m model) reloadTimeline() (tea.Model, tea.Cmd) {
+	posts, err := m.db.GetTimeline(m.userKey, m.timelineFollowing, timelineLimit)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.posts = posts
+
+	following, err := m.db.GetFollowing(m.userKey)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.following = following
+
+	// Load bot IDs so their posts can be badged
+	botIDs, err := m.db.GetBotIDs()
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.botIDs = botIDs
+
+	if m.selectedPost >= len(posts) {
+		m.selectedPost = max(len(posts)-1, 0)
+	}
+	return m, nil
+}
+
+func (m model) updateTimeline(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = mainMenu
+		m.posts = nil
+		m.selectedPost = 0
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keyDown):
+		if len(m.posts) > 0 {
+			m.selectedPost = (m.selectedPost + 1) % len(m.posts)
+		}
+	case m.keys.matches(msg, keyUp):
+		if len(m.posts) > 0 {
+			m.selectedPost = (m.selectedPost - 1 + len(m.posts)) % len(m.posts)
+		}
+
+	case m.keys.matches(msg, keySwitchTab):
+		m.timelineFollowing = !m.timelineFollowing
+		m.selectedPost = 0
+		m.err = nil
+		m.successMsg = ""
+		return m.reloadTimeline()
+
+	case m.keys.matches(msg, keyRefresh):
+		m.err = nil
+		m.successMsg = ""
+		return m.reloadTimeline()
+
+	case m.keys.matches(msg, keyNew):
+		m.currentScreen = composePost
+		m.postInput.SetValue("")
+		m.err = nil
+		m.successMsg = ""
+		return m, m.postInput.Focus()
+
+	case m.keys.matches(msg, keyLike):
+		if len(m.posts) == 0 {
+			return m, nil
+		}
+		post := &m.posts[m.selectedPost]
+		liked, err := m.db.ToggleLike(post.ID, m.userKey)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		// Update in place so the carousel doesn't jump around
+		if liked {
+			post.Likes++
+		} else {
+			post.Likes--
+		}
+		post.LikedByMe = liked
+		m.err = nil
+
+	case m.keys.matches(msg, keyFollow):
+		if len(m.posts) == 0 {
+			return m, nil
+		}
+		author := m.posts[m.selectedPost].AuthorKey
+		if author == m.userKey {
+			return m, nil
+		}
+		if m.following[author] {
+			if err := m.db.Unfollow(m.userKey, author); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.successMsg = "Unfollowed " + author[:min(12, len(author))] + "..."
+		} else {
+			if err := m.db.Follow(m.userKey, author); err != nil {
+				m.err = err
+				return m, nil
+			}
+			m.successMsg = "Following " + author[:min(12, len(author))] + "..."
+		}
+		m.err = nil
+		return m.reloadTimeline()
+
+	case m.keys.matches(msg, keyProfile):
+		if len(m.posts) > 0 {
+			return m.openProfile(m.posts[m.selectedPost].AuthorKey)
+		}
+
+	case m.keys.matches(msg, keyMessage):
+		if len(m.posts) == 0 {
+			return m, nil
+		}
+		author := m.posts[m.selectedPost].AuthorKey
+		if author == m.userKey {
+			return m, nil
+		}
+		return m.openCompose(author, nil)
+
+	case m.keys.matches(msg, keyDelete):
+		if len(m.posts) == 0 || m.posts[m.selectedPost].AuthorKey != m.userKey {
+			return m, nil
+		}
+		if err := m.db.DeletePost(m.posts[m.selectedPost].ID, m.userKey); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.successMsg = "Post deleted"
+		m.err = nil
+		return m.reloadTimeline()
+	}
+	return m, nil
+}
+
+func (m model) updateComposePost(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case m.keys.matches(msg, keySend):
+		body := strings.TrimSpace(m.postInput.Value())
+		if body == "" {
+			m.err = fmt.Errorf("post cannot be empty")
+			return m, nil
+		}
+
+		// Posts share the message rate limit
+		if !m.rateLimiter.CanSendMessage(m.userKey) {
+			m.err = fmt.Errorf("rate limit: please wait 10 seconds between posts")
+			return m, nil
+		}
+
+		if _, err := m.db.CreatePost(m.userKey, body); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.rateLimiter.RecordMessage(m.userKey)
+
+		m.currentScreen = timeline
+		m.selectedPost = 0
+		m.successMsg = "Posted!"
+		m.err = nil
+		return m.reloadTimeline()
+
+	case m.keys.matches(msg, keyLeaveCompose):
+		m.currentScreen = timeline
+		m.err = nil
+		return m, nil
+	}
+
+	updated, cmd := m.postInput.Update(msg)
+	m.postInput = &updated
+	return m, cmd
+}
+
+func (m model) viewTimeline() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("📣  Timeline")
+	s.WriteString(title)
+	s.WriteString("\n")
+
+	// Global / following tabs
+	activeTab := m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Underline(true)
+	inactiveTab := m.renderer.NewStyle().Foreground(st.mutedColor)
+	global, following := activeTab.Render("Global"), inactiveTab.Render("Following")
+	if m.timelineFollowing {
+		global, following = inactiveTab.Render("Global"), activeTab.Render("Following")
+	}
+	s.WriteString("  " + global + "   " + following)
+	s.WriteString("\n\n")
+
+	// Fixed height container for posts (always same height)
+	var postsContent strings.Builder
+
+	if len(m.posts) == 0 {
+		// Empty state
+		emptyText := "📭 Nothing here yet!\n\nPress " + m.keys.hint(keyNew) + " to write the first post."
+		if m.timelineFollowing {
+			emptyText = "📭 Nothing here yet!\n\nFollow people from the global timeline with " + m.keys.hint(keyFollow) + "."
+		}
+		postsContent.WriteString(st.emptyStateStyle.Width(m.contentWidth()).Render(emptyText))
+	} else {
+		startIdx, endIdx := carouselWindow(m.selectedPost, len(m.posts), m.carouselSize(11, expandedPostHeight))
+
+		for i := startIdx; i < endIdx; i++ {
+			post := m.posts[i]
+
+			likes := fmt.Sprintf("♡ %d", post.Likes)
+			likeStyle := m.renderer.NewStyle().Foreground(st.mutedColor)
+			if post.LikedByMe {
+				likes = fmt.Sprintf("♥ %d", post.Likes)
+				likeStyle = likeStyle.Foreground(st.secondaryColor)
+			}
+
+			if i == m.selectedPost {
+				// Selected post - full expanded view with fixed content height
+				var postContent strings.Builder
+
+				// Header with author
+				header := st.messageHeaderStyle.UnsetMarginBottom().Render(post.AuthorKey)
+				if m.botIDs[post.AuthorKey] {
+					header += " " + st.botBadgeStyle.Render(" BOT ")
+				}
+				if post.AuthorKey == m.userKey {
+					header += m.renderer.NewStyle().Foreground(st.mutedColor).Render(" (you)")
+				} else if m.following[post.AuthorKey] {
+					header += m.renderer.NewStyle().Foreground(st.accentColor).Render(" ✓ following")
+				}
+				postContent.WriteString(header)
+				postContent.WriteString("\n")
+
+				// Timestamp with like count on the right
+				timeStr := st.messageTimeStyle.Render(m.formatTime(post.CreatedAt, timeFull))
+				likeStr := likeStyle.Render(likes)
+
+				// Padding(1,2) leaves the body width inside the box
+				internalWidth := m.bodyWidth()
+				spacingWidth := internalWidth - lipgloss.Width(timeStr) - lipgloss.Width(likeStr)
+				if spacingWidth < 1 {
+					spacingWidth = 1
+				}
+				postContent.WriteString(timeStr + strings.Repeat(" ", spacingWidth) + likeStr)
+				postContent.WriteString("\n")
+
+				// Post body - wrapped and limited to exactly 5 lines
+				const maxPostLines = 5
+				wrapped := m.renderer.NewStyle().Width(internalWidth).Render(post.Body)
+				bodyLines := strings.Split(wrapped, "\n")
+				if len(bodyLines) > maxPostLines {
+					bodyLines = bodyLines[:maxPostLines]
+					bodyLines[maxPostLines-1] = strings.TrimRight(bodyLines[maxPostLines-1], " ") + "…"
+				}
+				for j := 0; j < maxPostLines; j++ {
+					if j < len(bodyLines) {
+						postContent.WriteString(bodyLines[j])
+					}
+					if j < maxPostLines-1 {
+						postContent.WriteString("\n")
+					}
+				}
+
+				// Full box with highlighted border
+				selectedStyle := m.renderer.NewStyle().
+					Border(lipgloss.ThickBorder()).
+					BorderForeground(st.accentColor).
+					Padding(1, 2).
+					MarginBottom(1).
+					Width(m.contentWidth())
+				postsContent.WriteString(selectedStyle.Render(postContent.String()))
+			} else {
+				// Unselected post - compact one-line view
+				author := post.AuthorKey
+				if len(author) > 20 {
+					author = author[:17] + "..."
+				}
+
+				leftPart := author + "  " + likeStyle.Render(likes)
+				if m.botIDs[post.AuthorKey] {
+					leftPart += " " + st.botBadgeStyle.Render(" BOT ")
+				}
+				rightPart := m.formatTime(post.CreatedAt, timeShort) +
+					carouselDirection(i, m.selectedPost, len(m.posts), startIdx, endIdx)
+
+				// Padding(0,1) leaves 2 columns less than the content width
+				internalWidth := m.contentWidth() - 2
+				spacingWidth := internalWidth - lipgloss.Width(leftPart) - lipgloss.Width(rightPart)
+				if spacingWidth < 1 {
+					spacingWidth = 1
+				}
+
+				// Compact box
+				compactStyle := m.renderer.NewStyle().
+					Border(lipgloss.RoundedBorder()).
+					BorderForeground(st.mutedColor).
+					Padding(0, 1).
+					MarginBottom(1).
+					Width(m.contentWidth())
+				postsContent.WriteString(compactStyle.Render(leftPart + strings.Repeat(" ", spacingWidth) + rightPart))
+			}
+
+			if i < endIdx-1 {
+				postsContent.WriteString("\n")
+			}
+		}
+	}
+
+	// Manually pad to fixed height, matching the messages screen
+	content := postsContent.String()
+	s.WriteString(content)
+	targetLines := carouselHeight(m.carouselSize(11, expandedPostHeight), expandedPostHeight)
+	if paddingNeeded := targetLines - len(strings.Split(content, "\n")); paddingNeeded > 0 {
+		s.WriteString(strings.Repeat("\n", paddingNeeded))
+	}
+
+	// Success or error messages (fixed height to keep bottom elements stable)
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+
+	s.WriteString(st.helpStyle.Width(m.contentWidth()).Render(m.keyHint(keyNew, "to post") + " • " + m.keyHint(keyLike, "to like") + " • " + m.keyHint(keyFollow, "to follow") + " • " + m.keyHint(keyProfile, "for profile") + " • " +
+		m.keyHint(keyMessage, "to message") + " • " + m.keyHint(keyDelete, "to delete") + " • " + m.keyHint(keySwitchTab, "to switch") + " • " + m.keyHint(keyBack, "to return")))
+
+	return s.String()
+}
+
+func (m model) viewComposePost() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("📣  New Post")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	// Instructions with remaining characters
+	remaining := maxPostLength - len([]rune(m.postInput.Value()))
+	s.WriteString(st.inputLabelStyle.Render(fmt.Sprintf("Everyone can see this • %d characters left", remaining)))
+	s.WriteString("\n")
+
+	// Error message (fixed height to keep bottom elements stable)
+	if m.err != nil {
+		s.WriteString(st.errorStyle.Render(" ✗ " + m.err.Error() + " "))
+	}
+	s.WriteString("\n\n")
+
+	// Post input box
+	input := st.inputBoxStyle.Width(m.contentWidth()).Render(m.postInput.View())
+	s.WriteString(input)
+	s.WriteString("\n")
+
+	// Help text
+	s.WriteString(st.helpStyle.Width(m.contentWidth()).Render(m.keyHint(keySend, "to post") + " • " + m.keyHint(keyLeaveCompose, "to cancel")))
+
+	return s.String()
+}
@@ -8,8 +8,10 @@ import (
 
 	"github.com/charmbracelet/bubbles/textarea"
 	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/muesli/termenv"
 )
 
 type screen int
@@ -19,77 +21,171 @@ const (
 	viewMessages
 	sendMessageRecipient
 	sendMessageContent
+	settingsMenu
+	emailNotifications
+	webhookSettings
+	apiTokenSettings
+	botSettings
+	groupList
+	groupDetail
+	timeline
+	composePost
+	profileSettings
+	profileView
+	whosOnline
+	chatScreen
+	alertSettingsScreen
+	readMessage
+	themePicker
+	preferencesScreen
+	keyBindingsScreen
+	draftsScreen
 )
 
-type themeName string
-
-const (
-	themeGruvbox themeName = "gruvbox"
-	themeDracula themeName = "dracula"
-)
-
-type theme struct {
-	name       string
-	background lipgloss.Color
-	foreground lipgloss.Color
-	primary    lipgloss.Color
-	secondary  lipgloss.Color
-	accent     lipgloss.Color
-	success    lipgloss.Color
-	error      lipgloss.Color
-	muted      lipgloss.Color
-	highlight  lipgloss.Color
-	selection  lipgloss.Color
-}
-
-var themes = map[themeName]theme{
-	themeGruvbox: {
-		name:       "Gruvbox",
-		background: lipgloss.Color("#282828"),
-		foreground: lipgloss.Color("#FBF1C7"), // fg0 (bright/white)
-		primary:    lipgloss.Color("#FABD2F"), // yellow (bright)
-		secondary:  lipgloss.Color("#D3869B"), // purple (bright)
-		accent:     lipgloss.Color("#8EC07C"), // aqua (bright)
-		success:    lipgloss.Color("#B8BB26"), // green (bright)
-		error:      lipgloss.Color("#FB4934"), // red (bright)
-		muted:      lipgloss.Color("#A89984"), // gray (brighter)
-		highlight:  lipgloss.Color("#FE8019"), // orange (bright)
-		selection:  lipgloss.Color("#83A598"), // blue (bright)
-	},
-	themeDracula: {
-		name:       "Dracula",
-		background: lipgloss.Color("#282a36"),
-		foreground: lipgloss.Color("#f8f8f2"),
-		primary:    lipgloss.Color("#bd93f9"), // purple
-		secondary:  lipgloss.Color("#ff79c6"), // pink
-		accent:     lipgloss.Color("#8be9fd"), // cyan
-		success:    lipgloss.Color("#50fa7b"), // green
-		error:      lipgloss.Color("#ff5555"), // red
-		muted:      lipgloss.Color("#6272a4"), // comment
-		highlight:  lipgloss.Color("#ffb86c"), // orange
-		selection:  lipgloss.Color("#8be9fd"), // cyan
-	},
-}
-
 type model struct {
 	db               *Database
 	userKey          string
 	currentScreen    screen
 	renderer         *lipgloss.Renderer
 	currentTheme     themeName
-	selectedMenuItem int // 0=view, 1=send, 2=theme, 3=quit
+	selectedMenuItem int // 0=view, 1=send, 2=drafts, 3=timeline, 4=online, 5=groups, 6=theme, 7=settings, 8=quit
 	rateLimiter      *RateLimiter
+	mailer           *Mailer
+	webhookSender    *Webhooks
+	isAdmin          bool
+	presence         *Presence
+	sessionID        int
 
 	// For sending messages
 	recipientInput textinput.Model
 	messageInput   *textarea.Model
 	recipient      string
+	recipientGroup *Group // Set when sending to a group
+	composePreview bool   // Show the rendered message instead of the editor
+	draft          *composeDraft
+	draftGen       int // Tells the current autosave loop from older ones
+
+	// For drafts and scheduled messages
+	drafts            []Draft
+	selectedDraft     int
+	draftCount        int
+	draftsTab         int
+	scheduled         []ScheduledMessage
+	selectedScheduled int
+	scheduledCount    int
+	scheduling        bool // Asking when to send the message being written
+	scheduleInput     textinput.Model
+	editingScheduled  *ScheduledMessage // Set while changing a scheduled message
+	sentMessages      []Message
+	selectedSent      int
+	editingSent       *Message      // Set while changing a sent message
+	editWindow        time.Duration // How long after sending messages can be changed
 
 	// For viewing messages
-	messages              []Message
-	selectedMessageIndex  int
-	messageCount          int // Cached count of messages
-	messageScrollOffset   int // Current scroll offset for the selected message
+	messages             []Message
+	inboxRows            []int // Indexes into messages that the list shows
+	inboxUnreadOnly      bool
+	selectedMessageIndex int // Row in the list
+	messageCount         int // Cached count of messages
+	messageList          viewport.Model
+	messageViewport      viewport.Model // Body of the message in the reader
+	botIDs               map[string]bool
+	groupNames           map[int64]string
+	rawMessages          bool // Show message bodies without rendering Markdown
+
+	// For settings
+	selectedSettingsItem int
+	emailSettings        *EmailSettings
+	emailInput           textinput.Model
+	emailStep            emailStep
+	webhooks             []Webhook
+	webhookDeliveries    []WebhookDelivery
+	selectedWebhook      int
+	webhookInput         textinput.Model
+	addingWebhook        bool
+	addingGlobalWebhook  bool
+	checkingWebhook      bool // The URL being added is being looked up
+	apiTokens            []APIToken
+	selectedAPIToken     int
+	apiTokenNameInput    textinput.Model
+	namingAPIToken       bool
+	newAPITokenScope     string
+	newAPIToken          string // Shown once right after creation
+	bots                 []Bot
+	selectedBot          int
+	botNameInput         textinput.Model
+	namingBot            bool
+	newBotToken          string // Shown once right after creation
+
+	// For groups
+	groups              []Group
+	selectedGroup       int
+	groupNameInput      textinput.Model
+	namingGroup         bool
+	currentGroup        *Group
+	groupMembers        []GroupMember
+	selectedGroupMember int
+	groupInviteInput    textinput.Model
+	invitingMember      bool
+
+	// For the public timeline
+	posts             []Post
+	selectedPost      int
+	timelineFollowing bool // Following tab instead of global
+	following         map[string]bool
+	postInput         *textarea.Model
+
+	// For profiles
+	profile              Profile // Our own, while editing
+	selectedProfileField int
+	editingProfileField  bool
+	profileInput         textinput.Model
+	viewedUser           *User
+	viewedProfile        Profile
+	profileReturnScreen  screen
+
+	// For who's online
+	onlineUsers        []OnlineUser
+	onlineNames        map[string]string // Display names by fingerprint
+	selectedOnlineUser int
+
+	// For live chat
+	chatPeer         string
+	chatPeerName     string
+	chatPeerOnline   bool
+	chatInput        textinput.Model
+	chatViewport     viewport.Model
+	chatHistory      []Message
+	chatPeerTypingAt time.Time // Last typing notice from the peer
+	chatTypingSentAt time.Time // Last typing notice we sent
+	chatReturnScreen screen
+	pendingChatFrom  string // Someone who started chatting with us elsewhere
+
+	// For the theme picker
+	selectedTheme     int
+	themeBeforePicker themeName // Restored if the picker is cancelled
+	themeReturnScreen screen
+
+	// For preferences
+	userSettings       UserSettings
+	timezone           *time.Location // nil for the session's or server's time zone
+	sessionTimezone    *time.Location // From the TZ the client sent, if any
+	detectedColors     termenv.Profile
+	selectedPreference int
+	editingTimezone    bool
+	timezoneInput      textinput.Model
+
+	// For keybindings
+	keys              keyMap
+	keyOverrides      map[string][]string // The user's own keys, by action
+	showKeyHelp       bool
+	selectedKeyAction int
+	capturingKey      bool
+
+	// For new mail alerts
+	alertSettings        AlertSettings
+	selectedAlertSetting int
+	pendingAlert         string // Bell and notification escapes for the next render
 
 	// General
 	err           error
@@ -239,7 +335,7 @@ var (
 		Padding(2, 4)
 )
 
-func newModel(db *Database, userKey string, renderer *lipgloss.Renderer, rateLimiter *RateLimiter) model {
+func newModel(db *Database, userKey string, renderer *lipgloss.Renderer, rateLimiter *RateLimiter, mailer *Mailer, webhooks *Webhooks) model {
 	ti := textinput.New()
 	ti.Placeholder = "SSH key (example: nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8)"
 	ti.Focus()
@@ -253,23 +349,129 @@ func newModel(db *Database, userKey string, renderer *lipgloss.Renderer, rateLim
 	ta.SetHeight(5)
 	ta.ShowLineNumbers = true
 
-	return model{
-		db:             db,
-		userKey:        userKey,
-		renderer:       renderer,
-		currentTheme:   themeGruvbox, // Default theme
-		currentScreen:  mainMenu,
-		recipientInput: ti,
-		messageInput:   &ta,
-		rateLimiter:    rateLimiter,
+	ei := textinput.New()
+	ei.CharLimit = 254
+	ei.Width = 60
+
+	wi := textinput.New()
+	wi.Placeholder = "https://example.com/hooks/soshial"
+	wi.CharLimit = 2048
+	wi.Width = 60
+
+	ni := textinput.New()
+	ni.Placeholder = "deploy-script"
+	ni.CharLimit = 64
+	ni.Width = 60
+
+	bi := textinput.New()
+	bi.Placeholder = "deploy-notifier"
+	bi.CharLimit = 64
+	bi.Width = 60
+
+	gi := textinput.New()
+	gi.Placeholder = "book-club"
+	gi.CharLimit = 32
+	gi.Width = 60
+
+	ii := textinput.New()
+	ii.Placeholder = "SSH key fingerprint"
+	ii.CharLimit = 156
+	ii.Width = 60
+
+	pa := textarea.New()
+	pa.Placeholder = "What's happening?"
+	pa.CharLimit = maxPostLength
+	pa.SetWidth(80)
+	pa.SetHeight(5)
+
+	pi := textinput.New()
+	pi.Width = 60
+
+	ci := textinput.New()
+	ci.Placeholder = "Say something..."
+	ci.CharLimit = 1000
+	ci.Width = 64
+	ci.Prompt = ""
+
+	si := textinput.New()
+	si.Placeholder = "tomorrow 9am"
+	si.CharLimit = 64
+	si.Width = 60
+
+	tzi := textinput.New()
+	tzi.Placeholder = "Europe/Berlin"
+	tzi.CharLimit = 64
+	tzi.Width = 60
+
+	m := model{
+		db:                db,
+		userKey:           userKey,
+		renderer:          renderer,
+		currentTheme:      themeGruvbox, // Default theme
+		currentScreen:     mainMenu,
+		recipientInput:    ti,
+		messageInput:      &ta,
+		postInput:         &pa,
+		emailInput:        ei,
+		webhookInput:      wi,
+		apiTokenNameInput: ni,
+		botNameInput:      bi,
+		groupNameInput:    gi,
+		groupInviteInput:  ii,
+		profileInput:      pi,
+		chatInput:         ci,
+		timezoneInput:     tzi,
+		scheduleInput:     si,
+		chatViewport:      viewport.New(66, 12),
+		messageList:       viewport.New(68, 8),
+		messageViewport:   viewport.New(66, 15),
+		rateLimiter:       rateLimiter,
+		mailer:            mailer,
+		webhookSender:     webhooks,
+		draft:             &composeDraft{db: db},
+		editWindow:        defaultEditWindow,
 	}
+	if renderer != nil {
+		m.detectedColors = renderer.ColorProfile()
+	}
+
+	// Preferences apply from the start of the session
+	settings, err := db.GetUserSettings(userKey)
+	if err != nil {
+		m.err = err
+	}
+	m.keyOverrides, err = db.GetKeyBindings(userKey)
+	if err != nil {
+		m.err = err
+		m.keyOverrides = make(map[string][]string)
+	}
+	m.applyUserSettings(settings)
+	m.refreshDraftCounts()
+
+	// Pick up the message the user was writing when their last connection
+	// dropped
+	draft, err := db.TakeInterruptedDraft(userKey)
+	if err != nil {
+		m.err = err
+	} else if draft != nil {
+		resumed, _ := m.resumeDraft(*draft)
+		m = resumed.(model)
+		m.successMsg = "Resumed the message you were writing when you were disconnected"
+	}
+	return m
 }
 
 func (m model) Init() tea.Cmd {
-	return tea.Batch(
+	cmds := []tea.Cmd{
 		m.loadMessageCount(),
+		m.updateWindowTitle(),
 		tickEveryMinute(),
-	)
+	}
+	if m.currentScreen == sendMessageContent {
+		// Resumed an interrupted draft
+		cmds = append(cmds, textarea.Blink, autosaveDraft(m.draftGen))
+	}
+	return tea.Batch(cmds...)
 }
 
 func (m model) loadMessageCount() tea.Cmd {
@@ -356,7 +558,7 @@ func (m model) getStyles() styles {
 			BorderForeground(t.primary).
 			Padding(1, 2).
 			MarginBottom(1).
-			Width(70),
+			Width(m.contentWidth()),
 
 		messageHeaderStyle: r.NewStyle().
 			Foreground(t.secondary).
@@ -377,10 +579,16 @@ func (m model) getStyles() styles {
 			Padding(0, 1).
 			Bold(true),
 
+		botBadgeStyle: r.NewStyle().
+			Foreground(t.background).
+			Background(t.secondary).
+			Bold(true),
+
 		inputLabelStyle: r.NewStyle().
 			Foreground(t.accent).
 			Bold(true).
-			MarginBottom(1),
+			MarginBottom(1).
+			Width(m.contentWidth()),
 
 		inputBoxStyle: r.NewStyle().
 			Border(lipgloss.RoundedBorder()).
@@ -391,7 +599,8 @@ func (m model) getStyles() styles {
 		helpStyle: r.NewStyle().
 			Foreground(t.muted).
 			MarginTop(2).
-			Italic(true),
+			Italic(true).
+			Width(m.contentWidth()),
 
 		dividerStyle: r.NewStyle().
 			Foreground(t.primary).
@@ -431,6 +640,7 @@ type styles struct {
 	messageTimeStyle    lipgloss.Style
 	messageContentStyle lipgloss.Style
 	newBadgeStyle       lipgloss.Style
+	botBadgeStyle       lipgloss.Style
 	inputLabelStyle     lipgloss.Style
 	inputBoxStyle       lipgloss.Style
 	helpStyle           lipgloss.Style
@@ -443,9 +653,29 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
 		m.height = msg.Height
+		m.resizeInputs()
+		switch m.currentScreen {
+		case chatScreen:
+			m.resizeChat()
+		case viewMessages, readMessage:
+			m.refreshMessageList()
+			m.refreshReader()
+		}
 		return m, nil
 
 	case tea.KeyMsg:
+		m.presence.Touch(m.sessionID)
+
+		// Any key closes the help overlay
+		if m.showKeyHelp {
+			m.showKeyHelp = false
+			return m, nil
+		}
+		if !m.typing() && m.keys.matches(msg, keyHelp) {
+			m.showKeyHelp = true
+			return m, nil
+		}
+
 		switch m.currentScreen {
 		case mainMenu:
 			return m.updateMainMenu(msg)
@@ -455,6 +685,44 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updateSendMessageRecipient(msg)
 		case sendMessageContent:
 			return m.updateSendMessageContent(msg)
+		case settingsMenu:
+			return m.updateSettingsMenu(msg)
+		case emailNotifications:
+			return m.updateEmailNotifications(msg)
+		case webhookSettings:
+			return m.updateWebhookSettings(msg)
+		case apiTokenSettings:
+			return m.updateAPITokenSettings(msg)
+		case botSettings:
+			return m.updateBotSettings(msg)
+		case groupList:
+			return m.updateGroupList(msg)
+		case groupDetail:
+			return m.updateGroupDetail(msg)
+		case timeline:
+			return m.updateTimeline(msg)
+		case composePost:
+			return m.updateComposePost(msg)
+		case profileSettings:
+			return m.updateProfileSettings(msg)
+		case profileView:
+			return m.updateProfileView(msg)
+		case whosOnline:
+			return m.updateWhosOnline(msg)
+		case chatScreen:
+			return m.updateChat(msg)
+		case alertSettingsScreen:
+			return m.updateAlertSettings(msg)
+		case readMessage:
+			return m.updateReadMessage(msg)
+		case themePicker:
+			return m.updateThemePicker(msg)
+		case preferencesScreen:
+			return m.updatePreferences(msg)
+		case keyBindingsScreen:
+			return m.updateKeyBindings(msg)
+		case draftsScreen:
+			return m.updateDrafts(msg)
 		}
 
 	case errMsg:
@@ -468,7 +736,93 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case tickMsg:
 		// Periodic message count refresh
-		return m, tea.Batch(m.loadMessageCount(), tickEveryMinute())
+		cmd := tea.Batch(m.loadMessageCount(), m.updateWindowTitle(), tickEveryMinute())
+		if m.currentScreen == whosOnline {
+			// Statuses age into away and idle without any event
+			updated, _ := m.reloadWhosOnline()
+			return updated, cmd
+		}
+		return m, cmd
+
+	case presenceChangedMsg:
+		if m.currentScreen == whosOnline {
+			return m.reloadWhosOnline()
+		}
+		if m.currentScreen == chatScreen {
+			m.chatPeerOnline = m.presence.Status(m.chatPeer) != ""
+		}
+		return m, nil
+
+	case chatMessageMsg:
+		return m.handleChatMessage(msg.msg)
+
+	case chatTypingMsg:
+		return m.handleChatTyping(msg.from)
+
+	case newMailMsg:
+		return m.handleNewMail(msg.msg)
+
+	case alertDoneMsg:
+		m.pendingAlert = ""
+		return m, nil
+
+	case scheduledSentMsg:
+		m.refreshDraftCounts()
+		if m.currentScreen == draftsScreen {
+			return m.reloadDrafts()
+		}
+		return m, nil
+
+	case messageChangedMsg:
+		return m.handleMessageChanged(msg)
+
+	case draftTickMsg:
+		if msg.gen != m.draftGen || m.currentScreen != sendMessageContent {
+			return m, nil
+		}
+		if _, err := m.draft.save(false); err != nil {
+			m.err = fmt.Errorf("saving draft: %w", err)
+		}
+		return m, autosaveDraft(m.draftGen)
+
+	case chatTypingExpiredMsg:
+		// Nothing to update; receiving it re-renders the typing indicator
+		return m, nil
+
+	case emailCodeSentMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			m.successMsg = ""
+			return m, nil
+		}
+		settings, err := m.db.GetEmailSettings(m.userKey)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.emailSettings = settings
+		m.emailStep = emailEnterCode
+		m.emailInput.Placeholder = "123456"
+		m.emailInput.SetValue("")
+		m.successMsg = ""
+		m.err = nil
+		return m, m.emailInput.Focus()
+
+	case webhookAddedMsg:
+		return m.handleWebhookAdded(msg)
+
+	case webhookTestMsg:
+		if msg.err != nil {
+			m.err = fmt.Errorf("test delivery failed: %v", msg.err)
+			m.successMsg = ""
+		} else {
+			m.successMsg = fmt.Sprintf("Test delivery succeeded (%d)", msg.status)
+			m.err = nil
+		}
+		if m.currentScreen == webhookSettings {
+			return m.reloadWebhooks()
+		}
+		return m, nil
 	}
 
 	// Always update textarea for cursor blink and other internal messages
@@ -477,40 +831,99 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.messageInput = &updated
 		return m, cmd
 	}
+	if m.currentScreen == composePost {
+		updated, cmd := m.postInput.Update(msg)
+		m.postInput = &updated
+		return m, cmd
+	}
+	if m.currentScreen == emailNotifications && m.emailStep != emailOverview {
+		var cmd tea.Cmd
+		m.emailInput, cmd = m.emailInput.Update(msg)
+		return m, cmd
+	}
+	if m.currentScreen == webhookSettings && m.addingWebhook {
+		var cmd tea.Cmd
+		m.webhookInput, cmd = m.webhookInput.Update(msg)
+		return m, cmd
+	}
+	if m.currentScreen == apiTokenSettings && m.namingAPIToken {
+		var cmd tea.Cmd
+		m.apiTokenNameInput, cmd = m.apiTokenNameInput.Update(msg)
+		return m, cmd
+	}
+	if m.currentScreen == botSettings && m.namingBot {
+		var cmd tea.Cmd
+		m.botNameInput, cmd = m.botNameInput.Update(msg)
+		return m, cmd
+	}
+	if m.currentScreen == groupList && m.namingGroup {
+		var cmd tea.Cmd
+		m.groupNameInput, cmd = m.groupNameInput.Update(msg)
+		return m, cmd
+	}
+	if m.currentScreen == groupDetail && m.invitingMember {
+		var cmd tea.Cmd
+		m.groupInviteInput, cmd = m.groupInviteInput.Update(msg)
+		return m, cmd
+	}
+	if m.currentScreen == profileSettings && m.editingProfileField {
+		var cmd tea.Cmd
+		m.profileInput, cmd = m.profileInput.Update(msg)
+		return m, cmd
+	}
+	if m.currentScreen == chatScreen {
+		var cmd tea.Cmd
+		m.chatInput, cmd = m.chatInput.Update(msg)
+		return m, cmd
+	}
+	if m.currentScreen == preferencesScreen && m.editingTimezone {
+		var cmd tea.Cmd
+		m.timezoneInput, cmd = m.timezoneInput.Update(msg)
+		return m, cmd
+	}
 
 	return m, nil
 }
 
 func (m model) updateMainMenu(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "q", "ctrl+c":
+	switch {
+	case m.keys.matches(msg, keyQuit):
 		return m, tea.Quit
 
-	case "c":
+	case m.keys.matches(msg, keyCopy):
 		// Copy SSH key fingerprint to clipboard using OSC 52
 		m.successMsg = "SSH key fingerprint copied to clipboard!"
 		m.clipboardText = m.userKey
 		return m, nil
 
+	case m.keys.matches(msg, keyJoinChat):
+		// Join a chat someone started with us
+		if m.pendingChatFrom != "" {
+			return m.openChat(m.pendingChatFrom)
+		}
+
 	// Navigation
-	case "j", "down":
-		m.selectedMenuItem = (m.selectedMenuItem + 1) % 4
-	case "k", "up":
-		m.selectedMenuItem = (m.selectedMenuItem - 1 + 4) % 4
+	case m.keys.matches(msg, keyDown):
+		m.selectedMenuItem = (m.selectedMenuItem + 1) % 9
+	case m.keys.matches(msg, keyUp):
+		m.selectedMenuItem = (m.selectedMenuItem - 1 + 9) % 9
 
 	// Selection
-	case "enter", " ":
+	case m.keys.matches(msg, keySelect):
 		return m.executeMenuAction()
 
 	// Legacy number keys
-	case "1":
+	case msg.String() == "1":
 		m.selectedMenuItem = 0
 		return m.executeMenuAction()
-	case "2":
+	case msg.String() == "2":
 		m.selectedMenuItem = 1
 		return m.executeMenuAction()
-	case "3":
-		m.selectedMenuItem = 2
+	case msg.String() == "3":
+		m.selectedMenuItem = 6
+		return m.executeMenuAction()
+	case msg.String() == "4":
+		m.selectedMenuItem = 7
 		return m.executeMenuAction()
 	}
 	return m, nil
@@ -519,119 +932,36 @@ func (m model) updateMainMenu(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (m model) executeMenuAction() (tea.Model, tea.Cmd) {
 	switch m.selectedMenuItem {
 	case 0: // View messages
-		messages, err := m.db.GetMessagesForUser(m.userKey)
-		if err != nil {
-			m.err = err
-			return m, nil
-		}
-		m.messages = messages
-
-		// Mark all unread messages as read
-		for _, msg := range messages {
-			if !msg.Read {
-				if err := m.db.MarkMessageAsRead(msg.ID); err != nil {
-					m.err = err
-					return m, nil
-				}
-			}
-		}
-
-		m.currentScreen = viewMessages
-		m.selectedMessageIndex = 0
-		m.err = nil
-		m.successMsg = ""
+		return m.openInbox()
 
 	case 1: // Send message
 		m.currentScreen = sendMessageRecipient
 		m.recipientInput.SetValue("")
 		m.recipientInput.Focus()
+		m.recipientGroup = nil
 		m.err = nil
 		m.successMsg = ""
 
-	case 2: // Change theme
-		if m.currentTheme == themeGruvbox {
-			m.currentTheme = themeDracula
-		} else {
-			m.currentTheme = themeGruvbox
-		}
-		m.err = nil
-		m.successMsg = ""
+	case 2: // Drafts
+		return m.openDrafts()
 
-	case 3: // Quit
-		return m, tea.Quit
-	}
-	return m, nil
-}
+	case 3: // Timeline
+		return m.openTimeline()
 
-func (m model) updateViewMessages(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	switch msg.String() {
-	case "q", "esc":
-		m.currentScreen = mainMenu
-		m.messages = nil
-		m.selectedMessageIndex = 0
-		m.messageScrollOffset = 0
-
-	case "j", "down":
-		if len(m.messages) > 0 {
-			// Check if current message can scroll down
-			currentMsg := m.messages[m.selectedMessageIndex]
-			msgLines := strings.Split(currentMsg.Message, "\n")
-			const maxVisibleLines = 5
-
-			if len(msgLines) > maxVisibleLines {
-				// Message has more than 5 lines - check if we can scroll
-				maxOffset := len(msgLines) - maxVisibleLines
-				if m.messageScrollOffset < maxOffset {
-					// Scroll down within the current message
-					m.messageScrollOffset++
-					return m, nil
-				}
-			}
+	case 4: // Who's online
+		return m.openWhosOnline()
 
-			// At the end of message or message fits in view - go to next message
-			m.selectedMessageIndex = (m.selectedMessageIndex + 1) % len(m.messages)
-			m.messageScrollOffset = 0 // Reset scroll for new message
-		}
+	case 5: // Groups
+		return m.openGroups()
 
-	case "k", "up":
-		if len(m.messages) > 0 {
-			// Check if current message can scroll up
-			if m.messageScrollOffset > 0 {
-				// Scroll up within the current message
-				m.messageScrollOffset--
-				return m, nil
-			}
+	case 6: // Change theme
+		return m.openThemePicker()
 
-			// At the top of message - go to previous message
-			m.selectedMessageIndex = (m.selectedMessageIndex - 1 + len(m.messages)) % len(m.messages)
-
-			// Set scroll to bottom of new message if it's long
-			newMsg := m.messages[m.selectedMessageIndex]
-			msgLines := strings.Split(newMsg.Message, "\n")
-			const maxVisibleLines = 5
-			if len(msgLines) > maxVisibleLines {
-				m.messageScrollOffset = len(msgLines) - maxVisibleLines
-			} else {
-				m.messageScrollOffset = 0
-			}
-		}
+	case 7: // Settings
+		return m.openSettings()
 
-	case "d":
-		if len(m.messages) > 0 && m.selectedMessageIndex < len(m.messages) {
-			msgToDelete := m.messages[m.selectedMessageIndex]
-			if err := m.db.DeleteMessage(msgToDelete.ID); err != nil {
-				m.err = err
-			} else {
-				m.successMsg = "Message deleted"
-				// Remove from slice
-				m.messages = append(m.messages[:m.selectedMessageIndex], m.messages[m.selectedMessageIndex+1:]...)
-				// Adjust selection if needed
-				if m.selectedMessageIndex >= len(m.messages) && len(m.messages) > 0 {
-					m.selectedMessageIndex = len(m.messages) - 1
-				}
-				m.messageScrollOffset = 0 // Reset scroll
-			}
-		}
+	case 8: // Quit
+		return m, tea.Quit
 	}
 	return m, nil
 }
@@ -641,17 +971,18 @@ func (m model) updateSendMessageRecipient(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	switch msg.String() {
 	case "enter":
-		m.recipient = m.recipientInput.Value()
+		m.recipient = strings.TrimSpace(m.recipientInput.Value())
 		if m.recipient == "" {
 			m.err = fmt.Errorf("recipient cannot be empty")
 			return m, nil
 		}
-		m.currentScreen = sendMessageContent
+		group, err := m.resolveGroupRecipient(m.recipient)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
 		m.recipientInput.Blur()
-		m.messageInput.SetValue("")
-		m.err = nil
-		cmd := m.messageInput.Focus()
-		return m, cmd
+		return m.openCompose(m.recipient, group)
 	case "esc":
 		m.currentScreen = mainMenu
 		return m, nil
@@ -664,8 +995,28 @@ func (m model) updateSendMessageRecipient(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 func (m model) updateSendMessageContent(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 
-	switch msg.String() {
-	case "ctrl+s":
+	if m.scheduling {
+		return m.updateSchedulePrompt(msg)
+	}
+
+	// Enter sends in quick compose, so new lines need their own key
+	quick := m.userSettings.ComposeMode == composeModeQuick
+	if quick && m.keys.matches(msg, keyNewLine) {
+		if !m.composePreview {
+			m.messageInput.InsertString("\n")
+			m.draft.update(m.messageInput.Value())
+		}
+		return m, nil
+	}
+
+	switch {
+	case m.keys.matches(msg, keySend) || (quick && msg.String() == "enter"):
+		if m.editingScheduled != nil {
+			return m.saveScheduledEdit(m.editingScheduled.SendAt)
+		}
+		if m.editingSent != nil {
+			return m.saveSentEdit()
+		}
 		message := m.messageInput.Value()
 		if message == "" {
 			m.err = fmt.Errorf("message cannot be empty")
@@ -678,31 +1029,85 @@ func (m model) updateSendMessageContent(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 
-		err := m.db.SendMessage(m.userKey, m.recipient, message)
-		if err != nil {
-			m.err = err
-			return m, nil
+		if m.recipientGroup != nil {
+			sent, err := m.db.SendGroupMessage(m.userKey, m.recipientGroup.ID, message)
+			if err != nil {
+				m.err = err
+				return m, nil
+			}
+			for _, msg := range sent {
+				go m.webhookSender.Emit(eventMessageReceived, msg.ToKey, msg)
+				m.presence.Send(msg.ToKey, newMailMsg{msg})
+			}
+			m.successMsg = fmt.Sprintf("Message sent to everyone in #%s!", m.recipientGroup.Name)
+		} else {
+			sent, err := m.db.SendMessage(m.userKey, m.recipient, message)
+			if err != nil {
+				m.err = err
+				return m, nil
+			}
+			go m.webhookSender.Emit(eventMessageReceived, m.recipient, sent)
+			m.presence.Send(m.recipient, newMailMsg{sent})
+			m.successMsg = "Message sent successfully!"
 		}
 
 		// Record that message was sent
 		m.rateLimiter.RecordMessage(m.userKey)
 
-		m.successMsg = "Message sent successfully!"
 		m.currentScreen = mainMenu
 		m.recipient = ""
-		m.err = nil
+		m.recipientGroup = nil
+		m.composePreview = false
+		m.err = m.draft.discard()
+		m.refreshDraftCounts()
 		return m, nil
-	case "esc":
-		m.currentScreen = mainMenu
-		m.recipient = ""
+	case m.keys.matches(msg, keyLeaveCompose):
+		if m.editingScheduled != nil || m.editingSent != nil {
+			m.closeEdit()
+			return m.reloadDrafts()
+		}
+		return m.leaveCompose()
+	case m.keys.matches(msg, keySchedule):
+		if m.editingSent != nil {
+			return m, nil
+		}
+		return m.openSchedulePrompt()
+	case m.keys.matches(msg, keyPreview):
+		m.composePreview = !m.composePreview
+		if m.composePreview {
+			m.messageInput.Blur()
+			return m, nil
+		}
+		return m, m.messageInput.Focus()
+	}
+
+	// The message can't be edited while previewing it
+	if m.composePreview {
 		return m, nil
 	}
 
 	updated, cmd := m.messageInput.Update(msg)
 	m.messageInput = &updated
+	m.draft.update(m.messageInput.Value())
 	return m, cmd
 }
 
+// replyTo starts a message answering msg. Replies to group messages go back
+// to the whole group while the user is still a member of it.
+func (m model) replyTo(msg Message) (tea.Model, tea.Cmd) {
+	if name, ok := m.groupNames[msg.GroupID]; ok {
+		group, err := m.db.GetGroupForUser(name, m.userKey)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		if group != nil && !group.Pending {
+			return m.openCompose("", group)
+		}
+	}
+	return m.openCompose(msg.FromKey, nil)
+}
+
 func (m model) View() string {
 	// Handle clipboard copy via OSC 52 if needed
 	var clipboardSeq string
@@ -722,13 +1127,51 @@ func (m model) View() string {
 		view = m.viewSendMessageRecipient()
 	case sendMessageContent:
 		view = m.viewSendMessageContent()
+	case settingsMenu:
+		view = m.viewSettingsMenu()
+	case emailNotifications:
+		view = m.viewEmailNotifications()
+	case webhookSettings:
+		view = m.viewWebhookSettings()
+	case apiTokenSettings:
+		view = m.viewAPITokenSettings()
+	case botSettings:
+		view = m.viewBotSettings()
+	case groupList:
+		view = m.viewGroupList()
+	case groupDetail:
+		view = m.viewGroupDetail()
+	case timeline:
+		view = m.viewTimeline()
+	case composePost:
+		view = m.viewComposePost()
+	case profileSettings:
+		view = m.viewProfileSettings()
+	case profileView:
+		view = m.viewProfileView()
+	case whosOnline:
+		view = m.viewWhosOnline()
+	case chatScreen:
+		view = m.viewChat()
+	case alertSettingsScreen:
+		view = m.viewAlertSettings()
+	case readMessage:
+		view = m.viewReadMessage()
+	case themePicker:
+		view = m.viewThemePicker()
+	case preferencesScreen:
+		view = m.viewPreferences()
+	case keyBindingsScreen:
+		view = m.viewKeyBindings()
+	case draftsScreen:
+		view = m.viewDrafts()
 	}
-
-	// Prepend clipboard sequence if present
-	if clipboardSeq != "" {
-		return clipboardSeq + view
+	if m.showKeyHelp {
+		view = m.viewKeyHelp()
 	}
-	return view
+
+	// Prepend clipboard and alert sequences if present
+	return clipboardSeq + m.pendingAlert + m.layout(view)
 }
 
 func (m model) viewMainMenu() string {
@@ -749,7 +1192,13 @@ func (m model) viewMainMenu() string {
 
 	// Colorize the ASCII art
 	// "So" part, "SSH" part (middle), "ial" part (end)
+	// Small terminals skip it to leave room for the menu
+	bannerPadding := strings.Repeat(" ", max((m.contentWidth()-lipgloss.Width(asciiArt[0]))/2, 0))
+	if m.compact() {
+		asciiArt = nil
+	}
 	for _, line := range asciiArt {
+		s.WriteString(bannerPadding)
 		runes := []rune(line)
 		if len(runes) > 50 {
 			// Split into three parts: So, SSH, ial
@@ -770,13 +1219,15 @@ func (m model) viewMainMenu() string {
 		}
 		s.WriteString("\n")
 	}
-	s.WriteString("\n")
+	if !m.compact() {
+		s.WriteString("\n")
+	}
 
-	// Centered divider (69 char width, moved 1 char left)
-	dividerLine := strings.Repeat("─", 51)
+	// Centered divider
+	dividerLine := strings.Repeat("─", min(51, m.contentWidth()))
 	centeredDivider := m.renderer.NewStyle().
 		Foreground(st.secondaryColor).
-		Width(69).
+		Width(m.contentWidth()).
 		Align(lipgloss.Center).
 		Render(dividerLine)
 	s.WriteString(centeredDivider)
@@ -785,7 +1236,7 @@ func (m model) viewMainMenu() string {
 	// User SSH key - centered
 	sshKeyLabel := m.renderer.NewStyle().
 		Foreground(st.accentColor).
-		Width(69).
+		Width(m.contentWidth()).
 		Align(lipgloss.Center).
 		Render("Your SSH key fingerprint:")
 	s.WriteString(sshKeyLabel)
@@ -798,7 +1249,7 @@ func (m model) viewMainMenu() string {
 		Bold(true).
 		Render(m.userKey)
 	centeredBadge := m.renderer.NewStyle().
-		Width(69).
+		Width(m.contentWidth()).
 		Align(lipgloss.Center).
 		Render(sshKeyBadge)
 	s.WriteString(centeredBadge)
@@ -810,17 +1261,28 @@ func (m model) viewMainMenu() string {
 
 	// Menu options
 	viewMessagesText := fmt.Sprintf("✉  View messages (%d)", m.messageCount)
+	draftsText := fmt.Sprintf("🗒  Drafts (%d)", m.draftCount)
+	if m.scheduledCount > 0 {
+		draftsText += fmt.Sprintf(" • %d scheduled", m.scheduledCount)
+	}
 	menuItems := []string{
 		viewMessagesText,
 		"📝 Send a message",
+		draftsText,
+		"📣 Timeline",
+		"🟢 Who's online",
+		"👥 Groups",
 		"🎨 Change theme",
+		"⚙  Settings",
 		"🚪 Quit",
 	}
 
-	// Calculate left padding to center the first row (with indicator/spaces)
-	// First item with spaces: "  ✉️  View messages" is roughly 21 chars
-	// To center in width 69: (69 - 21) / 2 ≈ 24 spaces
-	leftPadding := 22
+	// Left padding that centers the widest row, including the indicator
+	menuWidth := 0
+	for _, item := range menuItems {
+		menuWidth = max(menuWidth, lipgloss.Width(item)+2)
+	}
+	leftPadding := max((m.contentWidth()-menuWidth)/2, 0)
 
 	for i, item := range menuItems {
 		// Split emoji from text (emoji is first rune + space)
@@ -851,298 +1313,82 @@ func (m model) viewMainMenu() string {
 	s.WriteString("\n")
 	if m.successMsg != "" {
 		// Special handling for theme change messages
-		if strings.Contains(m.successMsg, "Theme changed to") {
-			var themeName string
-			var themeColors []lipgloss.Color
-
-			if strings.Contains(m.successMsg, "Gruvbox") {
-				themeName = "Gruvbox"
-				// Gruvbox color palette for each letter (official bright colors)
-				themeColors = []lipgloss.Color{
-					lipgloss.Color("#FABD2F"), // G - yellow (primary)
-					lipgloss.Color("#8EC07C"), // r - aqua (accent)
-					lipgloss.Color("#D3869B"), // u - purple (secondary)
-					lipgloss.Color("#B8BB26"), // v - green (success)
-					lipgloss.Color("#FE8019"), // b - orange (highlight)
-					lipgloss.Color("#FB4934"), // o - red (error)
-					lipgloss.Color("#83A598"), // x - blue (bright)
-				}
-			} else if strings.Contains(m.successMsg, "Dracula") {
-				themeName = "Dracula"
-				// Dracula color palette for each letter
-				themeColors = []lipgloss.Color{
-					lipgloss.Color("#bd93f9"), // D - purple (primary)
-					lipgloss.Color("#8be9fd"), // r - cyan (accent)
-					lipgloss.Color("#ff79c6"), // a - pink (secondary)
-					lipgloss.Color("#50fa7b"), // c - green (success)
-					lipgloss.Color("#ffb86c"), // u - orange (highlight)
-					lipgloss.Color("#f1fa8c"), // l - yellow
-					lipgloss.Color("#ff5555"), // a - red (error)
-				}
-			}
-
-			// Build the colorized theme name
-			var coloredThemeName strings.Builder
-			for i, char := range themeName {
-				coloredChar := m.renderer.NewStyle().
-					Foreground(themeColors[i]).
-					Bold(true).
-					Render(string(char))
-				coloredThemeName.WriteString(coloredChar)
-			}
+		if strings.HasPrefix(m.successMsg, "Theme changed to") {
+			// The theme's name in its own palette
+			coloredThemeName := m.renderThemeName(themes[m.currentTheme])
 
 			checkmark := m.renderer.NewStyle().Foreground(st.successColor).Render("✓")
 			normalText := m.renderer.NewStyle().Foreground(st.textColor).Render(" Theme changed to ")
 
 			// Center the entire message
-			fullMessage := checkmark + normalText + coloredThemeName.String()
+			fullMessage := checkmark + normalText + coloredThemeName
 			centeredMessage := m.renderer.NewStyle().
-				Width(69).
+				Width(m.contentWidth()).
 				Align(lipgloss.Center).
 				Render(fullMessage)
 
 			s.WriteString(centeredMessage)
 		} else {
 			// Other success messages without background
-			s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Render("  ✓ " + m.successMsg))
+			s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
 		}
 	} else if m.err != nil {
-		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Render("  ✗ " + m.err.Error()))
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
 	}
 	s.WriteString("\n")
 
 	// Help text
-	s.WriteString(st.helpStyle.Render("j/k or ↑/↓ to navigate • Enter to select • c to copy key • q to quit"))
+	s.WriteString(st.helpStyle.Render(m.navHint() + " • " + m.keyHint(keySelect, "to select") + " • " + m.keyHint(keyCopy, "to copy key") + " • " + m.keyHint(keyHelp, "for all keys") + " • " + m.keyHint(keyQuit, "to quit")))
 
-	// Theme indicator in bottom left
-	themeText := fmt.Sprintf("\n\nTheme: %s", themes[m.currentTheme].name)
-	s.WriteString(m.renderer.NewStyle().Foreground(st.mutedColor).Render(themeText))
+	// Theme indicator in bottom left, left out on small terminals like the
+	// banner
+	if !m.compact() {
+		themeText := fmt.Sprintf("\n\nTheme: %s", themes[m.currentTheme].name)
+		s.WriteString(m.renderer.NewStyle().Foreground(st.mutedColor).Render(themeText))
+	}
 
 	return s.String()
 }
 
-func (m model) viewMessagesScreen() string {
-	st := m.getStyles()
-	var s strings.Builder
-
-	// Title
-	title := st.titleStyle.Width(70).Render("✉  Your Messages")
-	s.WriteString(title)
-	s.WriteString("\n")
-
-	// Fixed height container for messages (always same height)
-	var messagesContent strings.Builder
-
-	if len(m.messages) == 0 {
-		// Empty state
-		emptyMsg := st.emptyStateStyle.Width(70).Render("📭 No messages yet!\n\nYour inbox is empty.")
-		messagesContent.WriteString(emptyMsg)
-	} else {
-		// Show max 3 messages at a time (1 expanded, 2 compact)
-		const maxVisible = 3
-
-		// Calculate which messages to show
-		// Position selected message at top, middle, or bottom depending on where it is in the list
-		var startIdx, endIdx int
-		if m.selectedMessageIndex == 0 {
-			// Selected is first message - show it at top
-			startIdx = 0
-			endIdx = maxVisible
-			if endIdx > len(m.messages) {
-				endIdx = len(m.messages)
-			}
-		} else if m.selectedMessageIndex >= len(m.messages)-1 {
-			// Selected is last message - show it at bottom
-			endIdx = len(m.messages)
-			startIdx = endIdx - maxVisible
-			if startIdx < 0 {
-				startIdx = 0
-			}
-		} else {
-			// Selected is in middle - show 1 before, selected, 1 after
-			startIdx = m.selectedMessageIndex - 1
-			if startIdx < 0 {
-				startIdx = 0
-			}
-			endIdx = startIdx + maxVisible
-			if endIdx > len(m.messages) {
-				endIdx = len(m.messages)
-			}
-		}
-
-		// Display the visible messages
-		for i := startIdx; i < endIdx; i++ {
-			msg := m.messages[i]
-
-			if i == m.selectedMessageIndex {
-				// Selected message - full expanded view with fixed content height
-				var messageContent strings.Builder
-
-				// Header with sender
-				header := st.messageHeaderStyle.Render(fmt.Sprintf("From: %s", msg.FromKey))
-				if !msg.Read {
-					header += " " + st.newBadgeStyle.Render(" NEW ")
-				}
-				messageContent.WriteString(header)
-				messageContent.WriteString("\n")
-
-				// Timestamp and helper text on same line
-				msgLines := strings.Split(msg.Message, "\n")
-				const maxMessageLines = 5
-
-				timeStr := st.messageTimeStyle.Render(msg.Timestamp.Format("Mon, Jan 2 2006 at 15:04"))
-
-				// Add helper text on same line if message is longer than 5 lines
-				if len(msgLines) > maxMessageLines {
-					helperStyle := m.renderer.NewStyle().Foreground(st.mutedColor)
-					helperText := helperStyle.Render("j/k ↑↓ to view full message")
-
-					// Width is 70, padding(1,2) means 66 internal width
-					const internalWidth = 66
-					leftWidth := lipgloss.Width(timeStr)
-					rightWidth := lipgloss.Width(helperText)
-					spacingWidth := internalWidth - leftWidth - rightWidth
-					if spacingWidth < 1 {
-						spacingWidth = 1
-					}
-
-					timestampLine := timeStr + strings.Repeat(" ", spacingWidth) + helperText
-					messageContent.WriteString(timestampLine)
-				} else {
-					messageContent.WriteString(timeStr)
-				}
-				messageContent.WriteString("\n")
-
-				// Message content - limit to exactly 5 lines (header=1, timestamp=1, message=5 for total of 7)
-
-				// Display message lines with scroll offset
-				startLine := m.messageScrollOffset
-				endLine := startLine + maxMessageLines
-				if endLine > len(msgLines) {
-					endLine = len(msgLines)
-				}
-
-				for j := 0; j < maxMessageLines; j++ {
-					lineIdx := startLine + j
-					if lineIdx < len(msgLines) {
-						messageContent.WriteString(msgLines[lineIdx])
-					}
-					if j < maxMessageLines-1 {
-						messageContent.WriteString("\n")
-					}
-				}
-
-				// Full box with highlighted border
-				selectedStyle := m.renderer.NewStyle().
-					Border(lipgloss.ThickBorder()).
-					BorderForeground(st.accentColor).
-					Padding(1, 2).
-					MarginBottom(1).
-					Width(70)
-				box := selectedStyle.Render(messageContent.String())
-				messagesContent.WriteString(box)
-			} else {
-				// Unselected message - compact one-line view
-				// Truncate sender to max 20 chars
-				sender := msg.FromKey
-				if len(sender) > 20 {
-					sender = sender[:17] + "..."
-				}
-
-				// Format date and time as YYYY-MM-DD HH:MM
-				dateTimeStr := msg.Timestamp.Format("2006-01-02 15:04")
-
-				// Calculate direction indicator
-				// Hide direction text only for the middle compact box when selected is at top or bottom
-				var directionText string
-				isMiddleBox := (m.selectedMessageIndex == 0 && i == startIdx+1) ||
-					(m.selectedMessageIndex == len(m.messages)-1 && i == endIdx-2)
-
-				if !isMiddleBox {
-					if i < m.selectedMessageIndex {
-						// This is a newer message
-						if i == 0 {
-							directionText = "  Newest"
-						} else {
-							newerCount := i
-							directionText = fmt.Sprintf("  %d newer...", newerCount)
-						}
-					} else if i > m.selectedMessageIndex {
-						// This is an older message
-						if i == len(m.messages)-1 {
-							directionText = "  Oldest"
-						} else {
-							olderCount := len(m.messages) - i - 1
-							directionText = fmt.Sprintf("  %d older...", olderCount)
-						}
-					}
-				}
-
-				// Build left part (sender) and right part (timestamp + direction)
-				leftPart := fmt.Sprintf("From: %s", sender)
-				if !msg.Read {
-					leftPart += " " + st.newBadgeStyle.Render(" NEW ")
-				}
-
-				rightPart := dateTimeStr + directionText
-
-				// Width is 70, padding(0,1) means 68 internal width
-				// Calculate spacing to push right part to the right
-				const internalWidth = 68
-				leftWidth := lipgloss.Width(leftPart)
-				rightWidth := lipgloss.Width(rightPart)
-				spacingWidth := internalWidth - leftWidth - rightWidth
-				if spacingWidth < 1 {
-					spacingWidth = 1
-				}
-
-				compactLine := leftPart + strings.Repeat(" ", spacingWidth) + rightPart
-
-				// Compact box
-				compactStyle := m.renderer.NewStyle().
-					Border(lipgloss.RoundedBorder()).
-					BorderForeground(st.mutedColor).
-					Padding(0, 1).
-					MarginBottom(1).
-					Width(70)
-				box := compactStyle.Render(compactLine)
-				messagesContent.WriteString(box)
-			}
-
-			if i < endIdx-1 {
-				messagesContent.WriteString("\n")
-			}
-		}
+// carouselWindow returns the range of items a carousel shows: at most
+// maxVisible, with the selected item in the middle unless it is near the top
+// or bottom of the list.
+func carouselWindow(selected, total, maxVisible int) (startIdx, endIdx int) {
+	startIdx = selected - (maxVisible-1)/2
+	if startIdx > total-maxVisible {
+		startIdx = total - maxVisible
 	}
-
-	// Manually pad to fixed height
-	content := messagesContent.String()
-
-	// Count actual rendered lines by splitting on newlines
-	renderedLines := strings.Split(content, "\n")
-	actualLineCount := len(renderedLines)
-
-	// Target: 1 expanded box (~9 lines) + 2 compact boxes (~3 lines each) = ~15 lines
-	targetLines := 15
-
-	s.WriteString(content)
-
-	// Add padding newlines to reach exact target height
-	paddingNeeded := targetLines - actualLineCount
-	if paddingNeeded > 0 {
-		s.WriteString(strings.Repeat("\n", paddingNeeded))
+	if startIdx < 0 {
+		startIdx = 0
 	}
-
-	// Success or error messages (fixed height to keep bottom elements stable)
-	if m.successMsg != "" {
-		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Render("  ✓ " + m.successMsg))
-	} else if m.err != nil {
-		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Render("  ✗ " + m.err.Error()))
+	endIdx = startIdx + maxVisible
+	if endIdx > total {
+		endIdx = total
 	}
+	return startIdx, endIdx
+}
 
-	s.WriteString(st.helpStyle.Render("j/k or ↑/↓ to navigate • d to delete • esc to return"))
+// carouselDirection returns the "newer"/"older" hint shown on the compact
+// item i. Only the boxes at the edges of the window get one.
+func carouselDirection(i, selected, total, startIdx, endIdx int) string {
+	if i != startIdx && i != endIdx-1 {
+		return ""
+	}
 
-	return s.String()
+	if i < selected {
+		// This is a newer item
+		if i == 0 {
+			return "  Newest"
+		}
+		return fmt.Sprintf("  %d newer...", i)
+	} else if i > selected {
+		// This is an older item
+		if i == total-1 {
+			return "  Oldest"
+		}
+		return fmt.Sprintf("  %d older...", total-i-1)
+	}
+	return ""
 }
 
 func (m model) viewSendMessageRecipient() string {
@@ -1150,7 +1396,7 @@ func (m model) viewSendMessageRecipient() string {
 	var s strings.Builder
 
 	// Title
-	title := st.titleStyle.Width(70).Render("📝  Send Message")
+	title := st.titleStyle.Width(m.contentWidth()).Render("📝  Send Message")
 	s.WriteString(title)
 	s.WriteString("\n\n")
 
@@ -1165,12 +1411,12 @@ func (m model) viewSendMessageRecipient() string {
 	s.WriteString("\n\n")
 
 	// Input box
-	input := st.inputBoxStyle.Width(70).Render(m.recipientInput.View())
+	input := st.inputBoxStyle.Width(m.contentWidth()).Render(m.recipientInput.View())
 	s.WriteString(input)
 	s.WriteString("\n")
 
 	// Help text
-	s.WriteString(st.helpStyle.Render("Press [enter] to continue • [esc] to cancel"))
+	s.WriteString(st.helpStyle.Render("Enter a fingerprint or #group • [enter] to continue • [esc] to cancel"))
 
 	return s.String()
 }
@@ -1180,34 +1426,100 @@ func (m model) viewSendMessageContent() string {
 	var s strings.Builder
 
 	// Title
-	title := st.titleStyle.Width(70).Render("📝  Send Message")
+	titleText, step := "📝  Send Message", "Step 2 of 2: Write Your Message"
+	if m.editingScheduled != nil {
+		titleText, step = "⏰  Scheduled Message", "Sending "+m.formatTime(m.editingScheduled.SendAt, timeFull)
+	}
+	if m.editingSent != nil {
+		titleText, step = "✏  Edit Message", "Sent "+m.formatTime(m.editingSent.Timestamp, timeFull)
+	}
+	title := st.titleStyle.Width(m.contentWidth()).Render(titleText)
 	s.WriteString(title)
 	s.WriteString("\n\n")
 
 	// Instructions
-	s.WriteString(st.inputLabelStyle.Render("Step 2 of 2: Write Your Message"))
+	s.WriteString(st.inputLabelStyle.Render(step))
 	s.WriteString("\n")
 
 	// Recipient info
+	to := m.recipient
+	if m.recipientGroup != nil {
+		to = fmt.Sprintf("#%s (%d members)", m.recipientGroup.Name, m.recipientGroup.MemberCount)
+	}
 	recipientBox := m.renderer.NewStyle().
 		Foreground(st.secondaryColor).
-		Render(fmt.Sprintf("To: %s", m.recipient))
+		Render(fmt.Sprintf("To: %s", to))
 	s.WriteString(recipientBox)
 	s.WriteString("\n")
 
 	// Error message (fixed height to keep bottom elements stable)
 	if m.err != nil {
 		s.WriteString(st.errorStyle.Render(" ✗ " + m.err.Error() + " "))
+	} else if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("✓ " + m.successMsg))
 	}
 	s.WriteString("\n\n")
 
-	// Message input box
-	input := st.inputBoxStyle.Width(70).Render(m.messageInput.View())
+	// When to send the message, instead of the editor while asking
+	if m.scheduling {
+		s.WriteString(st.inputLabelStyle.Render("When should it be sent?"))
+		s.WriteString("\n")
+		s.WriteString(st.inputBoxStyle.Width(m.contentWidth()).Render(m.scheduleInput.View()))
+		s.WriteString("\n")
+		s.WriteString(st.helpStyle.Width(m.contentWidth()).Render("Such as \"in 2h\", \"tomorrow 9am\", \"fri 17:30\" or \"YYYY-MM-DD HH:MM\" • [enter] to schedule • [esc] to keep editing"))
+		return s.String()
+	}
+
+	// Message input box, or how the message will look
+	if m.composePreview {
+		preview := m.renderMarkdown(m.messageInput.Value(), m.bodyWidth())
+		if strings.TrimSpace(m.messageInput.Value()) == "" {
+			preview = m.renderer.NewStyle().Foreground(st.mutedColor).Italic(true).Render("Nothing to preview yet")
+		}
+		// Keep at least the height of the editor so the screen doesn't jump
+		if lines := strings.Count(preview, "\n") + 1; lines < m.messageInput.Height() {
+			preview += strings.Repeat("\n", m.messageInput.Height()-lines)
+		}
+		s.WriteString(st.inputBoxStyle.Width(m.contentWidth()).BorderForeground(st.accentColor).Render(preview))
+		s.WriteString("\n")
+		s.WriteString(st.helpStyle.Width(m.contentWidth()).Render(m.composeHelp()))
+		return s.String()
+	}
+	input := st.inputBoxStyle.Width(m.contentWidth()).Render(m.messageInput.View())
 	s.WriteString(input)
 	s.WriteString("\n")
 
 	// Help text
-	s.WriteString(st.helpStyle.Render("Press [ctrl+s] to send • [esc] to cancel"))
+	s.WriteString(st.helpStyle.Width(m.contentWidth()).Render(m.composeHelp()))
 
 	return s.String()
 }
+
+// composeHelp describes the compose keys for what is being written.
+func (m model) composeHelp() string {
+	send, leave := "to send", "to save as draft"
+	if m.editingScheduled != nil || m.editingSent != nil {
+		send, leave = "to save", "to cancel"
+	}
+	quick := m.userSettings.ComposeMode == composeModeQuick
+	hints := []string{m.keyHint(keySend, send)}
+	if quick {
+		hints[0] = "enter " + send
+	}
+	if m.composePreview {
+		hints = append(hints, m.keyHint(keyPreview, "to keep editing"))
+	} else {
+		if quick {
+			hints = append(hints, m.keyHint(keyNewLine, "for a new line"))
+		}
+		switch {
+		case m.editingScheduled != nil:
+			hints = append(hints, m.keyHint(keySchedule, "to change the time"))
+		case m.editingSent == nil:
+			hints = append(hints, m.keyHint(keySchedule, "to schedule"))
+		}
+		hints = append(hints, m.keyHint(keyPreview, "to preview"))
+	}
+	hints = append(hints, m.keyHint(keyLeaveCompose, leave))
+	return strings.Join(hints, " • ")
+}
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+const (
+	eventMessageReceived = "message.received"
+	eventMessageRead     = "message.read"
+	eventMessageEdited   = "message.edited"
+	eventMessageUnsent   = "message.unsent"
+	eventUserFirstSeen   = "user.first_seen"
+	eventPing            = "ping"
+
+	webhookMaxAttempts = 5
+	webhookTimeout     = 10 * time.Second
+	webhookWorkers     = 4
+)
+
+// webhookEventPresets are the choices offered when cycling a webhook's
+// subscribed events in the settings screen.
+var webhookEventPresets = []string{
+	"*",
+	eventMessageReceived,
+	eventMessageRead,
+	eventMessageReceived + "," + eventMessageRead,
+	eventMessageEdited + "," + eventMessageUnsent,
+	eventUserFirstSeen,
+}
+
+// webhookPayload is the JSON body POSTed to webhooks. The body is signed with
+// the webhook's secret and the hex HMAC-SHA256 is sent in the
+// X-Soshial-Signature header as "sha256=<hex>".
+type webhookPayload struct {
+	Event     string    `json:"event"`
+	Timestamp time.Time `json:"timestamp"`
+	Data      any       `json:"data"`
+}
+
+type webhookJob struct {
+	hook    Webhook
+	event   string
+	body    []byte
+	attempt int
+}
+
+// Webhooks delivers events to registered webhooks in the background,
+// retrying failed deliveries with exponential backoff.
+type Webhooks struct {
+	db     *Database
+	client *http.Client
+	queue  chan webhookJob
+	ctx    context.Context
+}
+
+func NewWebhooks(db *Database) *Webhooks {
+	// Addresses are checked as the connection is made, so a host can't
+	// pass validation and later resolve to an internal address. Proxies
+	// would hide the address, and redirects could point anywhere.
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: checkWebhookDial}
+	client := &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: &http.Transport{Proxy: nil, DialContext: dialer.DialContext},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return &Webhooks{
+		db:     db,
+		client: client,
+		queue:  make(chan webhookJob, 256),
+		ctx:    context.Background(),
+	}
+}
+
+// checkWebhookDial refuses connections to addresses webhooks may not reach.
+func checkWebhookDial(_, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if blockedWebhookAddr(addrPort.Addr()) {
+		return fmt.Errorf("webhooks may not connect to %s", addrPort.Addr())
+	}
+	return nil
+}
+
+// blockedWebhookAddr reports whether addr is on the server itself or on a
+// private or link-local network, which visitors must not be able to make
+// the server send requests to.
+func blockedWebhookAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified()
+}
+
+// Run starts the delivery workers. They stop when ctx is cancelled.
+func (w *Webhooks) Run(ctx context.Context) {
+	w.ctx = ctx
+	for i := 0; i < webhookWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-w.queue:
+					w.deliver(job)
+				}
+			}
+		}()
+	}
+}
+
+// Emit queues an event for every webhook interested in it. ownerKey is the
+// user the event concerns; global webhooks receive every event.
+func (w *Webhooks) Emit(event, ownerKey string, data any) {
+	hooks, err := w.db.GetWebhooksForEvent(event, ownerKey)
+	if err != nil {
+		log.Printf("Failed to load webhooks for %s: %v", event, err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	body, err := json.Marshal(webhookPayload{Event: event, Timestamp: time.Now().UTC(), Data: data})
+	if err != nil {
+		log.Printf("Failed to encode %s webhook payload: %v", event, err)
+		return
+	}
+
+	for _, hook := range hooks {
+		w.enqueue(webhookJob{hook: hook, event: event, body: body, attempt: 1})
+	}
+}
+
+func (w *Webhooks) enqueue(job webhookJob) {
+	select {
+	case w.queue <- job:
+	default:
+		log.Printf("Webhook queue full, dropping %s for webhook %d", job.event, job.hook.ID)
+	}
+}
+
+func (w *Webhooks) deliver(job webhookJob) {
+	status, err := w.post(job.hook, job.event, job.body)
+
+	var errText string
+	if err != nil {
+		errText = err.Error()
+	}
+	if logErr := w.db.LogWebhookDelivery(job.hook.ID, job.event, string(job.body), job.attempt, status, errText); logErr != nil {
+		log.Printf("Failed to log webhook delivery: %v", logErr)
+	}
+
+	if err == nil || job.attempt >= webhookMaxAttempts {
+		return
+	}
+
+	// Back off 1s, 2s, 4s, 8s between attempts
+	backoff := time.Duration(1<<(job.attempt-1)) * time.Second
+	job.attempt++
+	time.AfterFunc(backoff, func() {
+		if w.ctx.Err() == nil {
+			w.enqueue(job)
+		}
+	})
+}
+
+// post sends a single signed request and returns the response status code.
+// Any non-2xx response is reported as an error.
+func (w *Webhooks) post(hook Webhook, event string, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SoSHial-Webhook/1")
+	req.Header.Set("X-Soshial-Event", event)
+	req.Header.Set("X-Soshial-Signature", "sha256="+signWebhookBody(hook.Secret, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// TestFire sends a ping event to a single webhook right away, without
+// retries, and logs the attempt.
+func (w *Webhooks) TestFire(hook Webhook, userKey string) (int, error) {
+	body, err := json.Marshal(webhookPayload{
+		Event:     eventPing,
+		Timestamp: time.Now().UTC(),
+		Data:      map[string]string{"triggered_by": userKey},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	status, err := w.post(hook, eventPing, body)
+	var errText string
+	if err != nil {
+		errText = err.Error()
+	}
+	if logErr := w.db.LogWebhookDelivery(hook.ID, eventPing, string(body), 1, status, errText); logErr != nil {
+		log.Printf("Failed to log webhook delivery: %v", logErr)
+	}
+	return status, err
+}
+
+func signWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validateWebhookURL checks that raw is an http(s) URL whose host resolves
+// only to addresses webhooks may reach.
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("webhook URL must be an absolute http(s) URL")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("couldn't resolve %s", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if blockedWebhookAddr(addr) {
+			return fmt.Errorf("webhooks may not point at local or private addresses")
+		}
+	}
+	return nil
+}
+
+type webhookTestMsg struct {
+	status int
+	err    error
+}
+
+// webhookAddedMsg reports whether a webhook URL checked out and was added,
+// with the secret it was given.
+type webhookAddedMsg struct {
+	secret string
+	err    error
+}
+
+// addWebhook checks rawURL and creates the webhook in the background, since
+// resolving the host can take as long as webhookTimeout.
+func (m model) addWebhook(rawURL string) tea.Cmd {
+	owner := m.userKey
+	if m.addingGlobalWebhook {
+		owner = ""
+	}
+	db := m.db
+	return func() tea.Msg {
+		if err := validateWebhookURL(rawURL); err != nil {
+			return webhookAddedMsg{err: err}
+		}
+		secret, err := newWebhookSecret()
+		if err != nil {
+			return webhookAddedMsg{err: err}
+		}
+		if _, err := db.CreateWebhook(owner, rawURL, secret, "*"); err != nil {
+			return webhookAddedMsg{err: err}
+		}
+		return webhookAddedMsg{secret: secret}
+	}
+}
+
+func (m model) handleWebhookAdded(msg webhookAddedMsg) (tea.Model, tea.Cmd) {
+	m.checkingWebhook = false
+	if msg.err != nil {
+		m.err = msg.err
+		m.successMsg = ""
+		return m, nil
+	}
+	m.addingWebhook = false
+	m.webhookInput.Blur()
+	m.err = nil
+	m.successMsg = "Webhook added • secret copied to clipboard"
+	m.clipboardText = msg.secret
+	m.selectedWebhook = len(m.webhooks)
+	if m.currentScreen == webhookSettings {
+		return m.reloadWebhooks()
+	}
+	return m, nil
+}
+
+func (m model) openWebhooks() (tea.Model, tea.Cmd) {
+	m.currentScreen = webhookSettings
+	m.selectedWebhook = 0
+	m.addingWebhook = false
+	m.err = nil
+	m.successMsg = ""
+	return m.reloadWebhooks()
+}
+
+func (m model) reloadWebhooks() (tea.Model, tea.Cmd) {
+	hooks, err := m.db.GetWebhooks(m.userKey, m.isAdmin)
+	if err != nil {
+		m.err = err
+		return m, nil
+	}
+	m.webhooks = hooks
+	if m.selectedWebhook >= len(hooks) {
+		m.selectedWebhook = max(len(hooks)-1, 0)
+	}
+
+	m.webhookDeliveries = nil
+	if len(hooks) > 0 {
+		deliveries, err := m.db.GetWebhookDeliveries(hooks[m.selectedWebhook].ID, 5)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.webhookDeliveries = deliveries
+	}
+	return m, nil
+}
+
+func (m model) updateWebhookSettings(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+
+	if m.addingWebhook {
+		switch msg.String() {
+		case "esc":
+			m.addingWebhook = false
+			m.webhookInput.Blur()
+			m.err = nil
+			return m, nil
+
+		case "enter":
+			if m.checkingWebhook {
+				return m, nil
+			}
+			m.checkingWebhook = true
+			m.err = nil
+			return m, m.addWebhook(strings.TrimSpace(m.webhookInput.Value()))
+		}
+
+		m.webhookInput, cmd = m.webhookInput.Update(msg)
+		return m, cmd
+	}
+
+	switch {
+	case m.keys.matches(msg, keyBack):
+		m.currentScreen = settingsMenu
+		m.err = nil
+		m.successMsg = ""
+
+	case m.keys.matches(msg, keyDown):
+		if len(m.webhooks) > 0 {
+			m.selectedWebhook = (m.selectedWebhook + 1) % len(m.webhooks)
+			return m.reloadWebhooks()
+		}
+	case m.keys.matches(msg, keyUp):
+		if len(m.webhooks) > 0 {
+			m.selectedWebhook = (m.selectedWebhook - 1 + len(m.webhooks)) % len(m.webhooks)
+			return m.reloadWebhooks()
+		}
+
+	case m.keys.matches(msg, keyAdd, keyAddGlobal):
+		global := m.keys.matches(msg, keyAddGlobal)
+		if global && !m.isAdmin {
+			return m, nil
+		}
+		m.addingWebhook = true
+		m.addingGlobalWebhook = global
+		m.webhookInput.SetValue("")
+		m.err = nil
+		m.successMsg = ""
+		return m, m.webhookInput.Focus()
+
+	case m.keys.matches(msg, keyEdit):
+		if len(m.webhooks) == 0 {
+			return m, nil
+		}
+		hook := m.webhooks[m.selectedWebhook]
+		next := webhookEventPresets[0]
+		for i, preset := range webhookEventPresets {
+			if preset == hook.Events {
+				next = webhookEventPresets[(i+1)%len(webhookEventPresets)]
+				break
+			}
+		}
+		if err := m.db.SetWebhookEvents(hook.ID, m.webhookOwner(hook), next); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.successMsg = "Events: " + webhookEventsLabel(next)
+		return m.reloadWebhooks()
+
+	case m.keys.matches(msg, keyCopy):
+		if len(m.webhooks) > 0 {
+			m.clipboardText = m.webhooks[m.selectedWebhook].Secret
+			m.successMsg = "Webhook secret copied to clipboard!"
+		}
+
+	case m.keys.matches(msg, keyTest):
+		if len(m.webhooks) == 0 {
+			return m, nil
+		}
+		hook := m.webhooks[m.selectedWebhook]
+		m.successMsg = "Sending test event..."
+		m.err = nil
+		return m, func() tea.Msg {
+			status, err := m.webhookSender.TestFire(hook, m.userKey)
+			return webhookTestMsg{status: status, err: err}
+		}
+
+	case m.keys.matches(msg, keyDelete):
+		if len(m.webhooks) == 0 {
+			return m, nil
+		}
+		hook := m.webhooks[m.selectedWebhook]
+		if err := m.db.DeleteWebhook(hook.ID, m.webhookOwner(hook)); err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.successMsg = "Webhook deleted"
+		return m.reloadWebhooks()
+	}
+	return m, nil
+}
+
+// webhookOwner is the owner the user may change hook as: themselves, or no
+// one for admins changing a global webhook.
+func (m model) webhookOwner(hook Webhook) string {
+	if hook.OwnerKey == "" && m.isAdmin {
+		return ""
+	}
+	return m.userKey
+}
+
+func webhookEventsLabel(events string) string {
+	if events == "*" {
+		return "all events"
+	}
+	return strings.ReplaceAll(events, ",", ", ")
+}
+
+func (m model) viewWebhookSettings() string {
+	st := m.getStyles()
+	var s strings.Builder
+
+	// Title
+	title := st.titleStyle.Width(m.contentWidth()).Render("🔗  Webhooks")
+	s.WriteString(title)
+	s.WriteString("\n\n")
+
+	if m.addingWebhook {
+		label := "Enter the URL to POST events to"
+		if m.addingGlobalWebhook {
+			label = "Enter the URL for a global webhook (receives every user's events)"
+		}
+		s.WriteString(st.inputLabelStyle.Render(label))
+		s.WriteString("\n\n")
+
+		// Error message (fixed height to keep bottom elements stable)
+		if m.err != nil {
+			s.WriteString(st.errorStyle.Render(" ✗ " + m.err.Error() + " "))
+		} else if m.checkingWebhook {
+			s.WriteString(m.renderer.NewStyle().Foreground(st.mutedColor).Render("Checking the URL..."))
+		}
+		s.WriteString("\n\n")
+
+		input := st.inputBoxStyle.Width(m.contentWidth()).Render(m.webhookInput.View())
+		s.WriteString(input)
+		s.WriteString("\n")
+		s.WriteString(st.helpStyle.Render("Press [enter] to add • [esc] to cancel"))
+		return s.String()
+	}
+
+	if len(m.webhooks) == 0 {
+		s.WriteString(st.emptyStateStyle.Width(m.contentWidth()).Render("No webhooks yet.\n\nAdd one to get a signed JSON POST\nwhen you receive or someone reads a message."))
+		s.WriteString("\n")
+	} else {
+		for i, hook := range m.webhooks {
+			scope := ""
+			if hook.OwnerKey == "" {
+				scope = " " + st.newBadgeStyle.Render(" GLOBAL ")
+			}
+			line := fmt.Sprintf("%s  (%s)", hook.URL, webhookEventsLabel(hook.Events))
+			if i == m.selectedWebhook {
+				indicator := m.renderer.NewStyle().Foreground(st.accentColor).Render("▶ ")
+				s.WriteString("  " + indicator + m.renderer.NewStyle().Foreground(st.selectionColor).Bold(true).Render(line) + scope)
+			} else {
+				s.WriteString("    " + m.renderer.NewStyle().Foreground(st.textColor).Render(line) + scope)
+			}
+			s.WriteString("\n")
+		}
+
+		// Recent deliveries for the selected webhook
+		s.WriteString("\n")
+		s.WriteString(st.inputLabelStyle.Render("Recent deliveries"))
+		s.WriteString("\n")
+		if len(m.webhookDeliveries) == 0 {
+			s.WriteString(st.messageTimeStyle.Render("  Nothing delivered yet"))
+			s.WriteString("\n")
+		}
+		for _, delivery := range m.webhookDeliveries {
+			var result string
+			if delivery.Error == "" {
+				result = m.renderer.NewStyle().Foreground(st.successColor).Render(fmt.Sprintf("✓ %d", delivery.StatusCode))
+			} else {
+				result = m.renderer.NewStyle().Foreground(st.errorColor).Render("✗ " + delivery.Error)
+			}
+			line := fmt.Sprintf("  %s  %-16s #%d  ", m.formatTime(delivery.DeliveredAt, timeShort), delivery.Event, delivery.Attempt)
+			s.WriteString(m.renderer.NewStyle().Foreground(st.mutedColor).Render(line))
+			s.WriteString(m.renderer.NewStyle().MaxWidth(40).Render(result))
+			s.WriteString("\n")
+		}
+	}
+
+	// Success or error messages
+	s.WriteString("\n")
+	if m.successMsg != "" {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.successColor).Width(m.contentWidth()).Render("  ✓ " + m.successMsg))
+	} else if m.err != nil {
+		s.WriteString(m.renderer.NewStyle().Foreground(st.errorColor).Width(m.contentWidth()).Render("  ✗ " + m.err.Error()))
+	}
+	s.WriteString("\n")
+
+	help := m.keyHint(keyAdd, "to add") + " • "
+	if m.isAdmin {
+		help += m.keyHint(keyAddGlobal, "to add global") + " • "
+	}
+	help += m.keyHint(keyTest, "to test-fire") + " • " + m.keyHint(keyEdit, "to change events") + " • " + m.keyHint(keyCopy, "to copy secret") + " • " + m.keyHint(keyDelete, "to delete") + " • " + m.keyHint(keyBack, "to return")
+	s.WriteString(st.helpStyle.Width(m.contentWidth()).Render(help))
+
+	return s.String()
+}
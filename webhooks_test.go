@@ -0,0 +1,110 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestBlockedWebhookAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		blocked bool
+	}{
+		{"127.0.0.1", true},
+		{"127.8.9.10", true},
+		{"::1", true},
+		{"::ffff:127.0.0.1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"192.168.1.1", true},
+		{"::ffff:192.168.1.1", true},
+		{"fd00::1", true},
+		{"169.254.169.254", true},
+		{"fe80::1", true},
+		{"224.0.0.1", true},
+		{"ff02::1", true},
+		{"0.0.0.0", true},
+		{"::", true},
+
+		{"93.184.216.34", false},
+		{"172.32.0.1", false},
+		{"8.8.8.8", false},
+		{"2606:4700:4700::1111", false},
+		{"::ffff:1.1.1.1", false},
+	}
+	for _, tt := range tests {
+		if got := blockedWebhookAddr(netip.MustParseAddr(tt.addr)); got != tt.blocked {
+			t.Errorf("blockedWebhookAddr(%s) = %v, want %v", tt.addr, got, tt.blocked)
+		}
+	}
+}
+
+func TestCheckWebhookDial(t *testing.T) {
+	tests := []struct {
+		address string
+		ok      bool
+	}{
+		{"127.0.0.1:80", false},
+		{"[::1]:443", false},
+		{"10.0.0.1:8080", false},
+		{"169.254.169.254:80", false},
+		{"93.184.216.34:443", true},
+		{"[2606:4700:4700::1111]:443", true},
+		{"not an address", false},
+	}
+	for _, tt := range tests {
+		err := checkWebhookDial("tcp", tt.address, nil)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkWebhookDial(%q) = %v, want ok %v", tt.address, err, tt.ok)
+		}
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://93.184.216.34/hook", true},
+		{"http://[2606:4700:4700::1111]:8080/hook", true},
+		{"http://127.0.0.1/hook", false},
+		{"http://localhost/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://10.0.0.5/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://0.0.0.0:8080/", false},
+		{"ftp://93.184.216.34/hook", false},
+		{"/relative/path", false},
+		{"https://", false},
+		{"not a url", false},
+	}
+	for _, tt := range tests {
+		err := validateWebhookURL(tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("validateWebhookURL(%q) = %v, want ok %v", tt.url, err, tt.ok)
+		}
+	}
+}
+
+// A webhook whose host passed validation but now resolves to the server
+// itself must still not be reached.
+func TestWebhookDialGuard(t *testing.T) {
+	reached := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer server.Close()
+
+	w := NewWebhooks(nil)
+	_, err := w.post(Webhook{URL: server.URL, Secret: "secret"}, eventPing, []byte("{}"))
+	if err == nil || !strings.Contains(err.Error(), "webhooks may not connect to 127.0.0.1") {
+		t.Errorf("post to %s = %v, want the dial to be refused", server.URL, err)
+	}
+	if reached {
+		t.Error("the local server received the webhook")
+	}
+}